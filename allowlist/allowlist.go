@@ -5,24 +5,54 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
-type config struct {
+// Config is the top-level structure of an allowlist file.
+type Config struct {
 	Format    string            `json:"format"`
 	Allowlist []*AllowlistEntry `json:"allowlist"`
 }
 
-// AllowlistEntry maps some entity (a domain or email) to a list of authorized sites.
+// AllowlistEntry maps some entity (a domain, email, or identity provider
+// claim) to a list of authorized sites.
 type AllowlistEntry struct {
-	// Only one of Domain or Email may be set
-	Domain string `json:"domain"`
-	Email  string `json:"email"`
+	// Only one of Domain, Email, or Claim may be set
+	Domain string `json:"domain,omitempty"`
+	Email  string `json:"email,omitempty"`
+
+	// Claim and Value match users whose source token contains Value in the
+	// claim named Claim, which can be either a string or a list of strings. This
+	// allows managing access via directory membership, e.g. with
+	// {"claim": "groups", "value": "<group object ID>"}, a 'roles' claim, or a
+	// custom B2C extension attribute like 'extension_AccessLevel'.
+	Claim string `json:"claim,omitempty"`
+	Value string `json:"value,omitempty"`
+	// Provider, which can only be set along with Claim, limits the entry to
+	// tokens from the identity provider with that name (see the 'idp' claim of
+	// issued tokens). Claims are only as trustworthy as the provider asserting
+	// them, so when several providers share an allowlist, every claim entry has
+	// to set a provider.
+	Provider string `json:"provider,omitempty"`
 
 	// If empty, all sites are allowed.
 	// This isn't a "fail closed" default, but I think that's fine at this stage.
-	Sites []string `json:"sites"`
+	Sites []string `json:"sites,omitempty"`
+
+	// Roles are granted to users that the entry matches, and issued in the
+	// 'roles' claim of their tokens, e.g. for downstream services to check with
+	// authz.AnyRole.
+	Roles []string `json:"roles,omitempty"`
+
+	// NotBefore and NotAfter optionally bound the window in which the entry
+	// grants access, e.g. for pilot partners with a fixed engagement period.
+	// Either (or both) can be omitted, and both are RFC 3339 formatted.
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
 }
 
 type Site string
@@ -36,29 +66,127 @@ type Entity struct {
 	// If true, AllowedSites is ignored
 	AllowAllSites bool
 	AllowedSites  []Site
+
+	// Roles are the entity's roles, which apply to every site it can access.
+	Roles []string
+
+	// NotAfter is when the access granted by this entity ends. The zero value
+	// means access doesn't end.
+	NotAfter time.Time
+}
+
+// Allows returns true if the entity can access the given site.
+func (e *Entity) Allows(site Site) bool {
+	if e.AllowAllSites {
+		return true
+	}
+	for _, s := range e.AllowedSites {
+		if s == site {
+			return true
+		}
+	}
+	return false
+}
+
+// Source makes allowlist decisions, which allows the allowlist to be stored
+// somewhere other than a local file. *Checker is the file-based implementation.
+type Source interface {
+	// Check returns the entity an email is allowed to act as, or nil if the
+	// email isn't allowed.
+	Check(email string) (*Entity, error)
+	// ClaimNames returns the names of all claims the allowlist has entries for.
+	ClaimNames() []string
+	// CheckClaim returns the match for the given claim value in a token from
+	// the named provider, or nil if that value isn't allowed.
+	CheckClaim(provider, name, value string) (*Match, error)
+	// HasUnscopedClaims returns true if any claim entries don't set a
+	// provider, which isn't allowed if the allowlist is shared by several
+	// providers.
+	HasUnscopedClaims() bool
 }
 
+var _ Source = (*Checker)(nil)
+
 type Checker struct {
-	allowedDomains map[string]*Entity
-	allowedEmails  map[string]*Entity
+	allowedDomains map[string]*rule
+	allowedEmails  map[string]*rule
+	// Map from claim name -> provider + claim value -> rule
+	allowedClaims    map[string]map[claimKey]*rule
+	hasUnscopedClaim bool
+
+	entries []*AllowlistEntry
+	now     func() time.Time
+}
+
+// claimKey identifies a claim entry by its value, and the provider it's scoped
+// to, if any.
+type claimKey struct {
+	provider string
+	value    string
 }
 
-func NewCheckerFromConfigFile(fn string) (*Checker, error) {
+// rule is an entity along with the window in which it applies.
+type rule struct {
+	entry     *AllowlistEntry
+	entity    *Entity
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+func (r *rule) activeAt(t time.Time) bool {
+	if !r.notBefore.IsZero() && t.Before(r.notBefore) {
+		return false
+	}
+	if !r.notAfter.IsZero() && !t.Before(r.notAfter) {
+		return false
+	}
+	return true
+}
+
+type Option func(*Checker)
+
+// WithNow overrides the clock used to evaluate time-bounded entries, which
+// defaults to time.Now.
+func WithNow(now func() time.Time) Option {
+	return func(c *Checker) {
+		c.now = now
+	}
+}
+
+func NewCheckerFromConfigFile(fn string, opts ...Option) (*Checker, error) {
+	cfg, err := LoadConfigFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	return NewChecker(cfg, opts...)
+}
+
+// LoadConfigFile reads an allowlist config from the given file, without
+// validating it. Use NewChecker to validate the config.
+func LoadConfigFile(fn string) (*Config, error) {
 	f, err := os.Open(fn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open allowlist config file: %w", err)
 	}
 	defer f.Close()
 
-	var cfg config
-	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+	return DecodeConfig(f)
+}
+
+// DecodeConfig reads a JSON-formatted allowlist config, without validating
+// it. This is useful when the config doesn't come directly from a plaintext
+// file, e.g. if it needs to be decrypted first.
+func DecodeConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to decode allowlist config: %w", err)
 	}
 
-	return newChecker(&cfg)
+	return &cfg, nil
 }
 
-func newChecker(cfg *config) (*Checker, error) {
+// NewChecker validates the given config and returns a *Checker for it.
+func NewChecker(cfg *Config, opts ...Option) (*Checker, error) {
 	switch cfg.Format {
 	case "v1":
 		// Valid, continue
@@ -68,30 +196,77 @@ func newChecker(cfg *config) (*Checker, error) {
 		return nil, fmt.Errorf("unknown format %q", cfg.Format)
 	}
 
-	allowedDomains := make(map[string]*Entity)
-	allowedEmails := make(map[string]*Entity)
+	allowedDomains := make(map[string]*rule)
+	allowedEmails := make(map[string]*rule)
+	allowedClaims := make(map[string]map[claimKey]*rule)
+	hasUnscopedClaim := false
 	for i, ae := range cfg.Allowlist {
 		if ae.Domain != "" && ae.Email != "" {
 			return nil, fmt.Errorf("allowlist entry specified both a domain (%q) and an email (%q), which isn't allowed", ae.Domain, ae.Email)
 		}
-		if ae.Domain == "" && ae.Email == "" {
-			return nil, fmt.Errorf("allowlist entry at index %d did not specify a domain or email", i)
+		if ae.Claim != "" && (ae.Domain != "" || ae.Email != "") {
+			return nil, fmt.Errorf("allowlist entry at index %d specified a claim (%q) along with a domain or email, which isn't allowed", i, ae.Claim)
+		}
+		if ae.Domain == "" && ae.Email == "" && ae.Claim == "" {
+			return nil, fmt.Errorf("allowlist entry at index %d did not specify a domain, email, or claim", i)
+		}
+		if (ae.Claim == "") != (ae.Value == "") {
+			return nil, fmt.Errorf("allowlist entry at index %d must specify both a claim and a value, or neither", i)
+		}
+		if ae.Provider != "" && ae.Claim == "" {
+			return nil, fmt.Errorf("allowlist entry at index %d specified a provider (%q) without a claim, which isn't allowed", i, ae.Provider)
 		}
 		entity, err := parseEntity(ae.Sites)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse sites for entry at index %d: %w", i, err)
 		}
+		for _, role := range ae.Roles {
+			if role == "" || strings.ContainsAny(role, " \t\r\n") {
+				return nil, fmt.Errorf("allowlist entry at index %d has invalid role %q", i, role)
+			}
+		}
+		entity.Roles = ae.Roles
+		r := &rule{entry: ae, entity: entity}
+		if ae.NotBefore != nil {
+			r.notBefore = *ae.NotBefore
+		}
+		if ae.NotAfter != nil {
+			r.notAfter = *ae.NotAfter
+			entity.NotAfter = *ae.NotAfter
+		}
+		if !r.notBefore.IsZero() && !r.notAfter.IsZero() && !r.notBefore.Before(r.notAfter) {
+			return nil, fmt.Errorf("allowlist entry at index %d has a notBefore (%s) that isn't before its notAfter (%s)", i, r.notBefore.Format(time.RFC3339), r.notAfter.Format(time.RFC3339))
+		}
 		if ae.Domain != "" {
-			allowedDomains[strings.ToLower(ae.Domain)] = entity
+			allowedDomains[strings.ToLower(ae.Domain)] = r
 		}
 		if ae.Email != "" {
-			allowedEmails[strings.ToLower(ae.Email)] = entity
+			allowedEmails[strings.ToLower(ae.Email)] = r
+		}
+		if ae.Claim != "" {
+			if _, ok := allowedClaims[ae.Claim]; !ok {
+				allowedClaims[ae.Claim] = make(map[claimKey]*rule)
+			}
+			// Unlike emails + domains, claim values (e.g. group IDs) are matched
+			// exactly, as we can't assume they're case-insensitive.
+			allowedClaims[ae.Claim][claimKey{provider: ae.Provider, value: ae.Value}] = r
+			if ae.Provider == "" {
+				hasUnscopedClaim = true
+			}
 		}
 	}
-	return &Checker{
-		allowedDomains: allowedDomains,
-		allowedEmails:  allowedEmails,
-	}, nil
+	c := &Checker{
+		allowedDomains:   allowedDomains,
+		allowedEmails:    allowedEmails,
+		allowedClaims:    allowedClaims,
+		hasUnscopedClaim: hasUnscopedClaim,
+		entries:          cfg.Allowlist,
+		now:              time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
 func parseEntity(inp []string) (*Entity, error) {
@@ -100,7 +275,7 @@ func parseEntity(inp []string) (*Entity, error) {
 	}
 	var sites []Site
 	for _, s := range inp {
-		st, err := parseSite(s)
+		st, err := ParseSite(s)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse entity %q: %w", s, err)
 		}
@@ -109,7 +284,8 @@ func parseEntity(inp []string) (*Entity, error) {
 	return &Entity{AllowedSites: sites}, nil
 }
 
-func parseSite(inp string) (Site, error) {
+// ParseSite returns the site with the given name, e.g. "PACTA".
+func ParseSite(inp string) (Site, error) {
 	switch inp {
 	case "OPGEE":
 		return SiteOPGEE, nil
@@ -122,13 +298,35 @@ func parseSite(inp string) (Site, error) {
 
 // Check returns if the email is of an allowlisted domain, and errors if the
 // email is incorrectly formatted. Subdomains are not handled specially, only
-// exact matches are allowed.
+// exact matches are allowed. Entries outside of their notBefore/notAfter window
+// are treated as if they weren't in the allowlist.
 func (c *Checker) Check(email string) (*Entity, error) {
+	m, err := c.Match(email)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, nil
+	}
+	return m.Entity, nil
+}
+
+// Match describes which allowlist entry allowed a user, and what it allowed.
+type Match struct {
+	Entry  *AllowlistEntry
+	Entity *Entity
+}
+
+// Match is like Check, but also returns the entry responsible for allowing the
+// email, which is useful for explaining access decisions. It returns nil if the
+// email isn't allowed.
+func (c *Checker) Match(email string) (*Match, error) {
 	email = strings.ToLower(email)
+	now := c.now()
 
 	// First, check the email
-	if tmp, ok := c.allowedEmails[email]; ok {
-		return tmp, nil
+	if tmp, ok := c.allowedEmails[email]; ok && tmp.activeAt(now) {
+		return &Match{Entry: tmp.entry, Entity: tmp.entity}, nil
 	}
 
 	_, domain, ok := strings.Cut(email, "@")
@@ -136,9 +334,54 @@ func (c *Checker) Check(email string) (*Entity, error) {
 		return nil, fmt.Errorf("email %q was missing '@'", email)
 	}
 
-	if tmp, ok := c.allowedDomains[domain]; ok {
-		return tmp, nil
+	if tmp, ok := c.allowedDomains[domain]; ok && tmp.activeAt(now) {
+		return &Match{Entry: tmp.entry, Entity: tmp.entity}, nil
 	}
 
 	return nil, nil
 }
+
+// ClaimNames returns the names of all claims referenced by the allowlist, in
+// sorted order. Callers can use these to determine which claims in a source
+// token to pass to CheckClaim.
+func (c *Checker) ClaimNames() []string {
+	var names []string
+	for name := range c.allowedClaims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckClaim returns the match for the given claim name and value in a token
+// from the named provider, or nil if that claim value isn't in the allowlist.
+// Entries scoped to the provider take precedence over unscoped ones, and
+// entries scoped to other providers never match.
+func (c *Checker) CheckClaim(provider, name, value string) (*Match, error) {
+	now := c.now()
+	for _, key := range []claimKey{{provider: provider, value: value}, {value: value}} {
+		if tmp, ok := c.allowedClaims[name][key]; ok && tmp.activeAt(now) {
+			return &Match{Entry: tmp.entry, Entity: tmp.entity}, nil
+		}
+	}
+	return nil, nil
+}
+
+// HasUnscopedClaims returns true if any claim entries don't set a provider.
+func (c *Checker) HasUnscopedClaims() bool {
+	return c.hasUnscopedClaim
+}
+
+// ExpiringWithin returns all entries with a notAfter before now + d, which
+// includes entries that have already expired but are still in the allowlist.
+// Entries are returned in the order they appear in the config.
+func (c *Checker) ExpiringWithin(d time.Duration) []*AllowlistEntry {
+	cutoff := c.now().Add(d)
+	var out []*AllowlistEntry
+	for _, ae := range c.entries {
+		if ae.NotAfter != nil && ae.NotAfter.Before(cutoff) {
+			out = append(out, ae)
+		}
+	}
+	return out
+}
@@ -2,21 +2,23 @@ package allowlist
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
 
-var exampleConfig = &config{
+var exampleConfig = &Config{
 	Format: "v1",
 	Allowlist: []*AllowlistEntry{
 		&AllowlistEntry{Domain: "example.com"},                                  // Can access any site
 		&AllowlistEntry{Domain: "only-opgee.com", Sites: []string{"OPGEE"}},     // Can only access OPGEE
 		&AllowlistEntry{Email: "test@only-pacta.com", Sites: []string{"PACTA"}}, // Only test@ can access PACTA
+		&AllowlistEntry{Email: "admin@only-pacta.com", Sites: []string{"PACTA"}, Roles: []string{"admin"}},
 	},
 }
 
 func TestCheck(t *testing.T) {
-	c, err := newChecker(exampleConfig)
+	c, err := NewChecker(exampleConfig)
 	if err != nil {
 		t.Fatalf("failed to init checker: %v", err)
 	}
@@ -46,6 +48,11 @@ func TestCheck(t *testing.T) {
 			email: "test@only-pacta.com",
 			want:  &Entity{AllowedSites: []Site{SitePACTA}},
 		},
+		{
+			desc:  "email allowlisted for PACTA with a role",
+			email: "admin@only-pacta.com",
+			want:  &Entity{AllowedSites: []Site{SitePACTA}, Roles: []string{"admin"}},
+		},
 		{
 			desc:  "different email allowlisted for PACTA",
 			email: "not-allowed@only-pacta.com",
@@ -67,7 +74,7 @@ func TestCheck(t *testing.T) {
 }
 
 func TestCheck_Error(t *testing.T) {
-	c, err := newChecker(exampleConfig)
+	c, err := NewChecker(exampleConfig)
 	if err != nil {
 		t.Fatalf("failed to init checker: %v", err)
 	}
@@ -80,3 +87,253 @@ func TestCheck_Error(t *testing.T) {
 		t.Errorf("Check said invalid email was allowed: %+v", entity)
 	}
 }
+
+func TestCheck_TimeBounded(t *testing.T) {
+	start := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &Config{
+		Format: "v1",
+		Allowlist: []*AllowlistEntry{
+			&AllowlistEntry{Domain: "pilot.example.com", Sites: []string{"PACTA"}, NotBefore: &start, NotAfter: &end},
+			&AllowlistEntry{Email: "early@example.com", NotAfter: &start},
+			&AllowlistEntry{Domain: "example.com", Sites: []string{"OPGEE"}},
+		},
+	}
+
+	tests := []struct {
+		desc  string
+		email string
+		now   time.Time
+		want  *Entity
+	}{
+		{
+			desc:  "before the window",
+			email: "user@pilot.example.com",
+			now:   start.Add(-time.Second),
+			want:  nil,
+		},
+		{
+			desc:  "start of the window",
+			email: "user@pilot.example.com",
+			now:   start,
+			want:  &Entity{AllowedSites: []Site{SitePACTA}, NotAfter: end},
+		},
+		{
+			desc:  "end of the window",
+			email: "user@pilot.example.com",
+			now:   end,
+			want:  nil,
+		},
+		{
+			desc:  "expired email falls back to domain",
+			email: "early@example.com",
+			now:   start,
+			want:  &Entity{AllowedSites: []Site{SiteOPGEE}},
+		},
+		{
+			desc:  "email before it expires",
+			email: "early@example.com",
+			now:   start.Add(-time.Hour),
+			want:  &Entity{AllowAllSites: true, NotAfter: start},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c, err := NewChecker(cfg, WithNow(func() time.Time { return test.now }))
+			if err != nil {
+				t.Fatalf("failed to init checker: %v", err)
+			}
+			got, err := c.Check(test.email)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected Check() results (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewChecker_InvalidWindow(t *testing.T) {
+	start := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &Config{
+		Format: "v1",
+		Allowlist: []*AllowlistEntry{
+			&AllowlistEntry{Domain: "example.com", NotBefore: &start, NotAfter: &start},
+		},
+	}
+	if _, err := NewChecker(cfg); err == nil {
+		t.Fatal("NewChecker returned no error for an empty time window")
+	}
+}
+
+func TestExpiringWithin(t *testing.T) {
+	now := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	expired, soon, later := now.Add(-24*time.Hour), now.Add(3*24*time.Hour), now.Add(60*24*time.Hour)
+	cfg := &Config{
+		Format: "v1",
+		Allowlist: []*AllowlistEntry{
+			&AllowlistEntry{Domain: "forever.example.com"},
+			&AllowlistEntry{Domain: "later.example.com", NotAfter: &later},
+			&AllowlistEntry{Email: "soon@example.com", NotAfter: &soon},
+			&AllowlistEntry{Domain: "expired.example.com", NotAfter: &expired},
+		},
+	}
+	c, err := NewChecker(cfg, WithNow(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("failed to init checker: %v", err)
+	}
+
+	got := c.ExpiringWithin(7 * 24 * time.Hour)
+	want := []*AllowlistEntry{
+		&AllowlistEntry{Email: "soon@example.com", NotAfter: &soon},
+		&AllowlistEntry{Domain: "expired.example.com", NotAfter: &expired},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected ExpiringWithin() results (-want +got)\n%s", diff)
+	}
+}
+
+func TestCheckClaim(t *testing.T) {
+	cfg := &Config{
+		Format: "v1",
+		Allowlist: []*AllowlistEntry{
+			&AllowlistEntry{Claim: "groups", Value: "a7a4e4d1-opgee-users", Sites: []string{"OPGEE"}},
+			&AllowlistEntry{Claim: "extension_AccessLevel", Value: "Admin"},
+			&AllowlistEntry{Claim: "groups", Value: "partner-users", Provider: "partner-okta", Sites: []string{"PACTA"}},
+		},
+	}
+	c, err := NewChecker(cfg)
+	if err != nil {
+		t.Fatalf("failed to init checker: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"extension_AccessLevel", "groups"}, c.ClaimNames()); diff != "" {
+		t.Errorf("unexpected ClaimNames() results (-want +got)\n%s", diff)
+	}
+	if !c.HasUnscopedClaims() {
+		t.Error("HasUnscopedClaims() = false, want true")
+	}
+
+	tests := []struct {
+		desc     string
+		provider string
+		name     string
+		value    string
+		want     *Entity
+	}{
+		{
+			desc:  "group allowlisted for OPGEE",
+			name:  "groups",
+			value: "a7a4e4d1-opgee-users",
+			want:  &Entity{AllowedSites: []Site{SiteOPGEE}},
+		},
+		{
+			desc:  "extension attribute allowed on any site",
+			name:  "extension_AccessLevel",
+			value: "Admin",
+			want:  &Entity{AllowAllSites: true},
+		},
+		{
+			desc:  "values are case-sensitive",
+			name:  "extension_AccessLevel",
+			value: "admin",
+			want:  nil,
+		},
+		{
+			desc:  "value under a different claim",
+			name:  "roles",
+			value: "a7a4e4d1-opgee-users",
+			want:  nil,
+		},
+		{
+			desc:     "entry scoped to the provider",
+			provider: "partner-okta",
+			name:     "groups",
+			value:    "partner-users",
+			want:     &Entity{AllowedSites: []Site{SitePACTA}},
+		},
+		{
+			desc:     "entry scoped to another provider",
+			provider: "azure",
+			name:     "groups",
+			value:    "partner-users",
+			want:     nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			m, err := c.CheckClaim(test.provider, test.name, test.value)
+			if err != nil {
+				t.Fatalf("CheckClaim: %v", err)
+			}
+			var got *Entity
+			if m != nil {
+				got = m.Entity
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected CheckClaim() results (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHasUnscopedClaims(t *testing.T) {
+	cfg := &Config{
+		Format: "v1",
+		Allowlist: []*AllowlistEntry{
+			&AllowlistEntry{Domain: "example.com"},
+			&AllowlistEntry{Claim: "groups", Value: "partner-users", Provider: "partner-okta"},
+		},
+	}
+	c, err := NewChecker(cfg)
+	if err != nil {
+		t.Fatalf("failed to init checker: %v", err)
+	}
+	if c.HasUnscopedClaims() {
+		t.Error("HasUnscopedClaims() = true, want false when every claim entry has a provider")
+	}
+}
+
+func TestNewChecker_InvalidClaimEntry(t *testing.T) {
+	tests := []struct {
+		desc  string
+		entry *AllowlistEntry
+	}{
+		{
+			desc:  "claim without value",
+			entry: &AllowlistEntry{Claim: "groups"},
+		},
+		{
+			desc:  "value without claim",
+			entry: &AllowlistEntry{Domain: "example.com", Value: "abc"},
+		},
+		{
+			desc:  "claim with domain",
+			entry: &AllowlistEntry{Domain: "example.com", Claim: "groups", Value: "abc"},
+		},
+		{
+			desc:  "provider without claim",
+			entry: &AllowlistEntry{Domain: "example.com", Provider: "azure"},
+		},
+		{
+			desc:  "empty role",
+			entry: &AllowlistEntry{Domain: "example.com", Roles: []string{""}},
+		},
+		{
+			desc:  "role with a space",
+			entry: &AllowlistEntry{Domain: "example.com", Roles: []string{"project admin"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			cfg := &Config{Format: "v1", Allowlist: []*AllowlistEntry{test.entry}}
+			if _, err := NewChecker(cfg); err == nil {
+				t.Error("NewChecker returned no error for invalid entry")
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Package sqlallowlist implements an allowlist.Source backed by a SQL database
+// (SQLite or Postgres), which allows for managing access without deploying a
+// new allowlist file, and for multiple server replicas to share one allowlist.
+//
+// Lookups are served from an in-memory snapshot of the table, which is
+// reloaded periodically to pick up changes. Entries are validated with the
+// same rules as allowlist files, and invalid rows are logged and skipped, so
+// one bad row doesn't stop changes to every other row from being picked up. If
+// the table can't be read at all, the last snapshot is kept, see Status.
+//
+// Each row records who last changed it and when, but the table doesn't keep a
+// history of changes, which is left to the database (e.g. Postgres audit
+// triggers or logs).
+package sqlallowlist
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"go.uber.org/zap"
+)
+
+// Schema creates the table that entries are loaded from. Each row corresponds
+// to an allowlist.AllowlistEntry:
+//
+//   - Exactly one of domain, email, or claim (with claim_value) should be set
+//   - provider optionally limits a claim entry to tokens from that identity
+//     provider, see allowlist.AllowlistEntry.Provider
+//   - sites is a comma-separated list of sites, where NULL or empty means all sites
+//   - roles is a comma-separated list of roles the entry grants, see
+//     allowlist.AllowlistEntry.Roles
+//   - not_before and not_after are optional, and should be in UTC
+//   - changed_by and changed_at record who last changed the row and when, for
+//     auditing, and don't affect access
+//
+// The server applies it with --allowlist_db_create_schema. The schema is
+// compatible with both SQLite and Postgres.
+const Schema = `CREATE TABLE IF NOT EXISTS allowlist_entries (
+	domain      TEXT,
+	email       TEXT,
+	claim       TEXT,
+	claim_value TEXT,
+	provider    TEXT,
+	sites       TEXT,
+	roles       TEXT,
+	not_before  TIMESTAMP,
+	not_after   TIMESTAMP,
+	changed_by  TEXT,
+	changed_at  TIMESTAMP
+)`
+
+const selectEntries = `SELECT domain, email, claim, claim_value, provider, sites, roles, not_before, not_after, changed_by FROM allowlist_entries`
+
+type Config struct {
+	DB     *sql.DB
+	Logger *zap.Logger
+
+	// PollInterval is how often to reload the allowlist from the database,
+	// defaults to one minute.
+	PollInterval time.Duration
+
+	// Now overrides the clock used to evaluate time-bounded entries and record
+	// reloads, defaults to time.Now.
+	Now func() time.Time
+}
+
+func (c *Config) validate() error {
+	if c.DB == nil {
+		return errors.New("no *sql.DB was provided")
+	}
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+	if c.PollInterval < 0 {
+		return fmt.Errorf("poll interval must be non-negative, was %s", c.PollInterval)
+	}
+	return nil
+}
+
+// Status describes how up-to-date a Source's snapshot of the table is.
+type Status struct {
+	// LastSuccess is when the snapshot was last replaced.
+	LastSuccess time.Time
+	// SkippedRows is the number of invalid rows left out of the snapshot.
+	SkippedRows int
+	// LastError is the error from the most recent reload, or nil if it
+	// succeeded. While it's set, the snapshot from LastSuccess is served.
+	LastError error
+}
+
+type Source struct {
+	db     *sql.DB
+	logger *zap.Logger
+	opts   []allowlist.Option
+	now    func() time.Time
+
+	mu      sync.RWMutex
+	checker *allowlist.Checker
+	status  Status
+}
+
+var _ allowlist.Source = (*Source)(nil)
+
+// New loads the allowlist from the database, and then reloads it every
+// PollInterval until the context is cancelled.
+func New(ctx context.Context, cfg *Config) (*Source, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	s := &Source{
+		db:     cfg.DB,
+		logger: cfg.Logger,
+		now:    time.Now,
+	}
+	if cfg.Now != nil {
+		s.opts = append(s.opts, allowlist.WithNow(cfg.Now))
+		s.now = cfg.Now
+	}
+	if err := s.Reload(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load initial allowlist: %w", err)
+	}
+
+	interval := cfg.PollInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	go s.poll(ctx, interval)
+
+	return s, nil
+}
+
+func (s *Source) poll(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.Reload(ctx); err != nil {
+				// We keep serving the last snapshot.
+				s.logger.Error("failed to reload allowlist from database", zap.Error(err), zap.Time("last_success", s.Status().LastSuccess))
+			}
+		}
+	}
+}
+
+// Reload reads all entries from the database and replaces the current
+// snapshot with the valid ones. Invalid rows are logged and skipped. If the
+// table can't be read, the current snapshot is kept and an error is returned.
+func (s *Source) Reload(ctx context.Context) error {
+	cfg, skipped, err := s.loadConfig(ctx)
+	if err == nil {
+		var checker *allowlist.Checker
+		if checker, err = allowlist.NewChecker(cfg, s.opts...); err == nil {
+			s.mu.Lock()
+			s.checker = checker
+			s.status = Status{LastSuccess: s.now(), SkippedRows: skipped}
+			s.mu.Unlock()
+
+			s.logger.Debug("loaded allowlist from database", zap.Int("entries", len(cfg.Allowlist)), zap.Int("skipped", skipped))
+			return nil
+		}
+		err = fmt.Errorf("allowlist in database was invalid: %w", err)
+	}
+
+	s.mu.Lock()
+	s.status.LastError = err
+	s.mu.Unlock()
+	return err
+}
+
+// Status returns when the snapshot was last replaced, and the error from the
+// most recent reload, if any.
+func (s *Source) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// loadConfig reads the entries from the database, and returns the valid ones
+// along with the number of rows that were skipped.
+func (s *Source) loadConfig(ctx context.Context) (*allowlist.Config, int, error) {
+	rows, err := s.db.QueryContext(ctx, selectEntries)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query allowlist entries: %w", err)
+	}
+	defer rows.Close()
+
+	cfg := &allowlist.Config{Format: "v1"}
+	skipped := 0
+	for i := 0; rows.Next(); i++ {
+		var (
+			domain, email, claim, value, provider, sites, roles, changedBy sql.NullString
+			notBefore, notAfter                                            sql.NullTime
+		)
+		if err := rows.Scan(&domain, &email, &claim, &value, &provider, &sites, &roles, &notBefore, &notAfter, &changedBy); err != nil {
+			s.logger.Warn("skipping unreadable allowlist entry", zap.Int("row", i), zap.Error(err))
+			skipped++
+			continue
+		}
+		ae := &allowlist.AllowlistEntry{
+			Domain:   domain.String,
+			Email:    email.String,
+			Claim:    claim.String,
+			Value:    value.String,
+			Provider: provider.String,
+			Sites:    splitList(sites.String),
+			Roles:    splitList(roles.String),
+		}
+		if notBefore.Valid {
+			ae.NotBefore = &notBefore.Time
+		}
+		if notAfter.Valid {
+			ae.NotAfter = &notAfter.Time
+		}
+		// Entries are validated independently of each other, so we can check
+		// each row on its own.
+		if _, err := allowlist.NewChecker(&allowlist.Config{Format: "v1", Allowlist: []*allowlist.AllowlistEntry{ae}}); err != nil {
+			s.logger.Warn("skipping invalid allowlist entry",
+				zap.Int("row", i),
+				zap.String("domain", ae.Domain),
+				zap.String("email", ae.Email),
+				zap.String("claim", ae.Claim),
+				zap.String("claim_value", ae.Value),
+				zap.String("changed_by", changedBy.String),
+				zap.Error(err))
+			skipped++
+			continue
+		}
+		cfg.Allowlist = append(cfg.Allowlist, ae)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read allowlist entries: %w", err)
+	}
+	return cfg, skipped, nil
+}
+
+// splitList splits a comma-separated column value, where empty means no
+// values.
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		out = append(out, strings.TrimSpace(s))
+	}
+	return out
+}
+
+func (s *Source) current() *allowlist.Checker {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checker
+}
+
+func (s *Source) Check(email string) (*allowlist.Entity, error) {
+	return s.current().Check(email)
+}
+
+func (s *Source) ClaimNames() []string {
+	return s.current().ClaimNames()
+}
+
+func (s *Source) CheckClaim(provider, name, value string) (*allowlist.Match, error) {
+	return s.current().CheckClaim(provider, name, value)
+}
+
+func (s *Source) HasUnscopedClaims() bool {
+	return s.current().HasUnscopedClaims()
+}
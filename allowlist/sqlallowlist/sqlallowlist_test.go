@@ -0,0 +1,190 @@
+package sqlallowlist
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap/zaptest"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := setupDB(t)
+	now := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	mustExec(t, db, `INSERT INTO allowlist_entries (domain, sites) VALUES ('example.com', 'OPGEE, PACTA')`)
+	mustExec(t, db, `INSERT INTO allowlist_entries (email, roles) VALUES ('admin@example.com', 'admin, auditor')`)
+	mustExec(t, db, `INSERT INTO allowlist_entries (email, not_after) VALUES ('expired@example.net', ?)`, now.Add(-time.Hour))
+	mustExec(t, db, `INSERT INTO allowlist_entries (claim, claim_value, sites) VALUES ('groups', 'opgee-users', 'OPGEE')`)
+	mustExec(t, db, `INSERT INTO allowlist_entries (claim, claim_value, provider, sites) VALUES ('groups', 'partner-users', 'partner-okta', 'PACTA')`)
+
+	src, err := New(ctx, &Config{
+		DB:     db,
+		Logger: zaptest.NewLogger(t),
+		// We reload manually in this test
+		PollInterval: time.Hour,
+		Now:          func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	checkEmail(t, src, "user@example.com", &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SiteOPGEE, allowlist.SitePACTA}})
+	checkEmail(t, src, "admin@example.com", &allowlist.Entity{AllowAllSites: true, Roles: []string{"admin", "auditor"}})
+	checkEmail(t, src, "expired@example.net", nil)
+	checkEmail(t, src, "new@example.org", nil)
+
+	if diff := cmp.Diff([]string{"groups"}, src.ClaimNames()); diff != "" {
+		t.Errorf("unexpected claim names (-want +got)\n%s", diff)
+	}
+	checkClaim(t, src, "azure", "opgee-users", &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SiteOPGEE}})
+	checkClaim(t, src, "partner-okta", "partner-users", &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}})
+	checkClaim(t, src, "azure", "partner-users", nil)
+	if !src.HasUnscopedClaims() {
+		t.Error("HasUnscopedClaims() = false, want true")
+	}
+
+	// Now, add an entry, and make sure it gets picked up.
+	mustExec(t, db, `INSERT INTO allowlist_entries (domain) VALUES ('example.org')`)
+	checkEmail(t, src, "new@example.org", nil)
+	if err := src.Reload(ctx); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	checkEmail(t, src, "new@example.org", &allowlist.Entity{AllowAllSites: true})
+}
+
+func TestReload_SkipsInvalidRows(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := setupDB(t)
+	now := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	mustExec(t, db, `INSERT INTO allowlist_entries (domain) VALUES ('example.com')`)
+
+	src, err := New(ctx, &Config{
+		DB:           db,
+		Logger:       zaptest.NewLogger(t),
+		PollInterval: time.Hour,
+		Now:          func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// One bad row doesn't stop the other changes from being picked up.
+	now = now.Add(time.Minute)
+	mustExec(t, db, `INSERT INTO allowlist_entries (domain, sites, changed_by, changed_at) VALUES ('example.org', 'NOT-A-SITE', 'admin@example.com', ?)`, now)
+	mustExec(t, db, `INSERT INTO allowlist_entries (email, changed_by, changed_at) VALUES ('user@example.net', 'admin@example.com', ?)`, now)
+	if err := src.Reload(ctx); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	checkEmail(t, src, "user@example.com", &allowlist.Entity{AllowAllSites: true})
+	checkEmail(t, src, "user@example.org", nil)
+	checkEmail(t, src, "user@example.net", &allowlist.Entity{AllowAllSites: true})
+	checkStatus(t, src, Status{LastSuccess: now, SkippedRows: 1})
+}
+
+func TestReload_UnreadableKeepsSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := setupDB(t)
+	now := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	mustExec(t, db, `INSERT INTO allowlist_entries (domain) VALUES ('example.com')`)
+
+	src, err := New(ctx, &Config{
+		DB:           db,
+		Logger:       zaptest.NewLogger(t),
+		PollInterval: time.Hour,
+		Now:          func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	checkStatus(t, src, Status{LastSuccess: now})
+
+	loaded := now
+	now = now.Add(time.Minute)
+	mustExec(t, db, `DROP TABLE allowlist_entries`)
+	if err := src.Reload(ctx); err == nil {
+		t.Fatal("Reload returned no error for a missing table")
+	}
+	checkEmail(t, src, "user@example.com", &allowlist.Entity{AllowAllSites: true})
+	st := src.Status()
+	if st.LastError == nil {
+		t.Error("Status().LastError was nil after a failed reload")
+	}
+	if !st.LastSuccess.Equal(loaded) {
+		t.Errorf("Status().LastSuccess = %s, want %s", st.LastSuccess, loaded)
+	}
+
+	// Once the table is back, the error is cleared.
+	now = now.Add(time.Minute)
+	mustExec(t, db, Schema)
+	if err := src.Reload(ctx); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	checkStatus(t, src, Status{LastSuccess: now})
+}
+
+func setupDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "allowlist.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mustExec(t, db, Schema)
+	return db
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...any) {
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("failed to exec %q: %v", query, err)
+	}
+}
+
+func checkEmail(t *testing.T, src *Source, email string, want *allowlist.Entity) {
+	t.Helper()
+	got, err := src.Check(email)
+	if err != nil {
+		t.Fatalf("Check(%q): %v", email, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected Check(%q) results (-want +got)\n%s", email, diff)
+	}
+}
+
+func checkClaim(t *testing.T, src *Source, provider, value string, want *allowlist.Entity) {
+	t.Helper()
+	m, err := src.CheckClaim(provider, "groups", value)
+	if err != nil {
+		t.Fatalf("CheckClaim(%q, %q): %v", provider, value, err)
+	}
+	var got *allowlist.Entity
+	if m != nil {
+		got = m.Entity
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected CheckClaim(%q, %q) results (-want +got)\n%s", provider, value, diff)
+	}
+}
+
+func checkStatus(t *testing.T, src *Source, want Status) {
+	t.Helper()
+	got := src.Status()
+	if got.LastError != nil {
+		t.Errorf("Status().LastError = %v, want nil", got.LastError)
+	}
+	got.LastError = nil
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected Status() (-want +got)\n%s", diff)
+	}
+}
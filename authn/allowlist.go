@@ -0,0 +1,176 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"go.uber.org/zap"
+)
+
+// ErrNotAllowlisted is returned when none of the emails or claims of an
+// identity are allowlisted.
+var ErrNotAllowlisted = errors.New("email isn't allowlisted")
+
+// checkAllowlist checks the emails and any allowlisted claims (e.g. 'groups'
+// or 'roles') of the identity against the provider's allowlist, and returns
+// the emails to associate with the user, along with the combined entity
+// they're allowed to act as. Emails that aren't verified (see trustedEmails)
+// are dropped before the allowlist is checked.
+func checkAllowlist(reg *registered, id *Identity, logger *zap.Logger) ([]string, *allowlist.Entity, error) {
+	var eb entityBuilder
+	src := reg.allowlist
+
+	// If one of their emails is allowed, consider them allowed.
+	emails, untrusted := trustedEmails(id, reg.requireVerifiedEmails, logger)
+	allowed := allowedEmails(src, emails, &eb, logger)
+
+	// Check any claims that the allowlist grants access based on.
+	claimMatched := checkClaims(reg, id, &eb, logger)
+
+	if len(allowed) == 0 && !claimMatched {
+		// Let whoever is debugging the denial know that the user would have
+		// been allowed, if only their provider had verified their email.
+		if len(allowedEmails(src, untrusted, &entityBuilder{}, logger)) > 0 {
+			return nil, nil, errEmailUnverified
+		}
+		return nil, nil, ErrNotAllowlisted
+	}
+
+	// If the user only got access via directory claims, we still associate
+	// them with the (verified) emails their identity provider asserted.
+	if len(allowed) == 0 {
+		allowed = emails
+	}
+
+	return allowed, eb.entity(), nil
+}
+
+func allowedEmails(src allowlist.Source, emails []string, eb *entityBuilder, logger *zap.Logger) []string {
+	var outEmails []string
+	for _, email := range emails {
+		entity, err := src.Check(email)
+		if err != nil {
+			logger.Warn("failed to check allowlist", zap.String("email", email), zap.Error(err))
+			continue
+		}
+		if entity == nil {
+			continue
+		}
+		eb.add(entity)
+		outEmails = append(outEmails, email)
+	}
+	return outEmails
+}
+
+func checkClaims(reg *registered, id *Identity, eb *entityBuilder, logger *zap.Logger) bool {
+	src := reg.allowlist
+	matched := false
+	for _, name := range src.ClaimNames() {
+		values, err := claimValues(id, name)
+		if err != nil {
+			logger.Warn("failed to load claim for allowlist check", zap.String("claim", name), zap.Error(err))
+			continue
+		}
+		for _, v := range values {
+			m, err := src.CheckClaim(reg.name, name, v)
+			if err != nil {
+				logger.Warn("failed to check allowlist", zap.String("claim", name), zap.String("value", v), zap.Error(err))
+				continue
+			}
+			if m == nil {
+				continue
+			}
+			// Register rejects shared allowlists with unscoped claim entries, but
+			// database allowlists can gain them after startup.
+			if reg.sharedAllowlist && m.Entry.Provider == "" {
+				logger.Warn("ignoring claim entry that isn't scoped to a provider, since the allowlist is shared by several providers", zap.String("claim", name), zap.String("value", v))
+				continue
+			}
+			eb.add(m.Entity)
+			matched = true
+		}
+	}
+	return matched
+}
+
+// claimValues returns the values of the named claim for the identity. The
+// 'groups' claim comes from the provider's normalized groups, since providers
+// don't agree on where to put them.
+func claimValues(id *Identity, name string) ([]string, error) {
+	if name == "groups" {
+		return id.Groups, nil
+	}
+	if id.Token == nil {
+		return nil, nil
+	}
+	val, ok := id.Token.Get(name)
+	if !ok {
+		return nil, nil
+	}
+	return StringsFromClaim(val)
+}
+
+// StringsFromClaim handles claims that can be either a single string or a list
+// of strings, like 'groups', 'roles', or custom extension attributes.
+func StringsFromClaim(v any) ([]string, error) {
+	switch vt := v.(type) {
+	case string:
+		return []string{vt}, nil
+	case []string:
+		return vt, nil
+	case []any:
+		var out []string
+		for i, vi := range vt {
+			s, ok := vi.(string)
+			if !ok {
+				return nil, fmt.Errorf("value %d in claim had unexpected type %T", i, vi)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("claim had unexpected type %T", v)
+	}
+}
+
+// entityBuilder combines the entities from several allowlist matches into one.
+type entityBuilder struct {
+	allowAllSites bool
+	sites         []allowlist.Site
+	roles         map[string]bool
+	notAfter      time.Time
+}
+
+func (eb *entityBuilder) add(entity *allowlist.Entity) {
+	if entity.AllowAllSites {
+		eb.allowAllSites = true
+	}
+	eb.sites = append(eb.sites, entity.AllowedSites...)
+	// Users get the roles of every entry that matched them.
+	for _, r := range entity.Roles {
+		if eb.roles == nil {
+			eb.roles = make(map[string]bool)
+		}
+		eb.roles[r] = true
+	}
+	// We use the earliest expiration of any matching entry, so that no site
+	// access outlives the entry that granted it.
+	if !entity.NotAfter.IsZero() && (eb.notAfter.IsZero() || entity.NotAfter.Before(eb.notAfter)) {
+		eb.notAfter = entity.NotAfter
+	}
+}
+
+func (eb *entityBuilder) entity() *allowlist.Entity {
+	var roles []string
+	for r := range eb.roles {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+	if eb.allowAllSites {
+		return &allowlist.Entity{AllowAllSites: true, Roles: roles, NotAfter: eb.notAfter}
+	}
+	return &allowlist.Entity{AllowedSites: eb.sites, Roles: roles, NotAfter: eb.notAfter}
+}
@@ -0,0 +1,218 @@
+package authn
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+const testAllowlist = `{
+  "format": "v1",
+  "allowlist": [
+    {"domain": "example.com", "sites": ["PACTA"], "roles": ["viewer"]},
+    {"claim": "groups", "value": "opgee-users", "provider": "okta", "sites": ["OPGEE"], "roles": ["editor", "viewer"]},
+    {"claim": "extension_AccessLevel", "value": "Admin", "provider": "azure"}
+  ]
+}`
+
+func TestCheckAllowlist(t *testing.T) {
+	al := loadAllowlist(t, testAllowlist)
+
+	tests := []struct {
+		desc string
+		// provider is the name of the provider that authenticated the user,
+		// defaults to 'okta'.
+		provider        string
+		id              *Identity
+		requireVerified bool
+		wantEmails      []string
+		want            *allowlist.Entity
+	}{
+		{
+			desc: "allowed by email domain",
+			id: &Identity{
+				Emails: []string{"user@example.com", "other@example.net"},
+			},
+			wantEmails: []string{"user@example.com"},
+			want:       &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}, Roles: []string{"viewer"}},
+		},
+		{
+			desc: "allowed by group",
+			id: &Identity{
+				Emails: []string{"user@example.net"},
+				Groups: []string{"unrelated", "opgee-users"},
+			},
+			wantEmails: []string{"user@example.net"},
+			want:       &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SiteOPGEE}, Roles: []string{"editor", "viewer"}},
+		},
+		{
+			desc:     "allowed by string extension attribute",
+			provider: "azure",
+			id: &Identity{
+				Emails: []string{"user@example.net"},
+				Token: tokenWithClaims(t, map[string]any{
+					"extension_AccessLevel": "Admin",
+				}),
+			},
+			wantEmails: []string{"user@example.net"},
+			want:       &allowlist.Entity{AllowAllSites: true},
+		},
+		{
+			desc: "email and group combined",
+			id: &Identity{
+				Emails: []string{"user@example.com"},
+				Groups: []string{"opgee-users"},
+			},
+			wantEmails: []string{"user@example.com"},
+			want:       &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA, allowlist.SiteOPGEE}, Roles: []string{"editor", "viewer"}},
+		},
+		{
+			desc: "unverified email dropped, allowed by group",
+			id: &Identity{
+				Emails:            []string{"user@example.com"},
+				EmailVerification: map[string]EmailVerification{"user@example.com": EmailUnverified},
+				Groups:            []string{"opgee-users"},
+			},
+			want: &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SiteOPGEE}, Roles: []string{"editor", "viewer"}},
+		},
+		{
+			desc: "verified email required",
+			id: &Identity{
+				Emails:            []string{"Other@Example.com", "user@example.com"},
+				EmailVerification: map[string]EmailVerification{"other@example.com": EmailVerified},
+			},
+			requireVerified: true,
+			wantEmails:      []string{"Other@Example.com"},
+			want:            &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}, Roles: []string{"viewer"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			provider := test.provider
+			if provider == "" {
+				provider = "okta"
+			}
+			reg := &registered{name: provider, allowlist: al, sharedAllowlist: true, requireVerifiedEmails: test.requireVerified}
+			gotEmails, got, err := checkAllowlist(reg, test.id, zaptest.NewLogger(t))
+			if err != nil {
+				t.Fatalf("checkAllowlist: %v", err)
+			}
+			if diff := cmp.Diff(test.wantEmails, gotEmails); diff != "" {
+				t.Errorf("unexpected emails (-want +got)\n%s", diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected entity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckAllowlist_NotAllowlisted(t *testing.T) {
+	tests := []struct {
+		desc            string
+		provider        string
+		id              *Identity
+		requireVerified bool
+		want            error
+	}{
+		{
+			desc:     "group claim from another provider",
+			provider: "azure",
+			id: &Identity{
+				Emails: []string{"user@example.net"},
+				Groups: []string{"opgee-users"},
+			},
+			want: ErrNotAllowlisted,
+		},
+		{
+			desc: "no matches",
+			id: &Identity{
+				Emails: []string{"user@example.net"},
+				Groups: []string{"some-other-group"},
+				Token: tokenWithClaims(t, map[string]any{
+					// Only the provider's normalized groups count for 'groups' entries.
+					"groups": []any{"opgee-users"},
+				}),
+			},
+			want: ErrNotAllowlisted,
+		},
+		{
+			desc: "unverified email",
+			id: &Identity{
+				Emails:            []string{"user@example.com"},
+				EmailVerification: map[string]EmailVerification{"user@example.com": EmailUnverified},
+			},
+			want: errEmailUnverified,
+		},
+		{
+			desc: "verification unknown, but required",
+			id: &Identity{
+				Emails: []string{"user@example.com"},
+			},
+			requireVerified: true,
+			want:            errEmailUnverified,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			provider := test.provider
+			if provider == "" {
+				provider = "okta"
+			}
+			reg := &registered{name: provider, allowlist: loadAllowlist(t, testAllowlist), sharedAllowlist: true, requireVerifiedEmails: test.requireVerified}
+			if _, _, err := checkAllowlist(reg, test.id, zaptest.NewLogger(t)); err != test.want {
+				t.Errorf("checkAllowlist returned error %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckAllowlist_UnscopedClaims(t *testing.T) {
+	al := loadAllowlist(t, `{
+  "format": "v1",
+  "allowlist": [{"claim": "groups", "value": "opgee-users", "sites": ["OPGEE"]}]
+}`)
+	id := &Identity{Emails: []string{"user@example.net"}, Groups: []string{"opgee-users"}}
+
+	// Unscoped claim entries apply to a provider with its own allowlist...
+	reg := &registered{name: "partner-okta", allowlist: al}
+	if _, _, err := checkAllowlist(reg, id, zaptest.NewLogger(t)); err != nil {
+		t.Errorf("checkAllowlist with an unshared allowlist: %v", err)
+	}
+
+	// ...but not to providers sharing one, e.g. if a database allowlist gained
+	// an unscoped entry after the providers were registered.
+	reg.sharedAllowlist = true
+	if _, _, err := checkAllowlist(reg, id, zaptest.NewLogger(t)); err != ErrNotAllowlisted {
+		t.Errorf("checkAllowlist with a shared allowlist returned error %v, want %v", err, ErrNotAllowlisted)
+	}
+}
+
+func tokenWithClaims(t *testing.T, claims map[string]any) jwt.Token {
+	tkn := jwt.New()
+	for k, v := range claims {
+		if err := tkn.Set(k, v); err != nil {
+			t.Fatalf("failed to set claim %q: %v", k, err)
+		}
+	}
+	return tkn
+}
+
+func loadAllowlist(t *testing.T, dat string) *allowlist.Checker {
+	fn := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := os.WriteFile(fn, []byte(dat), 0600); err != nil {
+		t.Fatalf("failed to write allowlist: %v", err)
+	}
+	c, err := allowlist.NewCheckerFromConfigFile(fn)
+	if err != nil {
+		t.Fatalf("failed to load allowlist: %v", err)
+	}
+	return c
+}
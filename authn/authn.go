@@ -0,0 +1,294 @@
+// Package authn authenticates users with source tokens from one or more
+// identity providers (Azure AD B2C, OIDC providers, local JWTs), checks them
+// against an allowlist, and records who they are in the request context.
+//
+// Providers only verify tokens and normalize them into an Identity, the
+// checks that apply to every provider live in Registry.Middleware.
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/tokenctx"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+)
+
+// Identity is a user authenticated by an identity provider.
+type Identity struct {
+	// Subject is the provider's ID for the user, the 'sub' claim.
+	Subject string
+	// Emails are the email addresses the provider asserted for the user.
+	Emails []string
+	// EmailVerification is whether the provider verified each of Emails, keyed
+	// by the lowercased address. Addresses that are missing are
+	// EmailVerificationUnknown.
+	EmailVerification map[string]EmailVerification
+	// Groups are the directory groups the user belongs to, if the provider
+	// includes them. Allowlist entries for the 'groups' claim are checked
+	// against these.
+	Groups []string
+	// Policy is the user flow or custom policy the user authenticated with, for
+	// providers that have them, like Azure AD B2C.
+	Policy string
+
+	// Token is the verified source token, which allowlist entries for other
+	// claims are checked against.
+	Token jwt.Token
+}
+
+// Provider is an identity provider, like *azjwt.Auth, *oidc.Auth or
+// *localjwt.Auth.
+type Provider interface {
+	// Issuer returns the 'iss' claim of tokens from this provider.
+	Issuer() string
+	// Authenticate parses and fully verifies the given source token, and
+	// returns the identity it belongs to.
+	Authenticate(ctx context.Context, tkn string) (*Identity, error)
+}
+
+// MultiIssuer is implemented by providers that accept tokens from several
+// issuers, like an Entra ID app that users from multiple tenants sign in to.
+// The registry routes tokens from any of the Issuers to the provider, instead
+// of just the one returned by Issuer.
+type MultiIssuer interface {
+	Issuers() []string
+}
+
+type registered struct {
+	name      string
+	provider  Provider
+	allowlist allowlist.Source
+	// sharedAllowlist is true if other providers are registered with the same
+	// allowlist, in which case only claim entries scoped to this provider
+	// apply to its tokens.
+	sharedAllowlist bool
+
+	requireVerifiedEmails bool
+}
+
+// ProviderOption configures how a registered provider's users are checked.
+type ProviderOption func(*registered)
+
+// RequireVerifiedEmails only checks emails against the allowlist if the
+// provider says it verified them. By default, emails are checked unless the
+// provider says they're unverified, since some providers (like Azure AD B2C
+// user flows) only issue tokens for verified emails, and don't say so.
+func RequireVerifiedEmails() ProviderOption {
+	return func(r *registered) {
+		r.requireVerifiedEmails = true
+	}
+}
+
+// Registry holds the identity providers that the service accepts tokens from.
+type Registry struct {
+	logger   *zap.Logger
+	byIssuer map[string]*registered
+	names    map[string]bool
+
+	now          func() time.Time
+	requireNonce bool
+	maxAuthAge   time.Duration
+	replay       ReplayStore
+}
+
+type RegistryOption func(*Registry)
+
+// WithNow overrides the clock used to check 'auth_time' claims and to pick an
+// expiry for replayed tokens without an 'exp' claim, which defaults to
+// time.Now.
+func WithNow(now func() time.Time) RegistryOption {
+	return func(r *Registry) {
+		r.now = now
+	}
+}
+
+// WithRequiredNonce rejects requests that don't include a NonceHeader. By
+// default, the nonce is only checked when the client sends one.
+func WithRequiredNonce() RegistryOption {
+	return func(r *Registry) {
+		r.requireNonce = true
+	}
+}
+
+// WithMaxAuthAge rejects source tokens whose 'auth_time' claim, the time the
+// user actually authenticated with the provider, is older than the given age.
+// Tokens without an 'auth_time' claim are rejected too.
+func WithMaxAuthAge(age time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.maxAuthAge = age
+	}
+}
+
+// WithReplayProtection only allows each source token to be exchanged once.
+// Exchanged tokens are recorded in the store until they expire, so the
+// protection only applies across the server instances sharing the store.
+func WithReplayProtection(store ReplayStore) RegistryOption {
+	return func(r *Registry) {
+		r.replay = store
+	}
+}
+
+func NewRegistry(logger *zap.Logger, opts ...RegistryOption) *Registry {
+	r := &Registry{
+		logger:   logger,
+		byIssuer: make(map[string]*registered),
+		names:    make(map[string]bool),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register adds a provider to the registry, whose users are checked against
+// the given allowlist. The name identifies the provider in logs and issued
+// tokens, and must be unique, as must the provider's issuer(s). If other
+// providers use the same allowlist, its claim entries must each be scoped to a
+// provider, since otherwise one provider's admins could grant access by
+// putting the right claim in their own tokens.
+func (r *Registry) Register(name string, p Provider, al allowlist.Source, opts ...ProviderOption) error {
+	if name == "" {
+		return errors.New("no provider name was given")
+	}
+	if al == nil {
+		return fmt.Errorf("no allowlist was given for provider %q", name)
+	}
+	if r.names[name] {
+		return fmt.Errorf("a provider named %q was already registered", name)
+	}
+	issuers := []string{p.Issuer()}
+	if mi, ok := p.(MultiIssuer); ok {
+		issuers = mi.Issuers()
+	}
+	if len(issuers) == 0 {
+		return fmt.Errorf("provider %q has no issuers", name)
+	}
+	for _, iss := range issuers {
+		if existing, ok := r.byIssuer[iss]; ok {
+			return fmt.Errorf("provider %q has the same issuer %q as provider %q", name, iss, existing.name)
+		}
+	}
+	var sharedWith []*registered
+	for _, existing := range r.byIssuer {
+		if existing.allowlist == al {
+			sharedWith = append(sharedWith, existing)
+		}
+	}
+	if len(sharedWith) > 0 && al.HasUnscopedClaims() {
+		return fmt.Errorf("provider %q shares its allowlist with provider %q, so every claim entry in it must set a 'provider'", name, sharedWith[0].name)
+	}
+	for _, existing := range sharedWith {
+		existing.sharedAllowlist = true
+	}
+	r.names[name] = true
+	reg := &registered{name: name, provider: p, allowlist: al, sharedAllowlist: len(sharedWith) > 0}
+	for _, opt := range opts {
+		opt(reg)
+	}
+	for _, iss := range issuers {
+		r.byIssuer[iss] = reg
+	}
+	return nil
+}
+
+// Middleware authenticates each request with the provider that issued its
+// token, checks the user against that provider's allowlist, and populates the
+// request context with the source token (see jwtauth.FromContext) and the
+// user's emails, allowlist entity, provider, and policy (see tokenctx).
+//
+// The issuer is read from the token before it has been verified, which is
+// fine because the selected provider then verifies the token in full,
+// including the issuer. Depending on the RegistryOptions, the token's nonce,
+// age, and reuse are checked too, see freshness.go.
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	hfn := func(w http.ResponseWriter, req *http.Request) {
+		// Skip auth verification if they're logging out.
+		if req.URL.Path == "/logout/cookie" && req.Method == http.MethodPost {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		ctx, err := r.authenticate(req)
+		if err != nil {
+			r.logger.Warn("failed to authenticate request", zap.String("reason", denialReason(err)), zap.Error(err))
+			if errors.Is(err, ErrNotAllowlisted) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			} else {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			}
+			return
+		}
+
+		// Token is authenticated, pass it through
+		next.ServeHTTP(w, req.WithContext(ctx))
+	}
+	return http.HandlerFunc(hfn)
+}
+
+func (r *Registry) authenticate(req *http.Request) (context.Context, error) {
+	// We only accept the token in the header, as opposed to actual end-user APIs,
+	// which will accept the token in the header ('Authorization: BEARER <tkn>') or in
+	// a cookie ('jwt=<tkn> ...')
+	tknStr := jwtauth.TokenFromHeader(req)
+	if tknStr == "" {
+		return nil, jwtauth.ErrNoTokenFound
+	}
+	return r.AuthenticateToken(req.Context(), tknStr, req.Header.Get(NonceHeader))
+}
+
+// AuthenticateToken runs the same checks as Middleware on a source token that
+// didn't come from a request header, like one the service got from the
+// provider itself in a server-side login. The nonce is the one the client
+// included in its authentication request, if any, which the token's 'nonce'
+// claim must match. Errors from the allowlist check wrap ErrNotAllowlisted.
+func (r *Registry) AuthenticateToken(ctx context.Context, tknStr, nonce string) (context.Context, error) {
+	unverified, err := jwt.ParseInsecure([]byte(tknStr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	reg, ok := r.byIssuer[unverified.Issuer()]
+	if !ok {
+		return nil, fmt.Errorf("token had unknown issuer %q", unverified.Issuer())
+	}
+
+	id, err := reg.provider.Authenticate(ctx, tknStr)
+	if err != nil {
+		return nil, fmt.Errorf("provider %q failed to authenticate token: %w", reg.name, err)
+	}
+
+	if err := r.checkFreshness(nonce, id); err != nil {
+		return nil, fmt.Errorf("provider %q token failed freshness check: %w", reg.name, err)
+	}
+
+	// Now, check against the allowlist
+	emails, entity, err := checkAllowlist(reg, id, r.logger.With(zap.String("provider", reg.name)))
+	if err != nil {
+		return nil, fmt.Errorf("provider %q token failed allowlist check: %w", reg.name, err)
+	}
+
+	// Only mark the token as used once it has passed every other check, so
+	// that e.g. a transient allowlist error doesn't burn the user's token.
+	if r.replay != nil {
+		if err := r.markUsed(ctx, reg.name, tknStr, id.Token); err != nil {
+			return nil, fmt.Errorf("provider %q token was rejected: %w", reg.name, err)
+		}
+	}
+
+	ctx = jwtauth.NewContext(ctx, id.Token, nil)
+	// Add the email to the context so that it can be used by the handler
+	ctx = tokenctx.AddEmailsToContext(ctx, emails)
+	ctx = tokenctx.AddAllowlistEntityToContext(ctx, entity)
+	ctx = tokenctx.AddProviderToContext(ctx, reg.name)
+	if id.Policy != "" {
+		ctx = tokenctx.AddPolicyToContext(ctx, id.Policy)
+	}
+	return ctx, nil
+}
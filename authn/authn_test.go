@@ -0,0 +1,265 @@
+package authn
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/tokenctx"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := NewRegistry(zaptest.NewLogger(t))
+	al := loadAllowlist(t, testAllowlist)
+	if err := r.Register("azure", &fakeProvider{iss: "https://azure.example.com"}, al); err != nil {
+		t.Fatalf("failed to register azure: %v", err)
+	}
+	if err := r.Register("okta", &fakeProvider{iss: "https://okta.example.com"}, al); err != nil {
+		t.Fatalf("failed to register okta: %v", err)
+	}
+
+	tests := []struct {
+		desc         string
+		path         string
+		claims       map[string]any
+		wantStatus   int
+		wantProvider string
+		wantEmails   []string
+		wantEntity   *allowlist.Entity
+	}{
+		{
+			desc:         "first provider",
+			claims:       map[string]any{"iss": "https://azure.example.com", "sub": "user1", "email": "user@example.com"},
+			wantStatus:   http.StatusOK,
+			wantProvider: "azure",
+			wantEmails:   []string{"user@example.com"},
+			wantEntity:   &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}, Roles: []string{"viewer"}},
+		},
+		{
+			desc:         "second provider, allowed by group",
+			claims:       map[string]any{"iss": "https://okta.example.com", "sub": "user1", "email": "user@example.net", "groups": "opgee-users"},
+			wantStatus:   http.StatusOK,
+			wantProvider: "okta",
+			wantEmails:   []string{"user@example.net"},
+			wantEntity:   &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SiteOPGEE}, Roles: []string{"editor", "viewer"}},
+		},
+		{
+			desc:       "group from another provider",
+			claims:     map[string]any{"iss": "https://azure.example.com", "sub": "user1", "email": "user@example.net", "groups": "opgee-users"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			desc:       "unknown issuer",
+			claims:     map[string]any{"iss": "https://evil.example.com", "sub": "user1", "email": "user@example.com"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "provider rejects token",
+			claims:     map[string]any{"iss": "https://okta.example.com", "sub": "user1", "email": "user@example.com", "invalid": true},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "not allowlisted",
+			claims:     map[string]any{"iss": "https://okta.example.com", "sub": "user1", "email": "user@example.net"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			desc:       "allowlisted email is unverified",
+			claims:     map[string]any{"iss": "https://azure.example.com", "sub": "user1", "email": "user@example.com", "email_verified": false},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			desc:       "no token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "logout doesn't need a token",
+			path:       "/logout/cookie",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var (
+				gotProvider string
+				gotEmails   []string
+				gotEntity   *allowlist.Entity
+			)
+			h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.path != "" {
+					return
+				}
+				gotProvider, _ = tokenctx.ProviderFromContext(r.Context())
+				var err error
+				if gotEmails, err = tokenctx.EmailsFromContext(r.Context()); err != nil {
+					t.Errorf("failed to load emails from context: %v", err)
+				}
+				if gotEntity, err = tokenctx.AllowlistEntityFromContext(r.Context()); err != nil {
+					t.Errorf("failed to load allowlist entity from context: %v", err)
+				}
+			}))
+
+			path := test.path
+			if path == "" {
+				path = "/login/cookie"
+			}
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			if test.claims != nil {
+				req.Header.Set("Authorization", "Bearer "+unsignedToken(t, test.claims))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("request returned status %d, want %d", w.Code, test.wantStatus)
+			}
+			if gotProvider != test.wantProvider {
+				t.Errorf("request was handled by %q, want %q", gotProvider, test.wantProvider)
+			}
+			if diff := cmp.Diff(test.wantEmails, gotEmails); diff != "" {
+				t.Errorf("unexpected emails (-want +got)\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantEntity, gotEntity); diff != "" {
+				t.Errorf("unexpected entity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegister_Duplicates(t *testing.T) {
+	r := NewRegistry(zaptest.NewLogger(t))
+	al := loadAllowlist(t, testAllowlist)
+	if err := r.Register("azure", &fakeProvider{iss: "https://azure.example.com"}, al); err != nil {
+		t.Fatalf("failed to register azure: %v", err)
+	}
+
+	if err := r.Register("azure", &fakeProvider{iss: "https://other.example.com"}, al); err == nil {
+		t.Error("registering a duplicate name succeeded, want an error")
+	}
+	if err := r.Register("other", &fakeProvider{iss: "https://azure.example.com"}, al); err == nil {
+		t.Error("registering a duplicate issuer succeeded, want an error")
+	}
+}
+
+func TestRegister_MultiIssuer(t *testing.T) {
+	r := NewRegistry(zaptest.NewLogger(t))
+	al := loadAllowlist(t, testAllowlist)
+	p := &fakeMultiIssuer{issuers: []string{"https://tenant1.example.com", "https://tenant2.example.com"}}
+	if err := r.Register("entra", p, al); err != nil {
+		t.Fatalf("failed to register entra: %v", err)
+	}
+	if err := r.Register("other", &fakeProvider{iss: "https://tenant2.example.com"}, al); err == nil {
+		t.Error("registering a provider with one of the same issuers succeeded, want an error")
+	}
+
+	for _, iss := range p.issuers {
+		var gotProvider string
+		h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotProvider, _ = tokenctx.ProviderFromContext(r.Context())
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/login/cookie", nil)
+		req.Header.Set("Authorization", "Bearer "+unsignedToken(t, map[string]any{"iss": iss, "sub": "user1", "email": "user@example.com"}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("request with issuer %q returned status %d, want %d", iss, w.Code, http.StatusOK)
+		}
+		if gotProvider != "entra" {
+			t.Errorf("request with issuer %q was handled by %q, want %q", iss, gotProvider, "entra")
+		}
+	}
+}
+
+func TestRegister_SharedAllowlist(t *testing.T) {
+	unscoped := `{
+  "format": "v1",
+  "allowlist": [{"claim": "groups", "value": "opgee-users"}]
+}`
+	r := NewRegistry(zaptest.NewLogger(t))
+	al := loadAllowlist(t, unscoped)
+	if err := r.Register("azure", &fakeProvider{iss: "https://azure.example.com"}, al); err != nil {
+		t.Fatalf("failed to register azure: %v", err)
+	}
+	if err := r.Register("okta", &fakeProvider{iss: "https://okta.example.com"}, al); err == nil {
+		t.Error("registering a second provider with an allowlist with unscoped claim entries succeeded, want an error")
+	}
+	// Providers with their own allowlists can use unscoped claim entries.
+	if err := r.Register("okta", &fakeProvider{iss: "https://okta.example.com"}, loadAllowlist(t, unscoped)); err != nil {
+		t.Errorf("failed to register okta with its own allowlist: %v", err)
+	}
+}
+
+// fakeMultiIssuer is a fakeProvider that accepts tokens from several issuers.
+type fakeMultiIssuer struct {
+	issuers []string
+}
+
+func (f *fakeMultiIssuer) Issuer() string {
+	return f.issuers[0]
+}
+
+func (f *fakeMultiIssuer) Issuers() []string {
+	return f.issuers
+}
+
+func (f *fakeMultiIssuer) Authenticate(ctx context.Context, tknStr string) (*Identity, error) {
+	tkn, err := jwt.ParseInsecure([]byte(tknStr))
+	if err != nil {
+		return nil, err
+	}
+	return (&fakeProvider{iss: tkn.Issuer()}).Authenticate(ctx, tknStr)
+}
+
+// fakeProvider trusts any token with its issuer, unless it has an 'invalid'
+// claim.
+type fakeProvider struct {
+	iss string
+}
+
+func (f *fakeProvider) Issuer() string {
+	return f.iss
+}
+
+func (f *fakeProvider) Authenticate(ctx context.Context, tknStr string) (*Identity, error) {
+	tkn, err := jwt.ParseInsecure([]byte(tknStr))
+	if err != nil {
+		return nil, err
+	}
+	if tkn.Issuer() != f.iss {
+		return nil, errors.New("wrong issuer")
+	}
+	if _, ok := tkn.Get("invalid"); ok {
+		return nil, errors.New("invalid token")
+	}
+	id := &Identity{Subject: tkn.Subject(), Token: tkn}
+	if v, ok := tkn.Get("email"); ok {
+		id.Emails = []string{v.(string)}
+		if verified, ok := tkn.Get("email_verified"); ok {
+			id.SetEmailVerification(v.(string), VerificationFromClaim(verified))
+		}
+	}
+	if v, ok := tkn.Get("groups"); ok {
+		id.Groups = []string{v.(string)}
+	}
+	return id, nil
+}
+
+func unsignedToken(t *testing.T, claims map[string]any) string {
+	tkn := tokenWithClaims(t, claims)
+	// The fake provider doesn't verify signatures, so we just need something
+	// that looks like a JWT.
+	payload, err := jwt.NewSerializer().Serialize(tkn)
+	if err != nil {
+		t.Fatalf("failed to serialize token: %v", err)
+	}
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
@@ -0,0 +1,85 @@
+// Package cognito implements JWT authentication against an AWS Cognito user
+// pool. Cognito is a standard OpenID Connect provider, so this is a thin layer
+// over the oidc package, which adds the Cognito-specific claims, see
+// https://docs.aws.amazon.com/cognito/latest/developerguide/amazon-cognito-user-pools-using-the-id-token.html
+package cognito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RMI/credential-service/authn/oidc"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	Logger *zap.Logger
+
+	// UserPoolID is the ID of the user pool that users sign in to, formatted
+	// as <region>_<ID>, e.g. us-east-1_AbCdEf123.
+	UserPoolID string
+	// ClientID is the ID of the user pool's app client that users sign in
+	// with, which is the 'aud' claim of ID tokens.
+	ClientID string
+
+	// BaseURL overrides https://cognito-idp.<region>.amazonaws.com, which the
+	// user pool's issuer is under. It's only meant for testing.
+	BaseURL string
+	// HTTPClient is used to load the discovery document, defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (c *Config) validate() error {
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+
+	if c.UserPoolID == "" {
+		return errors.New("no user pool ID was provided")
+	}
+	if region, _, ok := strings.Cut(c.UserPoolID, "_"); !ok || region == "" {
+		return fmt.Errorf("user pool ID %q wasn't of the form <region>_<ID>", c.UserPoolID)
+	}
+	if c.ClientID == "" {
+		return errors.New("no client ID was provided")
+	}
+
+	return nil
+}
+
+// Issuer returns the 'iss' claim of tokens issued by the given user pool.
+func Issuer(userPoolID string) string {
+	region, _, _ := strings.Cut(userPoolID, "_")
+	return fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID)
+}
+
+// NewAuth returns a client capable of verifying ID tokens from the user pool.
+// Only ID tokens are accepted, not access tokens, and the user's groups are
+// read from the 'cognito:groups' claim.
+func NewAuth(ctx context.Context, cfg *Config) (*oidc.Auth, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	iss := Issuer(cfg.UserPoolID)
+	if cfg.BaseURL != "" {
+		iss = strings.TrimSuffix(cfg.BaseURL, "/") + "/" + cfg.UserPoolID
+	}
+	return oidc.NewAuth(ctx, &oidc.Config{
+		Logger:       cfg.Logger,
+		DiscoveryURL: iss + oidc.DiscoveryPath,
+		Audience:     cfg.ClientID,
+		RequiredClaims: map[string]string{
+			// Access tokens are signed with the same keys, but aren't meant to
+			// identify the user to us.
+			"token_use": "id",
+		},
+		EmailsClaim: "email",
+		GroupsClaim: "cognito:groups",
+		HTTPClient:  cfg.HTTPClient,
+	})
+}
@@ -0,0 +1,182 @@
+package cognito
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/authn/oidc"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	testPoolID   = "us-east-1_TestPool1"
+	testClientID = "test-app-client"
+)
+
+func TestAuthenticate(t *testing.T) {
+	srv, key := fakeUserPool(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	auth, err := NewAuth(ctx, &Config{
+		Logger:     zaptest.NewLogger(t),
+		UserPoolID: testPoolID,
+		ClientID:   testClientID,
+		BaseURL:    srv.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewAuth: %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		claims  map[string]any
+		want    *authn.Identity
+		wantErr bool
+	}{
+		{
+			desc: "ID token with groups",
+			claims: map[string]any{
+				"cognito:groups": []string{"opgee-users"},
+			},
+			want: &authn.Identity{
+				Subject:           "user123",
+				Emails:            []string{"user@example.com"},
+				EmailVerification: map[string]authn.EmailVerification{"user@example.com": authn.EmailVerified},
+				Groups:            []string{"opgee-users"},
+			},
+		},
+		{
+			desc: "unverified email",
+			claims: map[string]any{
+				"email_verified": false,
+			},
+			want: &authn.Identity{
+				Subject:           "user123",
+				Emails:            []string{"user@example.com"},
+				EmailVerification: map[string]authn.EmailVerification{"user@example.com": authn.EmailUnverified},
+			},
+		},
+		{
+			desc: "access token",
+			claims: map[string]any{
+				"token_use": "access",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "other app client",
+			claims: map[string]any{
+				"aud": "other-app-client",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			claims := map[string]any{
+				"iss":            srv.URL + "/" + testPoolID,
+				"aud":            testClientID,
+				"sub":            "user123",
+				"exp":            time.Now().Add(time.Hour),
+				"token_use":      "id",
+				"email":          "user@example.com",
+				"email_verified": true,
+			}
+			for k, v := range test.claims {
+				claims[k] = v
+			}
+
+			got, err := auth.Authenticate(context.Background(), sign(t, key, claims))
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Authenticate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(authn.Identity{}, "Token")); diff != "" {
+				t.Errorf("unexpected identity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	got := Issuer("eu-west-2_AbCdEf123")
+	if want := "https://cognito-idp.eu-west-2.amazonaws.com/eu-west-2_AbCdEf123"; got != want {
+		t.Errorf("Issuer = %q, want %q", got, want)
+	}
+}
+
+// fakeUserPool serves the discovery document and keys of a user pool, like
+// Cognito does under https://cognito-idp.<region>.amazonaws.com/<user pool ID>
+func fakeUserPool(t *testing.T) (*httptest.Server, jwk.Key) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		t.Fatalf("failed to make JWK: %v", err)
+	}
+	if err := key.Set(jwk.KeyIDKey, "test-key"); err != nil {
+		t.Fatalf("failed to set key ID: %v", err)
+	}
+	pub, err := key.PublicKey()
+	if err != nil {
+		t.Fatalf("failed to get public key: %v", err)
+	}
+	if err := pub.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+		t.Fatalf("failed to set key algorithm: %v", err)
+	}
+	ks := jwk.NewSet()
+	if err := ks.AddKey(pub); err != nil {
+		t.Fatalf("failed to add key to set: %v", err)
+	}
+
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+testPoolID+oidc.DiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                srv.URL + "/" + testPoolID,
+			"jwks_uri":                              srv.URL + "/" + testPoolID + "/.well-known/jwks.json",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/"+testPoolID+"/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ks)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, key
+}
+
+func sign(t *testing.T, key jwk.Key, claims map[string]any) string {
+	tkn := jwt.New()
+	for k, v := range claims {
+		if err := tkn.Set(k, v); err != nil {
+			t.Fatalf("failed to set claim %q: %v", k, err)
+		}
+	}
+	signed, err := jwt.Sign(tkn, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return string(signed)
+}
@@ -0,0 +1,106 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// errEmailUnverified is returned when the only emails of an identity that are
+// allowlisted weren't verified by its provider.
+var errEmailUnverified = fmt.Errorf("%w: the allowlisted email wasn't verified by the identity provider", ErrNotAllowlisted)
+
+// EmailVerification is whether an identity provider says it verified that the
+// user owns an email address.
+type EmailVerification int
+
+const (
+	// EmailVerificationUnknown means the token doesn't say, which is the case
+	// for e.g. Azure AD B2C's 'emails' claim.
+	EmailVerificationUnknown EmailVerification = iota
+	// EmailVerified means the token says the address was verified, e.g. with an
+	// 'email_verified' claim of true.
+	EmailVerified
+	// EmailUnverified means the token says the address wasn't verified, so
+	// anyone could have claimed it.
+	EmailUnverified
+)
+
+func (v EmailVerification) String() string {
+	switch v {
+	case EmailVerified:
+		return "verified"
+	case EmailUnverified:
+		return "unverified"
+	default:
+		return "unknown"
+	}
+}
+
+// VerificationFromClaim converts a claim like 'email_verified', which is either
+// a boolean or the string "true"/"false" depending on the provider, to an
+// EmailVerification.
+func VerificationFromClaim(v any) EmailVerification {
+	switch vt := v.(type) {
+	case bool:
+		if vt {
+			return EmailVerified
+		}
+	case string:
+		if strings.EqualFold(vt, "true") {
+			return EmailVerified
+		}
+	}
+	return EmailUnverified
+}
+
+// SetEmailVerification records whether the provider verified one of the
+// identity's emails.
+func (id *Identity) SetEmailVerification(email string, v EmailVerification) {
+	if id.EmailVerification == nil {
+		id.EmailVerification = make(map[string]EmailVerification)
+	}
+	id.EmailVerification[strings.ToLower(email)] = v
+}
+
+// verification returns the verification status of one of the identity's
+// emails.
+func (id *Identity) verification(email string) EmailVerification {
+	return id.EmailVerification[strings.ToLower(email)]
+}
+
+// trustedEmails splits the identity's emails into the ones we trust enough to
+// check against the allowlist, and the ones we don't. Addresses the provider
+// says are unverified are never trusted, and if requireVerified is set, only
+// addresses the provider says are verified are.
+func trustedEmails(id *Identity, requireVerified bool, logger *zap.Logger) (trusted, untrusted []string) {
+	for _, email := range id.Emails {
+		v := id.verification(email)
+		if v == EmailVerified || (v == EmailVerificationUnknown && !requireVerified) {
+			trusted = append(trusted, email)
+			continue
+		}
+		logger.Info("ignoring unverified email",
+			zap.String("email", email),
+			zap.Stringer("verification", v),
+			zap.Bool("verification_required", requireVerified),
+		)
+		untrusted = append(untrusted, email)
+	}
+	return trusted, untrusted
+}
+
+// denialReason returns a short, stable description of why authentication
+// failed, for logs.
+func denialReason(err error) string {
+	switch {
+	case errors.Is(err, errEmailUnverified):
+		return "email_unverified"
+	case errors.Is(err, ErrNotAllowlisted):
+		return "not_allowlisted"
+	default:
+		return "unauthenticated"
+	}
+}
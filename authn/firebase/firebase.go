@@ -0,0 +1,236 @@
+// Package firebase implements JWT authentication against Firebase Auth (also
+// known as Google Cloud Identity Platform). Firebase ID tokens aren't quite
+// OpenID Connect tokens: their keys are published as X.509 certificates
+// rather than a JWK set, and there's no discovery document, see
+// https://firebase.google.com/docs/auth/admin/verify-id-tokens#verify_id_tokens_using_a_third-party_jwt_library
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/lestrrat-go/httprc"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+)
+
+// DefaultCertsURL is where Google publishes the certificates that Firebase ID
+// tokens are signed with, keyed by key ID.
+const DefaultCertsURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+
+type Auth struct {
+	cache    *httprc.Cache
+	certsURL string
+	logger   *zap.Logger
+
+	groupsClaim string
+
+	aud string
+	iss string
+	now func() time.Time
+}
+
+type Config struct {
+	Logger *zap.Logger
+
+	// ProjectID is the ID of the Firebase project users sign in to, which is
+	// the 'aud' claim of ID tokens, and part of their 'iss' claim.
+	ProjectID string
+	// GroupsClaim is the name of the custom claim containing the groups the
+	// user belongs to, defaults to 'groups'. It's optional in tokens.
+	GroupsClaim string
+
+	// CertsURL overrides DefaultCertsURL, and is only meant for testing.
+	CertsURL string
+	// Now is used to validate token timestamps, defaults to time.Now.
+	Now func() time.Time
+}
+
+func (c *Config) validate() error {
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+
+	if c.ProjectID == "" {
+		return errors.New("no project ID was provided")
+	}
+
+	return nil
+}
+
+// Issuer returns the 'iss' claim of tokens issued for the given project.
+func Issuer(projectID string) string {
+	return "https://securetoken.google.com/" + projectID
+}
+
+// NewAuth returns a client capable of verifying Firebase ID tokens for the
+// project.
+func NewAuth(ctx context.Context, cfg *Config) (*Auth, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	certsURL := cfg.CertsURL
+	if certsURL == "" {
+		certsURL = DefaultCertsURL
+	}
+	groupsClaim := cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	// Like jwk.Cache, this refreshes the certificates in the background based
+	// on their Cache-Control header, and keeps serving the last ones it loaded
+	// if a refresh fails.
+	cache := httprc.NewCache(ctx, httprc.WithErrSink(httprc.ErrSinkFunc(func(err error) {
+		cfg.Logger.Warn("failed to refresh Firebase certificates", zap.Error(err))
+	})))
+	if err := cache.Register(certsURL, httprc.WithTransformer(httprc.TransformFunc(parseCerts))); err != nil {
+		return nil, fmt.Errorf("failed to register certificates URL: %w", err)
+	}
+	if _, err := cache.Refresh(ctx, certsURL); err != nil {
+		return nil, fmt.Errorf("failed to load certificates: %w", err)
+	}
+
+	return &Auth{
+		cache:    cache,
+		certsURL: certsURL,
+		logger:   cfg.Logger,
+
+		groupsClaim: groupsClaim,
+
+		aud: cfg.ProjectID,
+		iss: Issuer(cfg.ProjectID),
+		now: now,
+	}, nil
+}
+
+// parseCerts converts the published certificates, a JSON object of key ID to
+// PEM-encoded certificate, to a key set.
+func parseCerts(_ string, resp *http.Response) (any, error) {
+	defer resp.Body.Close()
+	var certs map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&certs); err != nil {
+		return nil, fmt.Errorf("failed to decode certificates: %w", err)
+	}
+	ks := jwk.NewSet()
+	for kid, cert := range certs {
+		key, err := jwk.ParseKey([]byte(cert), jwk.WithPEM(true))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %q: %w", kid, err)
+		}
+		if err := key.Set(jwk.KeyIDKey, kid); err != nil {
+			return nil, fmt.Errorf("failed to set key ID %q: %w", kid, err)
+		}
+		// Firebase only uses RS256.
+		if err := key.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+			return nil, fmt.Errorf("failed to set 'alg' on key %q: %w", kid, err)
+		}
+		if err := ks.AddKey(key); err != nil {
+			return nil, fmt.Errorf("failed to add key %q to key set: %w", kid, err)
+		}
+	}
+	if ks.Len() == 0 {
+		return nil, errors.New("no certificates were published")
+	}
+	return ks, nil
+}
+
+// Issuer returns the 'iss' claim of tokens issued for the project.
+func (a *Auth) Issuer() string {
+	return a.iss
+}
+
+// Authenticate verifies a Firebase ID token, and returns the identity it
+// belongs to.
+func (a *Auth) Authenticate(ctx context.Context, tknStr string) (*authn.Identity, error) {
+	tkn, err := a.parseAndVerify(ctx, tknStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users without an email (e.g. phone sign-in) can't be allowlisted by
+	// email, but can still be allowlisted by a custom claim.
+	var emails []string
+	if v, ok := tkn.Get("email"); ok {
+		if emails, err = authn.StringsFromClaim(v); err != nil {
+			return nil, fmt.Errorf("'email' claim in token was invalid: %w", err)
+		}
+	}
+	var groups []string
+	if v, ok := tkn.Get(a.groupsClaim); ok {
+		if groups, err = authn.StringsFromClaim(v); err != nil {
+			return nil, fmt.Errorf("%q claim in token was invalid: %w", a.groupsClaim, err)
+		}
+	}
+
+	id := &authn.Identity{
+		Subject: tkn.Subject(),
+		Emails:  emails,
+		Groups:  groups,
+		Token:   tkn,
+	}
+	// Email/password users can sign up with any email, and only have it
+	// verified later. Firebase always sets 'email_verified' alongside 'email',
+	// so we treat a missing claim as unverified.
+	verified, _ := tkn.Get("email_verified")
+	for _, email := range emails {
+		id.SetEmailVerification(email, authn.VerificationFromClaim(verified))
+	}
+	return id, nil
+}
+
+func (a *Auth) parseAndVerify(ctx context.Context, tknStr string) (jwt.Token, error) {
+	v, err := a.cache.Get(ctx, a.certsURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Firebase certificates from cache: %w", err)
+	}
+	ks, ok := v.(jwk.Set)
+	if !ok {
+		return nil, fmt.Errorf("cached certificates had type %T", v)
+	}
+
+	tkn, err := jwt.Parse([]byte(tknStr),
+		jwt.WithKeySet(ks),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidate(true),
+		jwt.WithClock(jwt.ClockFunc(a.now)),
+		jwt.WithRequiredClaim(jwt.IssuedAtKey),
+		jwt.WithValidator(jwt.ValidatorFunc(a.validateClaims)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token against certificates: %w", err)
+	}
+	return tkn, nil
+}
+
+// validateClaims checks the claims that jwt.Parse doesn't, see
+// https://firebase.google.com/docs/auth/admin/verify-id-tokens#verify_the_id_tokens_header
+func (a *Auth) validateClaims(_ context.Context, tkn jwt.Token) jwt.ValidationError {
+	if tkn.Subject() == "" {
+		return jwt.NewValidationError(errors.New("token had no 'sub' claim"))
+	}
+	v, ok := tkn.Get("auth_time")
+	if !ok {
+		return jwt.NewValidationError(errors.New("token had no 'auth_time' claim"))
+	}
+	authTime, ok := v.(float64)
+	if !ok {
+		return jwt.NewValidationError(fmt.Errorf("'auth_time' claim had type %T", v))
+	}
+	if time.Unix(int64(authTime), 0).After(a.now()) {
+		return jwt.NewValidationError(errors.New("'auth_time' claim is in the future"))
+	}
+	return nil
+}
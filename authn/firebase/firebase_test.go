@@ -0,0 +1,199 @@
+package firebase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+const testProjectID = "test-project"
+
+func TestAuthenticate(t *testing.T) {
+	srv, key := fakeCerts(t)
+
+	now := time.Now().Truncate(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	auth, err := NewAuth(ctx, &Config{
+		Logger:    zaptest.NewLogger(t),
+		ProjectID: testProjectID,
+		CertsURL:  srv.URL,
+		Now:       func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("NewAuth: %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		claims  map[string]any
+		key     jwk.Key
+		want    *authn.Identity
+		wantErr bool
+	}{
+		{
+			desc: "verified email with groups",
+			claims: map[string]any{
+				"groups": []string{"opgee-users"},
+			},
+			want: &authn.Identity{
+				Subject:           "user123",
+				Emails:            []string{"user@example.com"},
+				EmailVerification: map[string]authn.EmailVerification{"user@example.com": authn.EmailVerified},
+				Groups:            []string{"opgee-users"},
+			},
+		},
+		{
+			desc: "unverified email",
+			claims: map[string]any{
+				"email_verified": false,
+			},
+			want: &authn.Identity{
+				Subject:           "user123",
+				Emails:            []string{"user@example.com"},
+				EmailVerification: map[string]authn.EmailVerification{"user@example.com": authn.EmailUnverified},
+			},
+		},
+		{
+			desc: "other project",
+			claims: map[string]any{
+				"aud": "other-project",
+				"iss": Issuer("other-project"),
+			},
+			wantErr: true,
+		},
+		{
+			desc: "auth_time in the future",
+			claims: map[string]any{
+				"auth_time": now.Add(time.Hour).Unix(),
+			},
+			wantErr: true,
+		},
+		{
+			desc: "no subject",
+			claims: map[string]any{
+				"sub": "",
+			},
+			wantErr: true,
+		},
+		{
+			desc:    "signed with unpublished key",
+			key:     newKey(t),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			claims := map[string]any{
+				"iss":            Issuer(testProjectID),
+				"aud":            testProjectID,
+				"sub":            "user123",
+				"iat":            now.Add(-time.Minute),
+				"exp":            now.Add(time.Hour),
+				"auth_time":      now.Add(-time.Minute).Unix(),
+				"email":          "user@example.com",
+				"email_verified": true,
+			}
+			for k, v := range test.claims {
+				claims[k] = v
+			}
+			signer := key
+			if test.key != nil {
+				signer = test.key
+			}
+
+			got, err := auth.Authenticate(context.Background(), sign(t, signer, claims))
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Authenticate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(authn.Identity{}, "Token")); diff != "" {
+				t.Errorf("unexpected identity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+// fakeCerts serves a self-signed certificate for a locally generated key, in
+// the same format as DefaultCertsURL.
+func fakeCerts(t *testing.T) (*httptest.Server, jwk.Key) {
+	key := newKey(t)
+	var priv rsa.PrivateKey
+	if err := key.Raw(&priv); err != nil {
+		t.Fatalf("failed to get raw key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "securetoken.system.gserviceaccount.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, &priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	certs := map[string]string{
+		key.KeyID(): string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(certs); err != nil {
+			t.Errorf("failed to encode certificates: %v", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, key
+}
+
+func newKey(t *testing.T) jwk.Key {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		t.Fatalf("failed to make JWK: %v", err)
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		t.Fatalf("failed to assign key ID: %v", err)
+	}
+	return key
+}
+
+func sign(t *testing.T, key jwk.Key, claims map[string]any) string {
+	tkn := jwt.New()
+	for k, v := range claims {
+		if err := tkn.Set(k, v); err != nil {
+			t.Fatalf("failed to set claim %q: %v", k, err)
+		}
+	}
+	signed, err := jwt.Sign(tkn, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return string(signed)
+}
@@ -0,0 +1,85 @@
+package authn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// NonceHeader is the header clients use to send the nonce they included in
+// their authentication request to the identity provider. When it's set, the
+// source token's 'nonce' claim must match it, which binds the token to the
+// client's login attempt.
+const NonceHeader = "X-Auth-Nonce"
+
+// authTimeSkew is how far in the future an 'auth_time' claim can be, to allow
+// for clock differences between us and the identity provider.
+const authTimeSkew = time.Minute
+
+// checkFreshness checks the identity's token against the registry's freshness
+// options. The nonce is the one the client sent, if any.
+func (r *Registry) checkFreshness(nonce string, id *Identity) error {
+	if err := checkNonce(nonce, id.Token, r.requireNonce); err != nil {
+		return err
+	}
+	if r.maxAuthAge > 0 {
+		if err := checkAuthTime(id.Token, r.maxAuthAge, r.now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkNonce(want string, tkn jwt.Token, required bool) error {
+	if want == "" {
+		if required {
+			return fmt.Errorf("no %s header was provided", NonceHeader)
+		}
+		return nil
+	}
+	v, ok := tkn.Get("nonce")
+	if !ok {
+		return errors.New("token didn't contain a 'nonce' claim")
+	}
+	got, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("'nonce' claim had type %T", v)
+	}
+	if got != want {
+		return errors.New("'nonce' claim didn't match the nonce provided by the client")
+	}
+	return nil
+}
+
+func checkAuthTime(tkn jwt.Token, maxAge time.Duration, now time.Time) error {
+	v, ok := tkn.Get("auth_time")
+	if !ok {
+		return errors.New("token didn't contain an 'auth_time' claim")
+	}
+	var secs int64
+	switch vt := v.(type) {
+	case float64:
+		secs = int64(vt)
+	case int64:
+		secs = vt
+	case json.Number:
+		n, err := vt.Int64()
+		if err != nil {
+			return fmt.Errorf("'auth_time' claim was invalid: %w", err)
+		}
+		secs = n
+	default:
+		return fmt.Errorf("'auth_time' claim had type %T", v)
+	}
+	authTime := time.Unix(secs, 0)
+	if authTime.After(now.Add(authTimeSkew)) {
+		return fmt.Errorf("'auth_time' claim %s was in the future", authTime.Format(time.RFC3339))
+	}
+	if age := now.Sub(authTime); age > maxAge {
+		return fmt.Errorf("user authenticated %s ago at %s, which is longer than the allowed %s", age.Round(time.Second), authTime.Format(time.RFC3339), maxAge)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package authn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestMiddleware_Freshness(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return now }
+	al := loadAllowlist(t, testAllowlist)
+
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":   "https://azure.example.com",
+			"sub":   "user1",
+			"email": "user@example.com",
+			"exp":   now.Add(time.Hour),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		desc   string
+		opts   []RegistryOption
+		claims map[string]any
+		nonce  string
+		// wantStatus is the status for each time the token is sent.
+		wantStatus []int
+	}{
+		{
+			desc:       "no checks enabled",
+			claims:     claims(nil),
+			wantStatus: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			desc:       "matching nonce",
+			claims:     claims(map[string]any{"nonce": "abc123"}),
+			nonce:      "abc123",
+			wantStatus: []int{http.StatusOK},
+		},
+		{
+			desc:       "mismatched nonce",
+			claims:     claims(map[string]any{"nonce": "abc123"}),
+			nonce:      "def456",
+			wantStatus: []int{http.StatusUnauthorized},
+		},
+		{
+			desc:       "nonce provided but not in token",
+			claims:     claims(nil),
+			nonce:      "abc123",
+			wantStatus: []int{http.StatusUnauthorized},
+		},
+		{
+			desc:       "required nonce not provided",
+			opts:       []RegistryOption{WithRequiredNonce()},
+			claims:     claims(map[string]any{"nonce": "abc123"}),
+			wantStatus: []int{http.StatusUnauthorized},
+		},
+		{
+			desc:       "recent auth_time",
+			opts:       []RegistryOption{WithMaxAuthAge(10 * time.Minute)},
+			claims:     claims(map[string]any{"auth_time": now.Add(-5 * time.Minute).Unix()}),
+			wantStatus: []int{http.StatusOK},
+		},
+		{
+			desc:       "old auth_time",
+			opts:       []RegistryOption{WithMaxAuthAge(10 * time.Minute)},
+			claims:     claims(map[string]any{"auth_time": now.Add(-15 * time.Minute).Unix()}),
+			wantStatus: []int{http.StatusUnauthorized},
+		},
+		{
+			desc:       "future auth_time",
+			opts:       []RegistryOption{WithMaxAuthAge(10 * time.Minute)},
+			claims:     claims(map[string]any{"auth_time": now.Add(time.Hour).Unix()}),
+			wantStatus: []int{http.StatusUnauthorized},
+		},
+		{
+			desc:       "auth_time within clock skew",
+			opts:       []RegistryOption{WithMaxAuthAge(10 * time.Minute)},
+			claims:     claims(map[string]any{"auth_time": now.Add(30 * time.Second).Unix()}),
+			wantStatus: []int{http.StatusOK},
+		},
+		{
+			desc:       "missing auth_time",
+			opts:       []RegistryOption{WithMaxAuthAge(10 * time.Minute)},
+			claims:     claims(nil),
+			wantStatus: []int{http.StatusUnauthorized},
+		},
+		{
+			desc:       "replayed token",
+			opts:       []RegistryOption{WithReplayProtection(NewMemoryReplayStore(nowFn))},
+			claims:     claims(nil),
+			wantStatus: []int{http.StatusOK, http.StatusUnauthorized},
+		},
+		{
+			desc:       "replayed token with jti",
+			opts:       []RegistryOption{WithReplayProtection(NewMemoryReplayStore(nowFn))},
+			claims:     claims(map[string]any{"jti": "token1"}),
+			wantStatus: []int{http.StatusOK, http.StatusUnauthorized},
+		},
+		{
+			desc:       "rejected tokens aren't marked as used",
+			opts:       []RegistryOption{WithReplayProtection(NewMemoryReplayStore(nowFn))},
+			claims:     claims(map[string]any{"email": "user@example.net"}),
+			wantStatus: []int{http.StatusForbidden, http.StatusForbidden},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			opts := append([]RegistryOption{WithNow(nowFn)}, test.opts...)
+			r := NewRegistry(zaptest.NewLogger(t), opts...)
+			if err := r.Register("azure", &fakeProvider{iss: "https://azure.example.com"}, al); err != nil {
+				t.Fatalf("failed to register azure: %v", err)
+			}
+			h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			tkn := unsignedToken(t, test.claims)
+
+			for i, want := range test.wantStatus {
+				req := httptest.NewRequest(http.MethodPost, "/login/cookie", nil)
+				req.Header.Set("Authorization", "Bearer "+tkn)
+				if test.nonce != "" {
+					req.Header.Set(NonceHeader, test.nonce)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+
+				if w.Code != want {
+					t.Fatalf("request %d returned status %d, want %d", i+1, w.Code, want)
+				}
+			}
+		})
+	}
+}
@@ -3,75 +3,69 @@
 package localjwt
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
 
+	"github.com/RMI/credential-service/authn"
 	"github.com/go-chi/jwtauth/v5"
-	"github.com/lestrrat-go/jwx/v2/jwt"
-	"go.uber.org/zap"
 )
 
 type Auth struct {
-	jwtAuth  *jwtauth.JWTAuth
-	logger   *zap.Logger
-	Verifier func(next http.Handler) http.Handler
+	jwtAuth *jwtauth.JWTAuth
 }
 
-func NewAuth(jwtAuth *jwtauth.JWTAuth, logger *zap.Logger) *Auth {
+func NewAuth(jwtAuth *jwtauth.JWTAuth) *Auth {
 	return &Auth{
-		jwtAuth:  jwtAuth,
-		logger:   logger,
-		Verifier: jwtauth.Verifier(jwtAuth),
+		jwtAuth: jwtAuth,
 	}
 }
 
-func (a *Auth) Authenticator(next http.Handler) http.Handler {
-	hfn := func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth verification if they're logging out.
-		if r.URL.Path == "/logout/cookie" && r.Method == http.MethodPost {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		token, _, err := jwtauth.FromContext(r.Context())
-
-		if err != nil {
-			a.logger.Warn("token failed validation", zap.Error(err))
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-		if token == nil {
+// Issuer returns the empty string, as tokens generated with //cmd/tools/genjwt
+// don't have an issuer.
+func (a *Auth) Issuer() string {
+	return ""
+}
 
-			a.logger.Warn("no token found in request", zap.Error(err))
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		}
+// Authenticate verifies a locally signed token, and returns the identity it
+// belongs to.
+func (a *Auth) Authenticate(ctx context.Context, tknStr string) (*authn.Identity, error) {
+	tkn, err := jwtauth.VerifyToken(a.jwtAuth, tknStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %w", err)
+	}
 
-		if err := jwt.Validate(token); err != nil {
-			a.logger.Warn("token failed validation", zap.Error(err))
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+	// In local auth, we expect an additional claim indicating that this was
+	// generated explicitly for the purpose of being exchanged.
+	val, ok := tkn.Get("local_auth")
+	if !ok {
+		return nil, errors.New("no 'local_auth' claim in source token")
+	}
+	valB, ok := val.(bool)
+	if !ok {
+		return nil, fmt.Errorf("'local_auth' claim had type %T", val)
+	}
+	if !valB {
+		// This shouldn't happen. Either the claim isn't there, or it's set to `true`.
+		return nil, errors.New("'local_auth' claim was false")
+	}
 
-		// In local auth, we expect an additional claim indicating that this was
-		// generated explicitly for the purpose of being exchanged.
-		val, ok := token.Get("local_auth")
-		if !ok {
-			http.Error(w, "no 'local_auth' claim in source token", http.StatusUnauthorized)
-			return
-		}
-		valB, ok := val.(bool)
-		if !ok {
-			http.Error(w, fmt.Sprintf("'local_auth' claim had type %T", val), http.StatusInternalServerError)
-			return
+	var emails, groups []string
+	if v, ok := tkn.Get("emails"); ok {
+		if emails, err = authn.StringsFromClaim(v); err != nil {
+			return nil, fmt.Errorf("'emails' claim in token was invalid: %w", err)
 		}
-		if !valB {
-			// This shouldn't happen. Either the claim isn't there, or it's set to `true`.
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
+	}
+	if v, ok := tkn.Get("groups"); ok {
+		if groups, err = authn.StringsFromClaim(v); err != nil {
+			return nil, fmt.Errorf("'groups' claim in token was invalid: %w", err)
 		}
-
-		// Token is authenticated, pass it through
-		next.ServeHTTP(w, r)
 	}
-	return http.HandlerFunc(hfn)
+
+	return &authn.Identity{
+		Subject: tkn.Subject(),
+		Emails:  emails,
+		Groups:  groups,
+		Token:   tkn,
+	}, nil
 }
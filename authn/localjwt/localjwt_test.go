@@ -0,0 +1,174 @@
+package localjwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/tokenctx"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAuthenticate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ja := jwtauth.New("EdDSA", priv, pub)
+	auth := NewAuth(ja)
+
+	tests := []struct {
+		desc    string
+		claims  map[string]any
+		want    *authn.Identity
+		wantErr bool
+	}{
+		{
+			desc: "with emails",
+			claims: map[string]any{
+				"sub":        "test123",
+				"local_auth": true,
+				"emails":     []string{"test@rmi.org", "other@rmi.org"},
+			},
+			want: &authn.Identity{
+				Subject: "test123",
+				Emails:  []string{"test@rmi.org", "other@rmi.org"},
+			},
+		},
+		{
+			desc: "with groups",
+			claims: map[string]any{
+				"sub":        "test123",
+				"local_auth": true,
+				"emails":     "test@rmi.org",
+				"groups":     []string{"opgee-users"},
+			},
+			want: &authn.Identity{
+				Subject: "test123",
+				Emails:  []string{"test@rmi.org"},
+				Groups:  []string{"opgee-users"},
+			},
+		},
+		{
+			desc: "not a source token",
+			claims: map[string]any{
+				"sub":    "test123",
+				"emails": []string{"test@rmi.org"},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "expired",
+			claims: map[string]any{
+				"sub":        "test123",
+				"local_auth": true,
+				"exp":        time.Now().Add(-time.Hour),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, tkn, err := ja.Encode(test.claims)
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+
+			got, err := auth.Authenticate(context.Background(), tkn)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Authenticate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(authn.Identity{}, "Token")); diff != "" {
+				t.Errorf("unexpected identity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_WithAllowlist(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ja := jwtauth.New("EdDSA", priv, pub)
+
+	al, err := allowlist.NewChecker(&allowlist.Config{
+		Format: "v1",
+		Allowlist: []*allowlist.AllowlistEntry{
+			{Email: "pacta@example.com", Sites: []string{"PACTA"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create allowlist: %v", err)
+	}
+	reg := authn.NewRegistry(zaptest.NewLogger(t))
+	if err := reg.Register("local", NewAuth(ja), al); err != nil {
+		t.Fatalf("failed to register provider: %v", err)
+	}
+
+	tests := []struct {
+		desc       string
+		emails     []string
+		wantStatus int
+		want       *allowlist.Entity
+	}{
+		{
+			desc:       "site-restricted email",
+			emails:     []string{"pacta@example.com"},
+			wantStatus: http.StatusOK,
+			want:       &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}},
+		},
+		{
+			desc:       "not allowlisted",
+			emails:     []string{"someone@example.com"},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, tkn, err := ja.Encode(map[string]any{
+				"sub":        "test123",
+				"local_auth": true,
+				"emails":     test.emails,
+			})
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+
+			var got *allowlist.Entity
+			h := reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got, err = tokenctx.AllowlistEntityFromContext(r.Context()); err != nil {
+					t.Errorf("failed to load allowlist entity: %v", err)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/login/apikey", nil)
+			req.Header.Set("Authorization", "Bearer "+tkn)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("request returned status %d, want %d", w.Code, test.wantStatus)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected allowlist entity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Package oidc implements JWT authentication against a generic OpenID Connect
+// identity provider (e.g. Okta, Keycloak, Google Workspace), which is
+// configured from the provider's discovery document, see
+// https://openid.net/specs/openid-connect-discovery-1_0.html
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+)
+
+// DiscoveryPath is appended to an issuer to find its discovery document.
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+type Auth struct {
+	cache   *jwk.Cache
+	jwksURI string
+	logger  *zap.Logger
+
+	emailsClaim string
+	groupsClaim string
+
+	aud            string
+	iss            string
+	algs           map[jwa.SignatureAlgorithm]bool
+	requiredClaims map[string]string
+}
+
+type Config struct {
+	Logger *zap.Logger
+
+	// DiscoveryURL is the URL of the provider's discovery document, which is
+	// usually the issuer followed by /.well-known/openid-configuration
+	DiscoveryURL string
+	// Audience is the expected 'aud' claim in tokens, usually the client ID of
+	// the application that users are logging into.
+	Audience string
+	// RequiredClaims are claims that must be present in tokens with the given
+	// value, e.g. {"hd": "example.com"} to only allow users from a specific
+	// Google Workspace domain, or {"email_verified": "true"}. For list claims,
+	// the value must be one of the items in the list.
+	RequiredClaims map[string]string
+	// EmailsClaim is the name of the claim containing the user's email
+	// address (or addresses), defaults to 'email'.
+	EmailsClaim string
+	// GroupsClaim is the name of the claim containing the groups the user
+	// belongs to, defaults to 'groups'. It's optional in tokens.
+	GroupsClaim string
+
+	// HTTPClient is used to load the discovery document, defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (c *Config) validate() error {
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+
+	if c.DiscoveryURL == "" {
+		return errors.New("no discovery URL was provided")
+	}
+	if c.Audience == "" {
+		return errors.New("no audience was provided")
+	}
+
+	return nil
+}
+
+// discoveryDoc contains the fields we use from a provider's discovery document.
+type discoveryDoc struct {
+	Issuer                string   `json:"issuer"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+}
+
+// Endpoints are the OAuth 2.0 endpoints of a provider, which are used to log
+// users in server-side with the authorization code flow.
+type Endpoints struct {
+	Issuer        string
+	Authorization string
+	Token         string
+}
+
+// LoadEndpoints loads the authorization and token endpoints from the discovery
+// document at the given URL. Unlike NewAuth, it doesn't require the issuer to
+// match the discovery URL, which isn't the case for e.g. Azure AD B2C, since
+// tokens are still verified by whichever provider matches their issuer.
+func LoadEndpoints(ctx context.Context, client *http.Client, discoveryURL string) (*Endpoints, error) {
+	doc, err := fetchDiscoveryDoc(ctx, client, discoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	if doc.AuthorizationEndpoint == "" {
+		return nil, errors.New("discovery document had no 'authorization_endpoint'")
+	}
+	if doc.TokenEndpoint == "" {
+		return nil, errors.New("discovery document had no 'token_endpoint'")
+	}
+	return &Endpoints{
+		Issuer:        doc.Issuer,
+		Authorization: doc.AuthorizationEndpoint,
+		Token:         doc.TokenEndpoint,
+	}, nil
+}
+
+// NewAuth returns a client capable of verifying ID tokens from the OpenID
+// Connect provider described by the discovery document at cfg.DiscoveryURL.
+func NewAuth(ctx context.Context, cfg *Config) (*Auth, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	doc, err := loadDiscoveryDoc(ctx, cfg.HTTPClient, cfg.DiscoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load discovery document: %w", err)
+	}
+
+	algs := make(map[jwa.SignatureAlgorithm]bool)
+	for _, alg := range doc.SigningAlgs {
+		var sa jwa.SignatureAlgorithm
+		if err := sa.Accept(alg); err != nil {
+			cfg.Logger.Warn("ignoring unsupported signing algorithm", zap.String("alg", alg), zap.Error(err))
+			continue
+		}
+		if sa == jwa.NoSignature {
+			// Never accept unsigned tokens, even if the provider claims to issue them.
+			continue
+		}
+		algs[sa] = true
+	}
+	if len(algs) == 0 {
+		return nil, fmt.Errorf("provider supported no usable signing algorithms, had %q", doc.SigningAlgs)
+	}
+
+	cache := jwk.NewCache(ctx)
+	if err := cache.Register(doc.JWKSURI); err != nil {
+		return nil, fmt.Errorf("failed to register JWT key endpoint: %w", err)
+	}
+	if _, err := cache.Refresh(ctx, doc.JWKSURI); err != nil {
+		return nil, fmt.Errorf("failed to load key set from endpoint: %w", err)
+	}
+
+	emailsClaim := cfg.EmailsClaim
+	if emailsClaim == "" {
+		emailsClaim = "email"
+	}
+	groupsClaim := cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	return &Auth{
+		cache:   cache,
+		jwksURI: doc.JWKSURI,
+		logger:  cfg.Logger,
+
+		emailsClaim: emailsClaim,
+		groupsClaim: groupsClaim,
+
+		aud:            cfg.Audience,
+		iss:            doc.Issuer,
+		algs:           algs,
+		requiredClaims: cfg.RequiredClaims,
+	}, nil
+}
+
+func loadDiscoveryDoc(ctx context.Context, client *http.Client, discoveryURL string) (*discoveryDoc, error) {
+	doc, err := fetchDiscoveryDoc(ctx, client, discoveryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Issuer == "" {
+		return nil, errors.New("discovery document had no 'issuer'")
+	}
+	if doc.JWKSURI == "" {
+		return nil, errors.New("discovery document had no 'jwks_uri'")
+	}
+	// The spec requires the issuer to match the URL the document was loaded
+	// from, which prevents one provider from impersonating another, see
+	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if want := strings.TrimSuffix(doc.Issuer, "/") + DiscoveryPath; want != discoveryURL {
+		return nil, fmt.Errorf("issuer %q doesn't match discovery URL %q", doc.Issuer, discoveryURL)
+	}
+	if len(doc.SigningAlgs) == 0 {
+		// RS256 is the default and must always be supported, per the spec.
+		doc.SigningAlgs = []string{jwa.RS256.String()}
+	}
+	return doc, nil
+}
+
+func fetchDiscoveryDoc(ctx context.Context, client *http.Client, discoveryURL string) (*discoveryDoc, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	var doc discoveryDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+	return &doc, nil
+}
+
+// Issuer returns the 'iss' claim of tokens issued by the provider.
+func (a *Auth) Issuer() string {
+	return a.iss
+}
+
+// Authenticate verifies an ID token from the provider, and returns the
+// identity it belongs to.
+func (a *Auth) Authenticate(ctx context.Context, tknStr string) (*authn.Identity, error) {
+	tkn, err := a.parseAndVerify(ctx, tknStr)
+	if err != nil {
+		return nil, err
+	}
+
+	emailsVal, ok := tkn.Get(a.emailsClaim)
+	if !ok {
+		return nil, fmt.Errorf("token didn't contain an %q claim", a.emailsClaim)
+	}
+	emails, err := authn.StringsFromClaim(emailsVal)
+	if err != nil {
+		return nil, fmt.Errorf("%q claim in token was invalid: %w", a.emailsClaim, err)
+	}
+	var groups []string
+	if groupsVal, ok := tkn.Get(a.groupsClaim); ok {
+		if groups, err = authn.StringsFromClaim(groupsVal); err != nil {
+			return nil, fmt.Errorf("%q claim in token was invalid: %w", a.groupsClaim, err)
+		}
+	}
+
+	id := &authn.Identity{
+		Subject: tkn.Subject(),
+		Emails:  emails,
+		Groups:  groups,
+		Token:   tkn,
+	}
+	// Providers that let users set their own email (e.g. Keycloak with self
+	// registration) tell us if it was verified, and the registry doesn't trust
+	// it if not.
+	if v, ok := tkn.Get("email_verified"); ok {
+		for _, email := range emails {
+			id.SetEmailVerification(email, authn.VerificationFromClaim(v))
+		}
+	}
+	return id, nil
+}
+
+func (a *Auth) parseAndVerify(ctx context.Context, tknStr string) (jwt.Token, error) {
+	// Check the algorithm up front, so that we only ever verify signatures with
+	// algorithms the provider told us it uses.
+	msg, err := jws.Parse([]byte(tknStr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	sigs := msg.Signatures()
+	if len(sigs) != 1 {
+		return nil, fmt.Errorf("token had %d signatures, expected 1", len(sigs))
+	}
+	if alg := sigs[0].ProtectedHeaders().Algorithm(); !a.algs[alg] {
+		return nil, fmt.Errorf("token was signed with unsupported algorithm %q", alg)
+	}
+
+	keySet, err := a.cache.Get(ctx, a.jwksURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider key set from cache: %w", err)
+	}
+
+	opts := []jwt.ParseOption{
+		// Not every provider includes the 'alg' on their keys, so we infer it from
+		// the key type when it's missing, having already restricted the algorithm
+		// above.
+		jwt.WithKeySet(keySet, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidate(true),
+		jwt.WithValidator(jwt.ValidatorFunc(a.validateRequiredClaims)),
+	}
+
+	tkn, err := jwt.Parse([]byte(tknStr), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token against key set: %w", err)
+	}
+
+	return tkn, nil
+}
+
+func (a *Auth) validateRequiredClaims(_ context.Context, tkn jwt.Token) jwt.ValidationError {
+	for name, want := range a.requiredClaims {
+		v, ok := tkn.Get(name)
+		if !ok {
+			return jwt.NewValidationError(fmt.Errorf("token is missing required claim %q", name))
+		}
+		if !claimHasValue(v, want) {
+			return jwt.NewValidationError(fmt.Errorf("claim %q didn't have required value %q", name, want))
+		}
+	}
+	return nil
+}
+
+// claimHasValue reports if the claim is equal to, or is a list containing, the
+// given value. Non-string values like booleans are compared by their string
+// representation.
+func claimHasValue(v any, want string) bool {
+	switch vt := v.(type) {
+	case []any:
+		for _, vi := range vt {
+			if fmt.Sprint(vi) == want {
+				return true
+			}
+		}
+		return false
+	case []string:
+		for _, vi := range vt {
+			if vi == want {
+				return true
+			}
+		}
+		return false
+	default:
+		return fmt.Sprint(v) == want
+	}
+}
@@ -0,0 +1,254 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAuth(t *testing.T) {
+	env := setup(t)
+	auth := env.newAuth(t, &Config{
+		RequiredClaims: map[string]string{"hd": "example.com"},
+	})
+
+	tests := []struct {
+		desc             string
+		tkn              string
+		wantErr          bool
+		wantEmails       []string
+		wantVerification map[string]authn.EmailVerification
+		wantGroups       []string
+	}{
+		{
+			desc:             "valid token",
+			tkn:              env.sign(t, env.claims()),
+			wantEmails:       []string{"user@example.com"},
+			wantVerification: map[string]authn.EmailVerification{"user@example.com": authn.EmailVerified},
+		},
+		{
+			desc: "wrong audience",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				c["aud"] = "some-other-client"
+			})),
+			wantErr: true,
+		},
+		{
+			desc: "wrong issuer",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				c["iss"] = "https://evil.example.com"
+			})),
+			wantErr: true,
+		},
+		{
+			desc: "expired",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				c["exp"] = time.Now().Add(-time.Hour)
+			})),
+			wantErr: true,
+		},
+		{
+			desc: "missing required claim",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				delete(c, "hd")
+			})),
+			wantErr: true,
+		},
+		{
+			desc: "wrong required claim value",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				c["hd"] = "example.net"
+			})),
+			wantErr: true,
+		},
+		{
+			desc:    "unknown key",
+			tkn:     signWithKey(t, newRSAKey(t, "other-key"), jwa.RS256, env.claims()),
+			wantErr: true,
+		},
+		{
+			desc:    "unsupported algorithm",
+			tkn:     signWithKey(t, env.key, jwa.RS512, env.claims()),
+			wantErr: true,
+		},
+		{
+			desc: "unverified email",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				c["email_verified"] = false
+			})),
+			wantEmails:       []string{"user@example.com"},
+			wantVerification: map[string]authn.EmailVerification{"user@example.com": authn.EmailUnverified},
+		},
+		{
+			desc: "no email_verified claim",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				delete(c, "email_verified")
+			})),
+			wantEmails: []string{"user@example.com"},
+		},
+		{
+			desc: "with groups",
+			tkn: env.sign(t, env.claims(func(c map[string]any) {
+				c["groups"] = []string{"partner-users"}
+			})),
+			wantEmails:       []string{"user@example.com"},
+			wantVerification: map[string]authn.EmailVerification{"user@example.com": authn.EmailVerified},
+			wantGroups:       []string{"partner-users"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := auth.Authenticate(context.Background(), test.tkn)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Authenticate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if got.Subject != "user-1" {
+				t.Errorf("identity had subject %q, want %q", got.Subject, "user-1")
+			}
+			if diff := cmp.Diff(test.wantEmails, got.Emails); diff != "" {
+				t.Errorf("unexpected emails (-want +got)\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantVerification, got.EmailVerification); diff != "" {
+				t.Errorf("unexpected email verification (-want +got)\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantGroups, got.Groups); diff != "" {
+				t.Errorf("unexpected groups (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewAuth_IssuerMismatch(t *testing.T) {
+	env := setup(t)
+	env.issuer = "https://issuer.example.com"
+
+	_, err := NewAuth(context.Background(), &Config{
+		Logger:       zaptest.NewLogger(t),
+		DiscoveryURL: env.srv.URL + DiscoveryPath,
+		Audience:     "test-client",
+	})
+	if err == nil || !strings.Contains(err.Error(), "doesn't match discovery URL") {
+		t.Errorf("NewAuth returned error %v, want an issuer mismatch", err)
+	}
+}
+
+type testEnv struct {
+	srv    *httptest.Server
+	key    jwk.Key
+	issuer string
+}
+
+// setup starts a fake OIDC provider, which serves a discovery document and a
+// key set containing one RSA key, without an 'alg' set.
+func setup(t *testing.T) *testEnv {
+	env := &testEnv{key: newRSAKey(t, "test-key")}
+
+	pub, err := env.key.PublicKey()
+	if err != nil {
+		t.Fatalf("failed to get public key: %v", err)
+	}
+	ks := jwk.NewSet()
+	if err := ks.AddKey(pub); err != nil {
+		t.Fatalf("failed to add key to set: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(DiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                env.issuer,
+			"jwks_uri":                              env.srv.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ks)
+	})
+	env.srv = httptest.NewServer(mux)
+	t.Cleanup(env.srv.Close)
+	env.issuer = env.srv.URL
+
+	return env
+}
+
+func (env *testEnv) newAuth(t *testing.T, cfg *Config) *Auth {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg.Logger = zaptest.NewLogger(t)
+	cfg.DiscoveryURL = env.srv.URL + DiscoveryPath
+	cfg.Audience = "test-client"
+	auth, err := NewAuth(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewAuth: %v", err)
+	}
+	return auth
+}
+
+func (env *testEnv) claims(mods ...func(map[string]any)) map[string]any {
+	c := map[string]any{
+		"iss":            env.issuer,
+		"aud":            "test-client",
+		"sub":            "user-1",
+		"exp":            time.Now().Add(time.Hour),
+		"email":          "user@example.com",
+		"email_verified": true,
+		"hd":             "example.com",
+	}
+	for _, mod := range mods {
+		mod(c)
+	}
+	return c
+}
+
+func (env *testEnv) sign(t *testing.T, claims map[string]any) string {
+	return signWithKey(t, env.key, jwa.RS256, claims)
+}
+
+func signWithKey(t *testing.T, key jwk.Key, alg jwa.SignatureAlgorithm, claims map[string]any) string {
+	tkn := jwt.New()
+	for k, v := range claims {
+		if err := tkn.Set(k, v); err != nil {
+			t.Fatalf("failed to set claim %q: %v", k, err)
+		}
+	}
+	signed, err := jwt.Sign(tkn, jwt.WithKey(alg, key))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return string(signed)
+}
+
+func newRSAKey(t *testing.T, kid string) jwk.Key {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		t.Fatalf("failed to make JWK: %v", err)
+	}
+	if err := key.Set(jwk.KeyIDKey, kid); err != nil {
+		t.Fatalf("failed to set key ID: %v", err)
+	}
+	return key
+}
@@ -0,0 +1,160 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	// replayTTL is how long tokens without an 'exp' claim are remembered by the
+	// replay store. Every provider we support sets 'exp', so this is just a
+	// backstop.
+	replayTTL = 24 * time.Hour
+	// replaySweepInterval is how often expired entries are removed from a
+	// MemoryReplayStore.
+	replaySweepInterval = time.Minute
+)
+
+// ErrTokenReplayed is returned by ReplayStore.MarkUsed when the source token
+// was already exchanged.
+var ErrTokenReplayed = errors.New("token was already exchanged")
+
+// ReplayStore records which source tokens were exchanged, so that each can
+// only be exchanged once. Every server instance has to share a ReplayStore, or
+// a token could be exchanged once per instance.
+type ReplayStore interface {
+	// MarkUsed records that the token with the given key was exchanged, or
+	// returns ErrTokenReplayed if it already was. The token can be forgotten
+	// once it expires at exp.
+	MarkUsed(ctx context.Context, key string, exp time.Time) error
+}
+
+// replayKey identifies a source token from the given provider by its 'jti'
+// claim if it has one, and by its hash otherwise.
+func replayKey(provider, tknStr string, tkn jwt.Token) string {
+	key := provider + "|"
+	if jti := tkn.JwtID(); jti != "" {
+		return key + "jti:" + jti
+	}
+	sum := sha256.Sum256([]byte(tknStr))
+	return key + "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// markUsed records that the given token was exchanged, and returns an error if
+// it already had been.
+func (r *Registry) markUsed(ctx context.Context, provider, tknStr string, tkn jwt.Token) error {
+	exp := tkn.Expiration()
+	if exp.IsZero() {
+		exp = r.now().Add(replayTTL)
+	}
+	return r.replay.MarkUsed(ctx, replayKey(provider, tknStr, tkn), exp)
+}
+
+// MemoryReplayStore is a ReplayStore for a single server instance.
+type MemoryReplayStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	used      map[string]time.Time
+	lastSweep time.Time
+}
+
+var _ ReplayStore = (*MemoryReplayStore)(nil)
+
+// NewMemoryReplayStore returns a ReplayStore that keeps exchanged tokens in
+// memory, so it's only correct when there's one instance of the server. If now
+// is nil, time.Now is used.
+func NewMemoryReplayStore(now func() time.Time) *MemoryReplayStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryReplayStore{now: now, used: make(map[string]time.Time)}
+}
+
+func (m *MemoryReplayStore) MarkUsed(_ context.Context, key string, exp time.Time) error {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= replaySweepInterval {
+		for k, e := range m.used {
+			if !now.Before(e) {
+				delete(m.used, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	if e, ok := m.used[key]; ok && now.Before(e) {
+		return ErrTokenReplayed
+	}
+	m.used[key] = exp
+	return nil
+}
+
+// ReplaySchema creates the table that SQLReplayStore records exchanged source
+// tokens in, with their expiry as a Unix timestamp. The schema is compatible
+// with both SQLite and Postgres.
+const ReplaySchema = `CREATE TABLE IF NOT EXISTS used_source_tokens (
+	id         TEXT PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+)`
+
+// SQLReplayStore is a ReplayStore backed by a SQL database (SQLite or
+// Postgres), usually the allowlist database, which server instances can share.
+type SQLReplayStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+var _ ReplayStore = (*SQLReplayStore)(nil)
+
+// NewSQLReplayStore returns a ReplayStore that records exchanged tokens in the
+// database, which should already have the ReplaySchema table. If now is nil,
+// time.Now is used.
+func NewSQLReplayStore(ctx context.Context, db *sql.DB, now func() time.Time) (*SQLReplayStore, error) {
+	if db == nil {
+		return nil, errors.New("no *sql.DB was provided")
+	}
+	if now == nil {
+		now = time.Now
+	}
+	// Fail at startup instead of on the first login if the table is missing.
+	rows, err := db.QueryContext(ctx, `SELECT id FROM used_source_tokens LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query used source tokens table, was it created with authn.ReplaySchema?: %w", err)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+	return &SQLReplayStore{db: db, now: now}, nil
+}
+
+func (s *SQLReplayStore) MarkUsed(ctx context.Context, key string, exp time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM used_source_tokens WHERE expires_at <= $1`, s.now().Unix()); err != nil {
+		return fmt.Errorf("failed to delete expired source tokens: %w", err)
+	}
+	// The primary key makes this atomic across instances: only the first insert
+	// for a token adds a row.
+	res, err := s.db.ExecContext(ctx, `INSERT INTO used_source_tokens (id, expires_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, key, exp.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to record used source token: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrTokenReplayed
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestReplayStores(t *testing.T) {
+	stores := map[string]func(t *testing.T, now func() time.Time) ReplayStore{
+		"memory": func(t *testing.T, now func() time.Time) ReplayStore {
+			return NewMemoryReplayStore(now)
+		},
+		"sql": func(t *testing.T, now func() time.Time) ReplayStore {
+			return newSQLReplayStore(t, setupReplayDB(t), now)
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			s := newStore(t, func() time.Time { return now })
+			exp := now.Add(time.Hour)
+
+			if err := s.MarkUsed(ctx, "azure|jti:token1", exp); err != nil {
+				t.Fatalf("MarkUsed(azure token1): %v", err)
+			}
+			if err := s.MarkUsed(ctx, "okta|jti:token1", exp); err != nil {
+				t.Fatalf("MarkUsed(okta token1): %v", err)
+			}
+			if err := s.MarkUsed(ctx, "azure|jti:token1", exp); !errors.Is(err, ErrTokenReplayed) {
+				t.Fatalf("MarkUsed(azure token1) again = %v, want ErrTokenReplayed", err)
+			}
+
+			// Once tokens expire, they're forgotten.
+			now = exp
+			if err := s.MarkUsed(ctx, "azure|jti:token1", now.Add(time.Hour)); err != nil {
+				t.Fatalf("MarkUsed(azure token1) after expiry: %v", err)
+			}
+		})
+	}
+}
+
+func TestSQLReplayStore_SharedAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	db := setupReplayDB(t)
+	// Two stores sharing a database stand in for two server instances.
+	s1, s2 := newSQLReplayStore(t, db, nil), newSQLReplayStore(t, db, nil)
+	exp := time.Now().Add(time.Hour)
+
+	if err := s1.MarkUsed(ctx, "azure|jti:token1", exp); err != nil {
+		t.Fatalf("first instance MarkUsed: %v", err)
+	}
+	if err := s2.MarkUsed(ctx, "azure|jti:token1", exp); !errors.Is(err, ErrTokenReplayed) {
+		t.Errorf("second instance MarkUsed = %v, want ErrTokenReplayed", err)
+	}
+}
+
+func TestNewSQLReplayStore_NoTable(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "replay.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := NewSQLReplayStore(context.Background(), db, nil); err == nil {
+		t.Error("NewSQLReplayStore returned no error for a database without the used source tokens table")
+	}
+}
+
+func TestReplayKey(t *testing.T) {
+	withJTI := tokenWithClaims(t, map[string]any{"jti": "token1"})
+	if got, want := replayKey("azure", "tkn", withJTI), "azure|jti:token1"; got != want {
+		t.Errorf("replayKey(token with jti) = %q, want %q", got, want)
+	}
+	noJTI := tokenWithClaims(t, nil)
+	if replayKey("azure", "tkn1", noJTI) == replayKey("azure", "tkn2", noJTI) {
+		t.Error("tokens without a jti had the same key")
+	}
+}
+
+func setupReplayDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "replay.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(ReplaySchema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	return db
+}
+
+func newSQLReplayStore(t *testing.T, db *sql.DB, now func() time.Time) *SQLReplayStore {
+	s, err := NewSQLReplayStore(context.Background(), db, now)
+	if err != nil {
+		t.Fatalf("NewSQLReplayStore: %v", err)
+	}
+	return s
+}
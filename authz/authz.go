@@ -0,0 +1,147 @@
+// Package authz provides authorization middleware for downstream services,
+// which checks the sites, roles and OAuth scopes of the verify.Principal added
+// by verify.Verifier.Middleware. Policies are declared alongside routes, e.g.
+//
+//	r.Use(v.Middleware)
+//	r.With(authz.Require(authz.Site(allowlist.SitePACTA))).Get("/projects", listProjects)
+//	r.With(authz.Require(
+//		authz.Site(allowlist.SitePACTA),
+//		authz.AnyRole("admin", "maintainer"),
+//	)).Delete("/projects/{id}", deleteProject)
+//
+// Requests without a principal get a 401 response, and requests whose
+// principal doesn't satisfy the policy get a 403, both with a JSON body like
+// the credential service's own errors.
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/verify"
+)
+
+// Policy checks if a principal is allowed to make a request, and returns an
+// error describing what's missing if not.
+type Policy func(p *verify.Principal) error
+
+// Site requires the principal to have access to the site.
+func Site(site allowlist.Site) Policy {
+	return func(p *verify.Principal) error {
+		if !p.CanAccess(site) {
+			return fmt.Errorf("requires access to site %q", site)
+		}
+		return nil
+	}
+}
+
+// AnyRole requires the principal to have at least one of the roles.
+func AnyRole(roles ...string) Policy {
+	return func(p *verify.Principal) error {
+		for _, r := range roles {
+			if contains(p.Roles, r) {
+				return nil
+			}
+		}
+		return fmt.Errorf("requires one of the roles %q", roles)
+	}
+}
+
+// AllRoles requires the principal to have every one of the roles.
+func AllRoles(roles ...string) Policy {
+	return func(p *verify.Principal) error {
+		for _, r := range roles {
+			if !contains(p.Roles, r) {
+				return fmt.Errorf("requires the role %q", r)
+			}
+		}
+		return nil
+	}
+}
+
+// Scopes requires the token to have been issued with every one of the scopes.
+func Scopes(scopes ...string) Policy {
+	return func(p *verify.Principal) error {
+		for _, s := range scopes {
+			if !contains(p.Scopes, s) {
+				return fmt.Errorf("requires the scope %q", s)
+			}
+		}
+		return nil
+	}
+}
+
+// All requires every one of the policies to pass.
+func All(policies ...Policy) Policy {
+	return func(p *verify.Principal) error {
+		for _, pol := range policies {
+			if err := pol(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Any requires at least one of the policies to pass, e.g. to allow either
+// admins or tokens with a given scope.
+func Any(policies ...Policy) Policy {
+	return func(p *verify.Principal) error {
+		if len(policies) == 0 {
+			return errors.New("no policy allows the request")
+		}
+		var msgs []string
+		for _, pol := range policies {
+			err := pol(p)
+			if err == nil {
+				return nil
+			}
+			msgs = append(msgs, err.Error())
+		}
+		return errors.New(strings.Join(msgs, ", or "))
+	}
+}
+
+// Require returns middleware that only lets requests through if their
+// principal satisfies all of the policies.
+func Require(policies ...Policy) func(http.Handler) http.Handler {
+	policy := All(policies...)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := verify.PrincipalFromContext(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+				return
+			}
+			if err := policy(p); err != nil {
+				writeError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errorResponse matches the 'Error' schema of the credential service's APIs.
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Message: msg})
+}
+
+func contains(list []string, want string) bool {
+	for _, v := range list {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package authz
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/cmd/server/usersrv"
+	"github.com/RMI/credential-service/verify"
+	"github.com/go-chi/chi/v5"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRequire(t *testing.T) {
+	pactaUser := &verify.Principal{Subject: "user1", Sites: []allowlist.Site{allowlist.SitePACTA}}
+	pactaAdmin := &verify.Principal{Subject: "user2", Sites: []allowlist.Site{allowlist.SitePACTA}, Roles: []string{"admin"}}
+	allSites := &verify.Principal{Subject: "user3", AllSites: true, Roles: []string{"maintainer", "auditor"}}
+	scoped := &verify.Principal{Subject: "user4", Sites: []allowlist.Site{allowlist.SitePACTA}, Scopes: []string{"projects:read"}}
+
+	tests := []struct {
+		desc       string
+		policies   []Policy
+		principal  *verify.Principal
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			desc:       "no principal",
+			policies:   []Policy{Site(allowlist.SitePACTA)},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"message":"Unauthorized"}`,
+		},
+		{
+			desc:       "no policies",
+			principal:  pactaUser,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "site allowed",
+			policies:   []Policy{Site(allowlist.SitePACTA)},
+			principal:  pactaUser,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "all sites",
+			policies:   []Policy{Site(allowlist.SiteOPGEE)},
+			principal:  allSites,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "site not allowed",
+			policies:   []Policy{Site(allowlist.SiteOPGEE)},
+			principal:  pactaUser,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"message":"requires access to site \"OPGEE\""}`,
+		},
+		{
+			desc:       "site and role",
+			policies:   []Policy{Site(allowlist.SitePACTA), AnyRole("admin")},
+			principal:  pactaAdmin,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "missing role",
+			policies:   []Policy{Site(allowlist.SitePACTA), AnyRole("admin", "maintainer")},
+			principal:  pactaUser,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"message":"requires one of the roles [\"admin\" \"maintainer\"]"}`,
+		},
+		{
+			desc:       "any role",
+			policies:   []Policy{AnyRole("admin", "maintainer")},
+			principal:  allSites,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "all roles",
+			policies:   []Policy{AllRoles("maintainer", "auditor")},
+			principal:  allSites,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "missing one of all roles",
+			policies:   []Policy{AllRoles("admin", "auditor")},
+			principal:  allSites,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"message":"requires the role \"admin\""}`,
+		},
+		{
+			desc:       "scope",
+			policies:   []Policy{Scopes("projects:read")},
+			principal:  scoped,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "missing scope",
+			policies:   []Policy{Scopes("projects:read", "projects:write")},
+			principal:  scoped,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"message":"requires the scope \"projects:write\""}`,
+		},
+		{
+			desc:       "admin or scope, with scope",
+			policies:   []Policy{Any(AnyRole("admin"), Scopes("projects:read"))},
+			principal:  scoped,
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "admin or scope, with neither",
+			policies:   []Policy{Any(AnyRole("admin"), Scopes("projects:read"))},
+			principal:  pactaUser,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"message":"requires one of the roles [\"admin\"], or requires the scope \"projects:read\""}`,
+		},
+		{
+			desc:       "empty any",
+			policies:   []Policy{Any()},
+			principal:  pactaAdmin,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"message":"no policy allows the request"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			h := Require(test.policies...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.principal != nil {
+				r = r.WithContext(verify.NewContext(r.Context(), test.principal))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if test.wantBody == "" {
+				return
+			}
+			if got := w.Body.String(); got != test.wantBody+"\n" {
+				t.Errorf("body = %q, want %q", got, test.wantBody)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+		})
+	}
+}
+
+func TestRequire_PerRoute(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		// Stand-in for verify.Verifier.Middleware.
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			p := &verify.Principal{Subject: "user1", Sites: []allowlist.Site{allowlist.SitePACTA}}
+			next.ServeHTTP(w, req.WithContext(verify.NewContext(req.Context(), p)))
+		})
+	})
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.With(Require(Site(allowlist.SitePACTA))).Get("/projects", ok)
+	r.With(Require(Site(allowlist.SitePACTA), AnyRole("admin"))).Delete("/projects/{id}", ok)
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{method: http.MethodGet, path: "/projects", wantStatus: http.StatusOK},
+		{method: http.MethodDelete, path: "/projects/123", wantStatus: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s %s returned status %d, want %d", test.method, test.path, w.Code, test.wantStatus)
+		}
+	}
+}
+
+// TestRequire_IssuedTokens checks the policies against tokens issued by the
+// credential service, through verify.Verifier.Middleware.
+func TestRequire_IssuedTokens(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		t.Fatalf("failed to make JWK: %v", err)
+	}
+	key.Set(jwk.KeyIDKey, "key1")
+	issuer := &usersrv.TokenIssuer{
+		Key:           key,
+		Now:           time.Now,
+		SiteAudiences: map[allowlist.Site]string{allowlist.SitePACTA: "pacta.example.com"},
+	}
+	set, err := issuer.PublicKeySet()
+	if err != nil {
+		t.Fatalf("failed to get key set: %v", err)
+	}
+	v, err := verify.New(context.Background(), &verify.Config{
+		Logger:   zaptest.NewLogger(t),
+		KeySet:   set,
+		Audience: "pacta.example.com",
+	})
+	if err != nil {
+		t.Fatalf("verify.New: %v", err)
+	}
+
+	issue := func(roles []string, scope string) string {
+		tkn, _, err := issuer.IssueSiteToken("user1", "azure", "", nil, roles, allowlist.SitePACTA, "", scope, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("failed to issue token: %v", err)
+		}
+		return tkn
+	}
+	user := issue(nil, "")
+	admin := issue([]string{"admin", "viewer"}, "")
+	scoped := issue(nil, "projects:read projects:write")
+
+	r := chi.NewRouter()
+	r.Use(v.Middleware)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.With(Require(Site(allowlist.SitePACTA), AnyRole("admin"))).Delete("/projects/{id}", ok)
+	r.With(Require(AllRoles("admin", "viewer"))).Get("/audit", ok)
+	r.With(Require(Scopes("projects:write"))).Post("/projects", ok)
+
+	tests := []struct {
+		desc       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{desc: "role", method: http.MethodDelete, path: "/projects/123", token: admin, wantStatus: http.StatusOK},
+		{desc: "missing role", method: http.MethodDelete, path: "/projects/123", token: user, wantStatus: http.StatusForbidden},
+		{desc: "all roles", method: http.MethodGet, path: "/audit", token: admin, wantStatus: http.StatusOK},
+		{desc: "scope", method: http.MethodPost, path: "/projects", token: scoped, wantStatus: http.StatusOK},
+		{desc: "missing scope", method: http.MethodPost, path: "/projects", token: admin, wantStatus: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != test.wantStatus {
+				t.Errorf("%s %s returned status %d, want %d: %s", test.method, test.path, w.Code, test.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -1,4 +1,5 @@
-// Package azjwt implements JWT authentication against Azure, which has some
+// Package azjwt implements JWT authentication against Azure, both Azure AD B2C
+// (Auth) and Microsoft Entra ID workforce tenants (EntraAuth), which have some
 // minor peculiarities that require special handling, see
 // https://github.com/lestrrat-go/jwx/issues/395
 package azjwt
@@ -7,26 +8,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
+	"strings"
+	"time"
 
-	"github.com/RMI/credential-service/allowlist"
-	"github.com/RMI/credential-service/tokenctx"
-	"github.com/go-chi/jwtauth/v5"
-	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/RMI/credential-service/authn"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"go.uber.org/zap"
 )
 
 type Auth struct {
-	cache    *jwk.Cache
-	endpoint string
-	logger   *zap.Logger
+	logger *zap.Logger
 
-	allowlist *allowlist.Checker
+	aud string
+	iss string
+	// policies maps the lowercased name of each accepted policy to its key
+	// endpoint.
+	policies map[string]*policy
+}
 
-	aud    string
-	iss    string
-	policy string
+type policy struct {
+	name string
+	keys *keySource
 }
 
 type Config struct {
@@ -36,12 +39,29 @@ type Config struct {
 	Tenant string
 	// TenantID (also called the directory ID), is used as the issuer ('iss' claim) in JWTs, formatted as a UUID
 	TenantID string
-	// Policy is the name of the user flow/policy, usually named B2C_<number>_<name>
-	Policy string
+	// Policies are the names of the user flows/custom policies that tokens are
+	// accepted from, usually named B2C_<number>_<name> or B2C_1A_<name>. Each
+	// one has its own key endpoint.
+	Policies []string
 	// ClientID (also called the application ID) is used as the audience ('aud' claim) in JWTs, formatted as a UUID
 	ClientID string
 
-	Allowlist *allowlist.Checker
+	// BaseURL overrides https://<tenant>.b2clogin.com, the URL that keys are
+	// loaded from and that tokens are issued by. It's only meant for testing
+	// against a fake B2C tenant, like the one in //azure/fakeb2c.
+	BaseURL string
+
+	// MinKeyRefreshInterval limits how often the keys of a policy are refreshed
+	// on demand, when a token is signed with an unknown key (e.g. after Azure
+	// rotates its keys). Defaults to DefaultMinKeyRefreshInterval.
+	MinKeyRefreshInterval time.Duration
+	// MaxKeyStaleness is how long the last successfully loaded keys of a policy
+	// are used for while the key endpoint can't be reached, after which tokens
+	// from that policy are rejected. Defaults to DefaultMaxKeyStaleness.
+	MaxKeyStaleness time.Duration
+
+	// Now is used to track the age of loaded keys, defaults to time.Now.
+	Now func() time.Time
 }
 
 func (c *Config) validate() error {
@@ -55,15 +75,28 @@ func (c *Config) validate() error {
 	if c.TenantID == "" {
 		return errors.New("no tenantID was provided")
 	}
-	if c.Policy == "" {
-		return errors.New("no policy was provided")
+	if len(c.Policies) == 0 {
+		return errors.New("no policies were provided")
+	}
+	seen := make(map[string]bool)
+	for _, p := range c.Policies {
+		if p == "" {
+			return errors.New("an empty policy was provided")
+		}
+		// B2C treats policy names case-insensitively.
+		if seen[strings.ToLower(p)] {
+			return fmt.Errorf("policy %q was provided more than once", p)
+		}
+		seen[strings.ToLower(p)] = true
 	}
 	if c.ClientID == "" {
 		return errors.New("no clientID was provided")
 	}
-
-	if c.Allowlist == nil {
-		return errors.New("no *allowlist.Checker was provided")
+	if c.MinKeyRefreshInterval < 0 {
+		return errors.New("minKeyRefreshInterval can't be negative")
+	}
+	if c.MaxKeyStaleness < 0 {
+		return errors.New("maxKeyStaleness can't be negative")
 	}
 
 	return nil
@@ -74,200 +107,166 @@ func NewAuth(ctx context.Context, cfg *Config) (*Auth, error) {
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
-	// See also https://<tenant>.b2clogin.com/<tenant>.onmicrosoft.com/<policy>/v2.0/.well-known/openid-configuration
-	endpoint := fmt.Sprintf("https://%s.b2clogin.com/%s.onmicrosoft.com/%s/discovery/v2.0/keys", cfg.Tenant, cfg.Tenant, cfg.Policy)
-	cache := jwk.NewCache(ctx)
-	if err := cache.Register(endpoint); err != nil {
-		return nil, fmt.Errorf("failed to register JWT key endpoint: %w", err)
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s.b2clogin.com", cfg.Tenant)
 	}
-	if _, err := cache.Refresh(ctx, endpoint); err != nil {
-		return nil, fmt.Errorf("failed to load key set from endpoint: %w", err)
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	opts := newKeyOptions(cfg.MinKeyRefreshInterval, cfg.MaxKeyStaleness, cfg.Now)
+	cache := newKeyCache(ctx, cfg.Logger)
+	policies := make(map[string]*policy)
+	for _, p := range cfg.Policies {
+		// See also https://<tenant>.b2clogin.com/<tenant>.onmicrosoft.com/<policy>/v2.0/.well-known/openid-configuration
+		endpoint := fmt.Sprintf("%s/%s.onmicrosoft.com/%s/discovery/v2.0/keys", baseURL, cfg.Tenant, p)
+		ks, err := newKeySource(ctx, cache, endpoint, cfg.Logger.With(zap.String("policy", p)), opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init keys for policy %q: %w", p, err)
+		}
+		policies[strings.ToLower(p)] = &policy{name: p, keys: ks}
 	}
 	return &Auth{
-		cache:     cache,
-		endpoint:  endpoint,
-		logger:    cfg.Logger,
-		allowlist: cfg.Allowlist,
+		logger: cfg.Logger,
 
-		aud:    cfg.ClientID,
-		iss:    fmt.Sprintf("https://%s.b2clogin.com/%s/v2.0/", cfg.Tenant, cfg.TenantID),
-		policy: cfg.Policy,
+		aud:      cfg.ClientID,
+		iss:      fmt.Sprintf("%s/%s/v2.0/", baseURL, cfg.TenantID),
+		policies: policies,
 	}, nil
 }
 
-func (a *Auth) Verifier(next http.Handler) http.Handler {
-	hfn := func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		existingTkn, _, _ := jwtauth.FromContext(ctx)
-		// Previous middleware has already set up auth, continue
-		if existingTkn != nil {
-			next.ServeHTTP(w, r)
-			return
-		}
-		tkn, err := a.parseAndVerify(ctx, r)
-		ctx = jwtauth.NewContext(ctx, tkn, err)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	}
-	return http.HandlerFunc(hfn)
+// Issuer returns the 'iss' claim of tokens issued by the Azure AD B2C tenant.
+func (a *Auth) Issuer() string {
+	return a.iss
 }
 
-func (a *Auth) Authenticator(next http.Handler) http.Handler {
-	hfn := func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth verification if they're logging out.
-		if r.URL.Path == "/logout/cookie" && r.Method == http.MethodPost {
-			next.ServeHTTP(w, r)
-			return
-		}
+// Authenticate verifies a Microsoft-issued ID token, and returns the identity
+// it belongs to.
+func (a *Auth) Authenticate(ctx context.Context, tknStr string) (*authn.Identity, error) {
+	tkn, p, err := a.parseAndVerify(ctx, tknStr)
+	if err != nil {
+		return nil, err
+	}
 
-		token, _, err := jwtauth.FromContext(r.Context())
-		if err != nil {
-			a.logger.Warn("token failed validation", zap.Error(err))
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+	// See https://learn.microsoft.com/en-us/azure/active-directory/develop/id-token-claims-reference
+	emailsVal, ok := tkn.Get("emails")
+	if !ok {
+		return nil, errors.New("token didn't contain an 'emails' claim")
+	}
+	emails, err := authn.StringsFromClaim(emailsVal)
+	if err != nil {
+		return nil, fmt.Errorf("'emails' claim in token was invalid: %w", err)
+	}
 
-		if token == nil {
-			a.logger.Warn("no token found in request", zap.Error(err))
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	// The 'groups' claim is only present if the app registration is configured
+	// to emit it.
+	var groups []string
+	if groupsVal, ok := tkn.Get("groups"); ok {
+		if groups, err = authn.StringsFromClaim(groupsVal); err != nil {
+			return nil, fmt.Errorf("'groups' claim in token was invalid: %w", err)
 		}
+	}
 
-		if err := jwt.Validate(token); err != nil {
-			a.logger.Warn("token failed validation", zap.Error(err))
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
+	id := &authn.Identity{
+		Subject: tkn.Subject(),
+		Emails:  emails,
+		Groups:  groups,
+		Policy:  p.name,
+		Token:   tkn,
+	}
+	// Built-in user flows verify local account emails before issuing a token,
+	// but don't say so. Custom policies (e.g. ones federating with other
+	// identity providers) can output an 'email_verified' claim, which applies
+	// to every address in 'emails'.
+	if v, ok := tkn.Get("email_verified"); ok {
+		for _, email := range emails {
+			id.SetEmailVerification(email, authn.VerificationFromClaim(v))
 		}
+	}
+	return id, nil
+}
 
-		// Now, check against the allowlist
-		allowedEmails, entity, err := a.checkEmailAllowed(token)
-		if err != nil {
-			a.logger.Warn("token failed allowlist check", zap.Error(err))
-			if errors.Is(err, errNotAllowlisted) {
-				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-			} else {
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			}
-			return
+// policyFromToken returns the policy that issued the token. User flows set
+// the 'tfp' claim, custom policies can be configured to set 'acr' instead, see
+// https://learn.microsoft.com/en-us/azure/active-directory-b2c/tokens-overview#claims
+func policyFromToken(tkn jwt.Token) (string, error) {
+	for _, claim := range []string{"tfp", "acr"} {
+		v, ok := tkn.Get(claim)
+		if !ok {
+			continue
 		}
-
-		// Add the email to the context so that it can be used by the handler
-		ctx := tokenctx.AddEmailsToContext(r.Context(), allowedEmails)
-		ctx = tokenctx.AddAllowlistEntityToContext(ctx, entity)
-		// Token is authenticated, pass it through
-		next.ServeHTTP(w, r.WithContext(ctx))
+		p, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("%q claim had type %T", claim, v)
+		}
+		return p, nil
 	}
-	return http.HandlerFunc(hfn)
+	return "", errors.New("token had neither a 'tfp' nor an 'acr' claim")
 }
 
-func (a *Auth) parseAndVerify(ctx context.Context, r *http.Request) (jwt.Token, error) {
-	// We only accept the token in the header, as opposed to actual end-user APIs,
-	// which will accept the token in the header ('Authorization: BEARER <tkn>') or in
-	// a cookie ('jwt=<tkn> ...')
-	tknStr := jwtauth.TokenFromHeader(r)
-	if tknStr == "" {
-		return nil, jwtauth.ErrNoTokenFound
+func (a *Auth) lookupPolicy(tkn jwt.Token) (*policy, error) {
+	name, err := policyFromToken(tkn)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := a.policies[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("token was issued by unknown policy %q", name)
 	}
+	return p, nil
+}
 
-	keySet, err := a.cache.Get(ctx, a.endpoint)
+func (a *Auth) parseAndVerify(ctx context.Context, tknStr string) (jwt.Token, *policy, error) {
+	// Each policy has its own keys, so we need to know which policy the token
+	// claims to be from before we can verify it. That's fine to read from the
+	// unverified token, as the claim is covered by the signature we then verify
+	// with that policy's keys.
+	unverified, err := jwt.ParseInsecure([]byte(tknStr))
 	if err != nil {
-		return nil, fmt.Errorf("failed to load Microsoft auth key set from cache: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	p, err := a.lookupPolicy(unverified)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// This is needed because Microsoft doesn't include the "alg" header in their
-	// keyset descriptions, see https://github.com/lestrrat-go/jwx/issues/395
-	// We know the algorithm in use is 256-bit RSA, so we set that manually so that
-	// jwt.Parse correctly matches up the keys below.
-	// The alternative would be to use jwt.InferAlgorithmFromKey(), but that
-	// involves just trying algos until one works, which isn't great.
-	ks := jwk.NewSet()
-	ki := keySet.Keys(ctx)
-	for ki.Next(ctx) {
-		k, ok := ki.Pair().Value.(jwk.Key)
-		if !ok {
-			return nil, fmt.Errorf("failed to load key from key set, had type %T", ki.Pair().Value)
-		}
-		if err := k.Set("alg", "RS256"); err != nil {
-			return nil, fmt.Errorf("failed to set 'alg' on key %q: %w", k.KeyID(), err)
-		}
-		if err := ks.AddKey(k); err != nil {
-			return nil, fmt.Errorf("failed to add key %q to key set: %w", k.KeyID(), err)
-		}
+	kid, err := keyIDFromToken(tknStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	ks, err := p.keys.keySet(ctx, kid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load Microsoft auth key set for policy %q: %w", p.name, err)
 	}
 
 	opts := []jwt.ParseOption{
 		// See https://learn.microsoft.com/en-us/azure/active-directory-b2c/tokens-overview#validate-claims
-		// TODO: Consider verifying the 'nonce' claim as well.
+		// The 'nonce' and 'auth_time' claims are checked for every provider by
+		// authn.Registry, when configured.
 		jwt.WithKeySet(ks),
 		jwt.WithAudience(a.aud),
 		jwt.WithIssuer(a.iss),
 		jwt.WithValidate(true),
-		jwt.WithClaimValue("tfp", a.policy),
 	}
 
 	tkn, err := jwt.Parse([]byte(tknStr), opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to validate token against key set: %w", err)
+		return nil, nil, fmt.Errorf("failed to validate token against key set for policy %q: %w", p.name, err)
 	}
 
-	return tkn, nil
+	return tkn, p, nil
 }
 
-var errNotAllowlisted = errors.New("email isn't allowlisted")
-
-func (a *Auth) checkEmailAllowed(tkn jwt.Token) ([]string, *allowlist.Entity, error) {
-	// See https://learn.microsoft.com/en-us/azure/active-directory/develop/id-token-claims-reference
-	emailsVal, ok := tkn.Get("emails")
-	if !ok {
-		return nil, nil, errors.New("token didn't contain an 'emails' claim")
-	}
-	emailsI, ok := emailsVal.([]any)
-	if !ok {
-		return nil, nil, fmt.Errorf("'emails' claim in token had unexpected type %T", emailsVal)
-	}
-
-	var emails []string
-	for i, ei := range emailsI {
-		email, ok := ei.(string)
-		if !ok {
-			return nil, nil, fmt.Errorf("email %d from 'emails' claim in token had unexpected type %T", i, ei)
-		}
-		emails = append(emails, email)
-	}
-
-	// If one of their emails is allowed, consider them allowed.
-	allowed, entity := a.allowedEmails(emails)
-	if len(allowed) == 0 {
-		return nil, nil, errNotAllowlisted
+func keyIDFromToken(tknStr string) (string, error) {
+	msg, err := jws.Parse([]byte(tknStr))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse token signature: %w", err)
 	}
-
-	return allowed, entity, nil
-}
-
-func (a *Auth) allowedEmails(emails []string) ([]string, *allowlist.Entity) {
-	var (
-		outEmails     []string
-		allowAllSites bool
-		sites         []allowlist.Site
-	)
-	for _, email := range emails {
-		entity, err := a.allowlist.Check(email)
-		if err != nil {
-			a.logger.Warn("failed to check allowlist", zap.String("email", email), zap.Error(err))
-			continue
-		}
-		if entity == nil {
-			continue
-		}
-		if entity.AllowAllSites {
-			allowAllSites = true
-		}
-		sites = append(sites, entity.AllowedSites...)
-		outEmails = append(outEmails, email)
+	sigs := msg.Signatures()
+	if len(sigs) != 1 {
+		return "", fmt.Errorf("token had %d signatures, expected one", len(sigs))
 	}
-	var entity *allowlist.Entity
-	if allowAllSites {
-		entity = &allowlist.Entity{AllowAllSites: true}
-	} else {
-		entity = &allowlist.Entity{AllowedSites: sites}
+	kid := sigs[0].ProtectedHeaders().KeyID()
+	if kid == "" {
+		return "", errors.New("token had no 'kid' header")
 	}
-	return outEmails, entity
+	return kid, nil
 }
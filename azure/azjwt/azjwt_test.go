@@ -0,0 +1,297 @@
+package azjwt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/azure/fakeb2c"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAuthenticate(t *testing.T) {
+	fb, auth, _ := setup(t, time.Now)
+
+	tests := []struct {
+		desc    string
+		emails  []string
+		extra   map[string]any
+		want    *authn.Identity
+		wantErr bool
+	}{
+		{
+			desc:   "valid token",
+			emails: []string{"user@example.com"},
+			want: &authn.Identity{
+				Subject: "user123",
+				Emails:  []string{"user@example.com"},
+				Policy:  "B2C_1_susi_test",
+			},
+		},
+		{
+			desc:   "other policy",
+			emails: []string{"user@example.com"},
+			extra:  map[string]any{"tfp": "B2C_1_invite_test"},
+			want: &authn.Identity{
+				Subject: "user123",
+				Emails:  []string{"user@example.com"},
+				Policy:  "B2C_1_invite_test",
+			},
+		},
+		{
+			desc:   "policy with different case",
+			emails: []string{"user@example.com"},
+			extra:  map[string]any{"tfp": "b2c_1_susi_test"},
+			want: &authn.Identity{
+				Subject: "user123",
+				Emails:  []string{"user@example.com"},
+				Policy:  "B2C_1_susi_test",
+			},
+		},
+		{
+			desc:   "custom policy in 'acr' claim",
+			emails: []string{"user@example.com"},
+			extra:  map[string]any{"acr": "B2C_1A_partner"},
+			want: &authn.Identity{
+				Subject: "user123",
+				Emails:  []string{"user@example.com"},
+				Policy:  "B2C_1A_partner",
+			},
+		},
+		{
+			desc:   "with groups",
+			emails: []string{"user@example.com"},
+			extra:  map[string]any{"groups": []string{"opgee-users"}},
+			want: &authn.Identity{
+				Subject: "user123",
+				Emails:  []string{"user@example.com"},
+				Groups:  []string{"opgee-users"},
+				Policy:  "B2C_1_susi_test",
+			},
+		},
+		{
+			desc:    "wrong policy",
+			emails:  []string{"user@example.com"},
+			extra:   map[string]any{"tfp": "B2C_1_other"},
+			wantErr: true,
+		},
+		{
+			desc:    "wrong audience",
+			emails:  []string{"user@example.com"},
+			extra:   map[string]any{"aud": []string{"some-other-client"}},
+			wantErr: true,
+		},
+		{
+			desc:    "wrong issuer",
+			emails:  []string{"user@example.com"},
+			extra:   map[string]any{"iss": "https://evil.example.com/v2.0/"},
+			wantErr: true,
+		},
+		{
+			desc:    "expired",
+			emails:  []string{"user@example.com"},
+			extra:   map[string]any{"exp": time.Now().Add(-time.Hour)},
+			wantErr: true,
+		},
+		{
+			desc:    "no emails",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			tkn, err := fb.IssueToken("user123", test.emails, test.extra)
+			if err != nil {
+				t.Fatalf("failed to issue token: %v", err)
+			}
+
+			got, err := auth.Authenticate(context.Background(), tkn)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Authenticate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(authn.Identity{}, "Token")); diff != "" {
+				t.Errorf("unexpected identity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_KeyRotation(t *testing.T) {
+	clk := &fakeClock{now: time.Now()}
+	fb, auth, keys := setup(t, clk.Now)
+
+	authenticate := func() error {
+		tkn, err := fb.IssueToken("user123", []string{"user@example.com"}, nil)
+		if err != nil {
+			t.Fatalf("failed to issue token: %v", err)
+		}
+		_, err = auth.Authenticate(context.Background(), tkn)
+		return err
+	}
+
+	if err := authenticate(); err != nil {
+		t.Fatalf("Authenticate with initial keys: %v", err)
+	}
+
+	// A token signed with a new key triggers a refresh.
+	if err := fb.RotateKeys(); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+	if err := authenticate(); err != nil {
+		t.Fatalf("Authenticate after rotating keys: %v", err)
+	}
+	if got, want := keys.fetches(), 2; got != want {
+		t.Errorf("keys were fetched %d times, want %d", got, want)
+	}
+
+	// But not more than once per MinKeyRefreshInterval.
+	if err := fb.RotateKeys(); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+	if err := authenticate(); err == nil {
+		t.Error("Authenticate right after the last refresh succeeded, want an error")
+	}
+	if got, want := keys.fetches(), 2; got != want {
+		t.Errorf("keys were fetched %d times, want %d", got, want)
+	}
+
+	clk.Advance(2 * time.Minute)
+	if err := authenticate(); err != nil {
+		t.Fatalf("Authenticate after MinKeyRefreshInterval: %v", err)
+	}
+	if got, want := keys.fetches(), 3; got != want {
+		t.Errorf("keys were fetched %d times, want %d", got, want)
+	}
+}
+
+func TestAuthenticate_KeyEndpointDown(t *testing.T) {
+	clk := &fakeClock{now: time.Now()}
+	fb, auth, keys := setup(t, clk.Now)
+
+	tkn, err := fb.IssueToken("user123", []string{"user@example.com"}, nil)
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	keys.setDown(true)
+
+	// The last loaded keys are still used.
+	clk.Advance(time.Hour)
+	if _, err := auth.Authenticate(context.Background(), tkn); err != nil {
+		t.Fatalf("Authenticate with endpoint down: %v", err)
+	}
+
+	// Until they're too old.
+	clk.Advance(DefaultMaxKeyStaleness)
+	if _, err := auth.Authenticate(context.Background(), tkn); err == nil {
+		t.Fatal("Authenticate with stale keys succeeded, want an error")
+	}
+
+	// Once the endpoint is back, the keys are refreshed.
+	keys.setDown(false)
+	clk.Advance(2 * time.Minute)
+	if _, err := auth.Authenticate(context.Background(), tkn); err != nil {
+		t.Fatalf("Authenticate after endpoint recovered: %v", err)
+	}
+}
+
+func setup(t *testing.T, now func() time.Time) (*fakeb2c.Server, *Auth, *keyEndpoint) {
+	fb, err := fakeb2c.New(&fakeb2c.Config{
+		Tenant:   "rmitest",
+		TenantID: "00000000-0000-0000-0000-000000000001",
+		Policies: []string{"B2C_1_susi_test", "B2C_1_invite_test", "B2C_1A_partner"},
+		ClientID: "00000000-0000-0000-0000-000000000002",
+	})
+	if err != nil {
+		t.Fatalf("failed to create fake B2C tenant: %v", err)
+	}
+	keys := &keyEndpoint{h: fb, path: "/rmitest.onmicrosoft.com/B2C_1_susi_test/discovery/v2.0/keys"}
+	srv := httptest.NewServer(keys)
+	t.Cleanup(srv.Close)
+	fb.BaseURL = srv.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	auth, err := NewAuth(ctx, &Config{
+		Logger:   zaptest.NewLogger(t),
+		Tenant:   "rmitest",
+		TenantID: "00000000-0000-0000-0000-000000000001",
+		Policies: []string{"B2C_1_susi_test", "B2C_1_invite_test", "B2C_1A_partner"},
+		ClientID: "00000000-0000-0000-0000-000000000002",
+		BaseURL:  srv.URL,
+		Now:      now,
+	})
+	if err != nil {
+		t.Fatalf("NewAuth: %v", err)
+	}
+	if got, want := auth.Issuer(), fb.Issuer(); got != want {
+		t.Fatalf("auth has issuer %q, fake tenant has %q", got, want)
+	}
+	return fb, auth, keys
+}
+
+// keyEndpoint wraps the fake tenant, to count and fail requests for the keys
+// of one policy.
+type keyEndpoint struct {
+	h    http.Handler
+	path string
+
+	mu    sync.Mutex
+	down  bool
+	count int
+}
+
+func (k *keyEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == k.path {
+		k.mu.Lock()
+		k.count++
+		down := k.down
+		k.mu.Unlock()
+		if down {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	k.h.ServeHTTP(w, r)
+}
+
+func (k *keyEndpoint) fetches() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.count
+}
+
+func (k *keyEndpoint) setDown(down bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.down = down
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,238 @@
+package azjwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+)
+
+// EntraAuth verifies ID tokens from Microsoft Entra ID (formerly Azure AD)
+// workforce tenants, which is how most partner organizations sign in, as
+// opposed to the B2C tenant that Auth handles. Tokens are accepted from an
+// explicit list of tenants, each of which has its own issuer.
+type EntraAuth struct {
+	logger *zap.Logger
+
+	aud     string
+	issuers []string
+	// tenants maps the lowercased ID of each allowed tenant to its issuer and
+	// keys.
+	tenants map[string]*tenant
+}
+
+type tenant struct {
+	id   string
+	iss  string
+	keys *keySource
+}
+
+type EntraConfig struct {
+	Logger *zap.Logger
+
+	// TenantIDs are the directory IDs of the tenants whose users can sign in,
+	// formatted as UUIDs. Each one issues tokens with an 'iss' claim of
+	// https://login.microsoftonline.com/<tenant ID>/v2.0, and a matching 'tid'
+	// claim.
+	TenantIDs []string
+	// ClientID (also called the application ID) is used as the audience ('aud'
+	// claim) in JWTs, formatted as a UUID. For more than one tenant, the app
+	// registration should be multi-tenant.
+	ClientID string
+
+	// BaseURL overrides https://login.microsoftonline.com, the URL that keys
+	// are loaded from and that tokens are issued by. It's only meant for
+	// testing.
+	BaseURL string
+
+	// MinKeyRefreshInterval, MaxKeyStaleness and Now have the same meaning as
+	// in Config, and apply to the keys of each tenant.
+	MinKeyRefreshInterval time.Duration
+	MaxKeyStaleness       time.Duration
+	Now                   func() time.Time
+}
+
+func (c *EntraConfig) validate() error {
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+
+	if len(c.TenantIDs) == 0 {
+		return errors.New("no tenantIDs were provided")
+	}
+	seen := make(map[string]bool)
+	for _, id := range c.TenantIDs {
+		if id == "" {
+			return errors.New("an empty tenantID was provided")
+		}
+		switch strings.ToLower(id) {
+		case "common", "organizations", "consumers":
+			// These aren't tenants, and would let in users from any tenant.
+			return fmt.Errorf("%q isn't a tenant ID, list the allowed tenants explicitly", id)
+		}
+		if seen[strings.ToLower(id)] {
+			return fmt.Errorf("tenantID %q was provided more than once", id)
+		}
+		seen[strings.ToLower(id)] = true
+	}
+	if c.ClientID == "" {
+		return errors.New("no clientID was provided")
+	}
+	if c.MinKeyRefreshInterval < 0 {
+		return errors.New("minKeyRefreshInterval can't be negative")
+	}
+	if c.MaxKeyStaleness < 0 {
+		return errors.New("maxKeyStaleness can't be negative")
+	}
+
+	return nil
+}
+
+// NewEntraAuth returns a client capable of verifying JWT tokens from the given
+// Microsoft Entra ID tenants.
+func NewEntraAuth(ctx context.Context, cfg *EntraConfig) (*EntraAuth, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://login.microsoftonline.com"
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	opts := newKeyOptions(cfg.MinKeyRefreshInterval, cfg.MaxKeyStaleness, cfg.Now)
+	cache := newKeyCache(ctx, cfg.Logger)
+	tenants := make(map[string]*tenant)
+	var issuers []string
+	for _, id := range cfg.TenantIDs {
+		// See also https://login.microsoftonline.com/<tenant ID>/v2.0/.well-known/openid-configuration
+		endpoint := fmt.Sprintf("%s/%s/discovery/v2.0/keys", baseURL, id)
+		ks, err := newKeySource(ctx, cache, endpoint, cfg.Logger.With(zap.String("tenant_id", id)), opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init keys for tenant %q: %w", id, err)
+		}
+		iss := fmt.Sprintf("%s/%s/v2.0", baseURL, id)
+		tenants[strings.ToLower(id)] = &tenant{id: id, iss: iss, keys: ks}
+		issuers = append(issuers, iss)
+	}
+	return &EntraAuth{
+		logger:  cfg.Logger,
+		aud:     cfg.ClientID,
+		issuers: issuers,
+		tenants: tenants,
+	}, nil
+}
+
+// Issuer returns the issuer of the first allowed tenant, see Issuers.
+func (a *EntraAuth) Issuer() string {
+	return a.issuers[0]
+}
+
+// Issuers returns the 'iss' claims of tokens issued by each of the allowed
+// tenants, which implements authn.MultiIssuer.
+func (a *EntraAuth) Issuers() []string {
+	return a.issuers
+}
+
+// Authenticate verifies an Entra ID-issued ID token, and returns the identity
+// it belongs to.
+func (a *EntraAuth) Authenticate(ctx context.Context, tknStr string) (*authn.Identity, error) {
+	tkn, err := a.parseAndVerify(ctx, tknStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Workforce tenants don't have an 'emails' claim. 'email' is an optional
+	// claim that has to be configured on the app registration, and
+	// 'preferred_username' is usually the user's UPN, which is an email
+	// address for most organizations. See
+	// https://learn.microsoft.com/en-us/entra/identity-platform/id-token-claims-reference
+	//
+	// Tenant admins can set both of these to any address (see "nOAuth"), so we
+	// treat them as unverified, except for 'email' when the optional 'xms_edov'
+	// claim says the tenant verified its domain.
+	id := &authn.Identity{Subject: tkn.Subject(), Token: tkn}
+	edov, _ := tkn.Get("xms_edov")
+	var emails []string
+	seen := make(map[string]bool)
+	for _, claim := range []string{"email", "preferred_username"} {
+		v, ok := tkn.Get(claim)
+		if !ok {
+			continue
+		}
+		email, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%q claim in token had type %T", claim, v)
+		}
+		if !strings.Contains(email, "@") || seen[strings.ToLower(email)] {
+			continue
+		}
+		seen[strings.ToLower(email)] = true
+		emails = append(emails, email)
+		if claim == "email" {
+			id.SetEmailVerification(email, authn.VerificationFromClaim(edov))
+		} else {
+			id.SetEmailVerification(email, authn.EmailUnverified)
+		}
+	}
+	if len(emails) == 0 {
+		return nil, errors.New("token didn't contain an email address in its 'email' or 'preferred_username' claims")
+	}
+
+	var groups []string
+	if groupsVal, ok := tkn.Get("groups"); ok {
+		if groups, err = authn.StringsFromClaim(groupsVal); err != nil {
+			return nil, fmt.Errorf("'groups' claim in token was invalid: %w", err)
+		}
+	}
+
+	id.Emails = emails
+	id.Groups = groups
+	return id, nil
+}
+
+func (a *EntraAuth) parseAndVerify(ctx context.Context, tknStr string) (jwt.Token, error) {
+	// Like policies in B2C, each tenant has its own keys and issuer, so we find
+	// the tenant before verifying the token with its keys.
+	unverified, err := jwt.ParseInsecure([]byte(tknStr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	tidVal, ok := unverified.Get("tid")
+	if !ok {
+		return nil, errors.New("token didn't contain a 'tid' claim")
+	}
+	tid, ok := tidVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("'tid' claim had type %T", tidVal)
+	}
+	t, ok := a.tenants[strings.ToLower(tid)]
+	if !ok {
+		return nil, fmt.Errorf("token was issued by tenant %q, which isn't allowed", tid)
+	}
+
+	kid, err := keyIDFromToken(tknStr)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := t.keys.keySet(ctx, kid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Microsoft auth key set for tenant %q: %w", t.id, err)
+	}
+
+	tkn, err := jwt.Parse([]byte(tknStr),
+		jwt.WithKeySet(ks),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(t.iss),
+		jwt.WithValidate(true),
+		jwt.WithClaimValue("tid", tid),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token against key set for tenant %q: %w", t.id, err)
+	}
+	return tkn, nil
+}
@@ -0,0 +1,290 @@
+package azjwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/authn"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	partnerTenant = "11111111-1111-1111-1111-111111111111"
+	otherTenant   = "22222222-2222-2222-2222-222222222222"
+	unknownTenant = "33333333-3333-3333-3333-333333333333"
+	entraClientID = "00000000-0000-0000-0000-000000000003"
+)
+
+func TestEntraAuthenticate(t *testing.T) {
+	fe := newFakeEntra(t, partnerTenant, otherTenant, unknownTenant)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	auth, err := NewEntraAuth(ctx, &EntraConfig{
+		Logger:    zaptest.NewLogger(t),
+		TenantIDs: []string{partnerTenant, otherTenant},
+		ClientID:  entraClientID,
+		BaseURL:   fe.srv.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewEntraAuth: %v", err)
+	}
+	wantIssuers := []string{fe.issuer(partnerTenant), fe.issuer(otherTenant)}
+	if diff := cmp.Diff(wantIssuers, auth.Issuers()); diff != "" {
+		t.Fatalf("unexpected issuers (-want +got)\n%s", diff)
+	}
+
+	tests := []struct {
+		desc string
+		// signer is the tenant whose key signs the token, defaults to tid.
+		signer  string
+		claims  map[string]any
+		want    *authn.Identity
+		wantErr bool
+	}{
+		{
+			desc: "email and UPN",
+			claims: map[string]any{
+				"tid":                partnerTenant,
+				"email":              "user@partner.example.com",
+				"preferred_username": "USER@partner.example.com",
+				"groups":             []string{"opgee-users"},
+			},
+			want: &authn.Identity{
+				Subject:           "user123",
+				Emails:            []string{"user@partner.example.com"},
+				Groups:            []string{"opgee-users"},
+				EmailVerification: map[string]authn.EmailVerification{"user@partner.example.com": authn.EmailUnverified},
+			},
+		},
+		{
+			desc: "only UPN, from second tenant",
+			claims: map[string]any{
+				"tid":                otherTenant,
+				"preferred_username": "user@other.example.com",
+			},
+			want: &authn.Identity{
+				Subject:           "user123",
+				Emails:            []string{"user@other.example.com"},
+				EmailVerification: map[string]authn.EmailVerification{"user@other.example.com": authn.EmailUnverified},
+			},
+		},
+		{
+			desc: "email domain verified",
+			claims: map[string]any{
+				"tid":                partnerTenant,
+				"email":              "user@partner.example.com",
+				"preferred_username": "upn@partner.example.com",
+				"xms_edov":           true,
+			},
+			want: &authn.Identity{
+				Subject: "user123",
+				Emails:  []string{"user@partner.example.com", "upn@partner.example.com"},
+				EmailVerification: map[string]authn.EmailVerification{
+					"user@partner.example.com": authn.EmailVerified,
+					"upn@partner.example.com":  authn.EmailUnverified,
+				},
+			},
+		},
+		{
+			desc: "email domain not verified",
+			claims: map[string]any{
+				"tid":                partnerTenant,
+				"email":              "user@partner.example.com",
+				"preferred_username": "upn@partner.example.com",
+				"xms_edov":           false,
+			},
+			want: &authn.Identity{
+				Subject: "user123",
+				Emails:  []string{"user@partner.example.com", "upn@partner.example.com"},
+				EmailVerification: map[string]authn.EmailVerification{
+					"user@partner.example.com": authn.EmailUnverified,
+					"upn@partner.example.com":  authn.EmailUnverified,
+				},
+			},
+		},
+		{
+			desc: "UPN isn't an email",
+			claims: map[string]any{
+				"tid":                partnerTenant,
+				"preferred_username": "+15555550100",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "tenant not allowed",
+			claims: map[string]any{
+				"tid":   unknownTenant,
+				"email": "user@unknown.example.com",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "no tid",
+			claims: map[string]any{
+				"tid":   nil,
+				"email": "user@partner.example.com",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "issuer doesn't match tid",
+			claims: map[string]any{
+				"tid":   partnerTenant,
+				"iss":   fe.issuer(otherTenant),
+				"email": "user@partner.example.com",
+			},
+			wantErr: true,
+		},
+		{
+			desc:   "signed by another tenant",
+			signer: otherTenant,
+			claims: map[string]any{
+				"tid":   partnerTenant,
+				"email": "user@partner.example.com",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "wrong audience",
+			claims: map[string]any{
+				"tid":   partnerTenant,
+				"aud":   "some-other-client",
+				"email": "user@partner.example.com",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			tkn := fe.issueToken(t, test.signer, test.claims)
+
+			got, err := auth.Authenticate(context.Background(), tkn)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Authenticate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(authn.Identity{}, "Token")); diff != "" {
+				t.Errorf("unexpected identity (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewEntraAuth_RejectsMultiTenantAliases(t *testing.T) {
+	_, err := NewEntraAuth(context.Background(), &EntraConfig{
+		Logger:    zaptest.NewLogger(t),
+		TenantIDs: []string{"common"},
+		ClientID:  entraClientID,
+	})
+	if err == nil {
+		t.Fatal("NewEntraAuth with the 'common' tenant succeeded, want an error")
+	}
+}
+
+// fakeEntra serves key sets for Entra ID tenants, each with its own key.
+type fakeEntra struct {
+	srv  *httptest.Server
+	keys map[string]jwk.Key
+}
+
+func newFakeEntra(t *testing.T, tenantIDs ...string) *fakeEntra {
+	fe := &fakeEntra{keys: make(map[string]jwk.Key)}
+	pubs := make(map[string]jwk.Set)
+	for _, tid := range tenantIDs {
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		key, err := jwk.FromRaw(priv)
+		if err != nil {
+			t.Fatalf("failed to make JWK: %v", err)
+		}
+		// Each tenant's key has the same ID, so only the key set used matters.
+		if err := key.Set(jwk.KeyIDKey, "key1"); err != nil {
+			t.Fatalf("failed to set key ID: %v", err)
+		}
+		pub, err := key.PublicKey()
+		if err != nil {
+			t.Fatalf("failed to get public key: %v", err)
+		}
+		set := jwk.NewSet()
+		if err := set.AddKey(pub); err != nil {
+			t.Fatalf("failed to add key to set: %v", err)
+		}
+		fe.keys[tid] = key
+		pubs["/"+tid+"/discovery/v2.0/keys"] = set
+	}
+	fe.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set, ok := pubs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(set); err != nil {
+			t.Errorf("failed to encode key set: %v", err)
+		}
+	}))
+	t.Cleanup(fe.srv.Close)
+	return fe
+}
+
+func (fe *fakeEntra) issuer(tid string) string {
+	return fe.srv.URL + "/" + tid + "/v2.0"
+}
+
+func (fe *fakeEntra) issueToken(t *testing.T, signer string, claims map[string]any) string {
+	tid, _ := claims["tid"].(string)
+	if signer == "" {
+		signer = tid
+	}
+	if signer == "" {
+		signer = partnerTenant
+	}
+	now := time.Now()
+	all := map[string]any{
+		"iss": fe.issuer(tid),
+		"aud": entraClientID,
+		"sub": "user123",
+		"iat": now,
+		"nbf": now,
+		"exp": now.Add(time.Hour),
+		"ver": "2.0",
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+			continue
+		}
+		all[k] = v
+	}
+	tkn := jwt.New()
+	for k, v := range all {
+		if err := tkn.Set(k, v); err != nil {
+			t.Fatalf("failed to set claim %q: %v", k, err)
+		}
+	}
+	dat, err := jwt.Sign(tkn, jwt.WithKey(jwa.RS256, fe.keys[signer]))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return string(dat)
+}
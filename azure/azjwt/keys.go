@@ -0,0 +1,166 @@
+package azjwt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/httprc"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMinKeyRefreshInterval is the default for
+	// Config.MinKeyRefreshInterval.
+	DefaultMinKeyRefreshInterval = time.Minute
+	// DefaultMaxKeyStaleness is the default for Config.MaxKeyStaleness.
+	DefaultMaxKeyStaleness = 24 * time.Hour
+)
+
+// keyOptions control how key sets are refreshed, see Config.
+type keyOptions struct {
+	minRefreshInterval time.Duration
+	maxStaleness       time.Duration
+	now                func() time.Time
+}
+
+func newKeyOptions(minRefreshInterval, maxStaleness time.Duration, now func() time.Time) keyOptions {
+	if minRefreshInterval == 0 {
+		minRefreshInterval = DefaultMinKeyRefreshInterval
+	}
+	if maxStaleness == 0 {
+		maxStaleness = DefaultMaxKeyStaleness
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return keyOptions{
+		minRefreshInterval: minRefreshInterval,
+		maxStaleness:       maxStaleness,
+		now:                now,
+	}
+}
+
+func newKeyCache(ctx context.Context, logger *zap.Logger) *jwk.Cache {
+	// Scheduled refreshes that fail are only logged, tokens are verified with
+	// the last key set that loaded successfully, see keySource.
+	return jwk.NewCache(ctx, jwk.WithErrSink(httprc.ErrSinkFunc(func(err error) {
+		logger.Warn("failed to refresh Azure key set", zap.Error(err))
+	})))
+}
+
+// keySource loads the signing keys of a single policy or tenant. The keys are
+// kept in a jwk.Cache, which refreshes them in the background and keeps
+// serving the last key set it loaded when a refresh fails.
+type keySource struct {
+	keyOptions
+	cache    *jwk.Cache
+	endpoint string
+	logger   *zap.Logger
+
+	mu sync.Mutex
+	// lastLoaded is when the key set was last loaded successfully.
+	lastLoaded time.Time
+	// lastRefresh is when we last refreshed the key set on demand, as opposed
+	// to the cache's scheduled refreshes.
+	lastRefresh time.Time
+}
+
+// newKeySource registers the endpoint with the cache, and loads its keys.
+func newKeySource(ctx context.Context, cache *jwk.Cache, endpoint string, logger *zap.Logger, opts keyOptions) (*keySource, error) {
+	k := &keySource{
+		keyOptions: opts,
+		cache:      cache,
+		endpoint:   endpoint,
+		logger:     logger,
+	}
+	if err := k.cache.Register(k.endpoint, jwk.WithPostFetcher(jwk.PostFetchFunc(k.postFetch))); err != nil {
+		return nil, fmt.Errorf("failed to register JWT key endpoint: %w", err)
+	}
+	if _, err := k.cache.Refresh(ctx, k.endpoint); err != nil {
+		return nil, fmt.Errorf("failed to load key set from endpoint: %w", err)
+	}
+	return k, nil
+}
+
+// postFetch is called by the cache after each successful fetch, and patches the
+// keys once, so that every request can use them as-is.
+//
+// This is needed because Microsoft doesn't include the "alg" header in their
+// keyset descriptions, see https://github.com/lestrrat-go/jwx/issues/395
+// We know the algorithm in use is 256-bit RSA, so we set that manually so that
+// jwt.Parse correctly matches up the keys.
+// The alternative would be to use jwt.InferAlgorithmFromKey(), but that
+// involves just trying algos until one works, which isn't great.
+func (k *keySource) postFetch(_ string, set jwk.Set) (jwk.Set, error) {
+	ks := jwk.NewSet()
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+		if err := key.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+			return nil, fmt.Errorf("failed to set 'alg' on key %q: %w", key.KeyID(), err)
+		}
+		if err := ks.AddKey(key); err != nil {
+			return nil, fmt.Errorf("failed to add key %q to key set: %w", key.KeyID(), err)
+		}
+	}
+
+	k.mu.Lock()
+	k.lastLoaded = k.now()
+	k.mu.Unlock()
+
+	return ks, nil
+}
+
+// keySet returns the policy's key set, which should contain the key with the
+// given ID. If it doesn't, e.g. because Azure rotated its keys, or the key
+// set is stale, the key set is refreshed first, at most once per
+// minRefreshInterval.
+func (k *keySource) keySet(ctx context.Context, kid string) (jwk.Set, error) {
+	set, err := k.cache.Get(ctx, k.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key set from cache: %w", err)
+	}
+
+	_, hasKey := set.LookupKeyID(kid)
+	if (!hasKey || k.isStale()) && k.allowRefresh() {
+		k.logger.Info("refreshing key set on demand",
+			zap.String("endpoint", k.endpoint),
+			zap.String("kid", kid),
+			zap.Bool("has_key", hasKey))
+		if refreshed, err := k.cache.Refresh(ctx, k.endpoint); err != nil {
+			// We keep using the last key set we loaded, up to maxStaleness.
+			k.logger.Warn("failed to refresh key set", zap.String("endpoint", k.endpoint), zap.Error(err))
+		} else {
+			set = refreshed
+		}
+	}
+
+	if k.isStale() {
+		return nil, fmt.Errorf("key set was last loaded at %s, more than %s ago", k.loadedAt().Format(time.RFC3339), k.maxStaleness)
+	}
+	return set, nil
+}
+
+func (k *keySource) allowRefresh() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.now()
+	if now.Sub(k.lastRefresh) < k.minRefreshInterval {
+		return false
+	}
+	k.lastRefresh = now
+	return true
+}
+
+func (k *keySource) loadedAt() time.Time {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.lastLoaded
+}
+
+func (k *keySource) isStale() bool {
+	return k.now().Sub(k.loadedAt()) > k.maxStaleness
+}
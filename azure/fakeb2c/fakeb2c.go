@@ -0,0 +1,295 @@
+// Package fakeb2c implements a fake Azure AD B2C tenant, which serves the
+// same discovery document and key set endpoints as the real thing (including
+// keys without an 'alg', see //azure/azjwt), and issues ID tokens for any user.
+// It's meant for testing the Azure login flow offline, either in Go tests or
+// via //cmd/tools/fakeb2c.
+//
+// Typical use in a test looks like:
+//
+//	fb, err := fakeb2c.New(&fakeb2c.Config{...})
+//	srv := httptest.NewServer(fb)
+//	defer srv.Close()
+//	fb.BaseURL = srv.URL
+//	// Pass srv.URL as azjwt.Config.BaseURL
+package fakeb2c
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+type Config struct {
+	// Tenant, TenantID, Policies and ClientID have the same meaning as in
+	// azjwt.Config. Tokens are issued for the first policy unless otherwise
+	// specified, and each policy has its own signing key.
+	Tenant   string
+	TenantID string
+	Policies []string
+	ClientID string
+
+	// TokenLifetime is how long issued tokens are valid for, defaults to an
+	// hour.
+	TokenLifetime time.Duration
+
+	// Now is used for the timestamps in issued tokens, defaults to time.Now.
+	Now func() time.Time
+}
+
+func (c *Config) validate() error {
+	if c.Tenant == "" {
+		return errors.New("no tenant was provided")
+	}
+	if c.TenantID == "" {
+		return errors.New("no tenantID was provided")
+	}
+	if len(c.Policies) == 0 {
+		return errors.New("no policies were provided")
+	}
+	for _, p := range c.Policies {
+		if p == "" {
+			return errors.New("an empty policy was provided")
+		}
+	}
+	if c.ClientID == "" {
+		return errors.New("no clientID was provided")
+	}
+	return nil
+}
+
+// Server is a fake B2C tenant, and an http.Handler serving its endpoints.
+type Server struct {
+	// BaseURL is the URL the server is reachable at, which is used in the
+	// discovery document and the 'iss' claim of tokens. It must be set before
+	// the server is used, usually right after starting it.
+	BaseURL string
+
+	cfg *Config
+	mux *http.ServeMux
+
+	mu       sync.RWMutex
+	policies map[string]*policyKeys
+}
+
+type policyKeys struct {
+	key jwk.Key
+	pub jwk.Set
+}
+
+// New returns a fake tenant with freshly generated signing keys.
+func New(cfg *Config) (*Server, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.TokenLifetime == 0 {
+		cfg.TokenLifetime = time.Hour
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		policies: make(map[string]*policyKeys),
+		mux:      http.NewServeMux(),
+	}
+	for _, policy := range cfg.Policies {
+		pk, err := newPolicyKeys()
+		if err != nil {
+			return nil, fmt.Errorf("failed to init keys for policy %q: %w", policy, err)
+		}
+		s.policies[policy] = pk
+		prefix := fmt.Sprintf("/%s.onmicrosoft.com/%s", cfg.Tenant, policy)
+		s.mux.HandleFunc(prefix+"/v2.0/.well-known/openid-configuration", s.handleDiscovery(policy))
+		s.mux.HandleFunc(prefix+"/discovery/v2.0/keys", s.handleKeys(policy))
+	}
+	s.mux.HandleFunc("/token", s.handleToken)
+	return s, nil
+}
+
+func newPolicyKeys() (*policyKeys, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make JWK from signing key: %w", err)
+	}
+	if err := key.Set(jwk.KeyIDKey, uuid.NewString()); err != nil {
+		return nil, fmt.Errorf("failed to set key ID: %w", err)
+	}
+	pubKey, err := key.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key: %w", err)
+	}
+	// Like the real thing, we don't set an 'alg' on the public key.
+	pub := jwk.NewSet()
+	if err := pub.AddKey(pubKey); err != nil {
+		return nil, fmt.Errorf("failed to add public key to set: %w", err)
+	}
+	return &policyKeys{key: key, pub: pub}, nil
+}
+
+// RotateKeys replaces the signing keys of every policy, like Azure does
+// periodically. Unlike Azure, the old keys are unpublished immediately.
+func (s *Server) RotateKeys() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, policy := range s.cfg.Policies {
+		pk, err := newPolicyKeys()
+		if err != nil {
+			return fmt.Errorf("failed to init keys for policy %q: %w", policy, err)
+		}
+		s.policies[policy] = pk
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Issuer returns the 'iss' claim of tokens issued by the fake tenant.
+func (s *Server) Issuer() string {
+	return fmt.Sprintf("%s/%s/v2.0/", strings.TrimSuffix(s.BaseURL, "/"), s.cfg.TenantID)
+}
+
+// IssueToken returns a signed ID token for the given user, with the same
+// standard claims as a real B2C token. Any extra claims (e.g. 'groups' or
+// custom extension attributes) are added to the token, and can also override
+// the standard claims, e.g. to issue expired tokens. Setting 'tfp' (or 'acr',
+// which replaces it) to one of the configured policies issues the token for
+// that policy, signed with its key.
+func (s *Server) IssueToken(sub string, emails []string, extra map[string]any) (string, error) {
+	now := s.cfg.Now()
+	claims := map[string]any{
+		jwt.IssuerKey:     s.Issuer(),
+		jwt.AudienceKey:   []string{s.cfg.ClientID},
+		jwt.SubjectKey:    sub,
+		jwt.IssuedAtKey:   now,
+		jwt.NotBeforeKey:  now,
+		jwt.ExpirationKey: now.Add(s.cfg.TokenLifetime),
+		"auth_time":       now.Unix(),
+		"tfp":             s.cfg.Policies[0],
+		"emails":          emails,
+		"ver":             "1.0",
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	policyClaim := "tfp"
+	if _, ok := extra["acr"]; ok {
+		// Custom policies can be configured to use 'acr' instead of 'tfp'.
+		delete(claims, "tfp")
+		policyClaim = "acr"
+	}
+	s.mu.RLock()
+	pk, ok := s.policies[fmt.Sprint(claims[policyClaim])]
+	if !ok {
+		// Sign tokens for unknown policies with the default key, so that they're
+		// only rejected for their 'tfp' claim.
+		pk = s.policies[s.cfg.Policies[0]]
+	}
+	s.mu.RUnlock()
+
+	tkn := jwt.New()
+	for k, v := range claims {
+		if err := tkn.Set(k, v); err != nil {
+			return "", fmt.Errorf("failed to set claim %q: %w", k, err)
+		}
+	}
+	dat, err := jwt.Sign(tkn, jwt.WithKey(jwa.RS256, pk.key))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return string(dat), nil
+}
+
+func (s *Server) handleDiscovery(policy string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		base := strings.TrimSuffix(s.BaseURL, "/")
+		prefix := fmt.Sprintf("%s/%s.onmicrosoft.com/%s", base, s.cfg.Tenant, policy)
+		writeJSON(w, map[string]any{
+			"issuer":                                s.Issuer(),
+			"authorization_endpoint":                prefix + "/oauth2/v2.0/authorize",
+			"token_endpoint":                        prefix + "/oauth2/v2.0/token",
+			"jwks_uri":                              prefix + "/discovery/v2.0/keys",
+			"response_types_supported":              []string{"code", "id_token", "code id_token"},
+			"subject_types_supported":               []string{"pairwise"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"claims_supported":                      []string{"sub", "emails", "tfp", "iss", "iat", "exp", "aud", "nbf", "auth_time", "nonce"},
+		})
+	}
+}
+
+func (s *Server) handleKeys(policy string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		pub := s.policies[policy].pub
+		s.mu.RUnlock()
+		writeJSON(w, pub)
+	}
+}
+
+// handleToken issues a token for the user described by the query parameters,
+// which are 'sub' (defaults to a random ID), 'email' (repeatable), 'nonce',
+// 'policy' (defaults to the first policy), and 'claim' (repeatable, formatted
+// as <name>=<value>). It lets scripts and manual tests get tokens without going
+// through a login page.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sub := q.Get("sub")
+	if sub == "" {
+		sub = uuid.NewString()
+	}
+	extra := make(map[string]any)
+	if nonce := q.Get("nonce"); nonce != "" {
+		extra["nonce"] = nonce
+	}
+	if policy := q.Get("policy"); policy != "" {
+		extra["tfp"] = policy
+	}
+	for _, c := range q["claim"] {
+		name, value, ok := strings.Cut(c, "=")
+		if !ok || name == "" {
+			http.Error(w, fmt.Sprintf("claim %q wasn't of the form <name>=<value>", c), http.StatusBadRequest)
+			return
+		}
+		// Repeated claims become lists, like 'groups'.
+		switch ev := extra[name].(type) {
+		case nil:
+			extra[name] = value
+		case string:
+			extra[name] = []string{ev, value}
+		case []string:
+			extra[name] = append(ev, value)
+		}
+	}
+
+	tkn, err := s.IssueToken(sub, q["email"], extra)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, tkn)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,71 @@
+package fakeb2c
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+func TestTokenEndpoint(t *testing.T) {
+	fb, err := New(&Config{
+		Tenant:   "rmitest",
+		TenantID: "tenant-id",
+		Policies: []string{"B2C_1_susi_test"},
+		ClientID: "client-id",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	srv := httptest.NewServer(fb)
+	defer srv.Close()
+	fb.BaseURL = srv.URL
+
+	resp, err := http.Get(srv.URL + "/token?sub=user123&email=a@example.com&email=b@example.com&claim=groups=g1&claim=groups=g2&claim=extension_AccessLevel=Admin")
+	if err != nil {
+		t.Fatalf("failed to get token: %v", err)
+	}
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read token: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("token endpoint returned status %d: %s", resp.StatusCode, dat)
+	}
+
+	keys, err := jwk.Fetch(resp.Request.Context(), srv.URL+"/rmitest.onmicrosoft.com/B2C_1_susi_test/discovery/v2.0/keys")
+	if err != nil {
+		t.Fatalf("failed to fetch keys: %v", err)
+	}
+	tkn, err := jwt.Parse(
+		[]byte(strings.TrimSpace(string(dat))),
+		jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithIssuer(srv.URL+"/tenant-id/v2.0/"),
+		jwt.WithAudience("client-id"),
+		jwt.WithClaimValue("tfp", "B2C_1_susi_test"),
+	)
+	if err != nil {
+		t.Fatalf("failed to verify token: %v", err)
+	}
+
+	got := map[string]any{"sub": tkn.Subject()}
+	for _, name := range []string{"emails", "groups", "extension_AccessLevel"} {
+		got[name], _ = tkn.Get(name)
+	}
+	want := map[string]any{
+		"sub":                   "user123",
+		"emails":                []any{"a@example.com", "b@example.com"},
+		"groups":                []any{"g1", "g2"},
+		"extension_AccessLevel": "Admin",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected claims (-want +got)\n%s", diff)
+	}
+}
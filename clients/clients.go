@@ -0,0 +1,333 @@
+// Package clients provides a registry of relying parties, the RMI sites and
+// services that send users to the credential service and consume its tokens.
+// Each one is registered with the redirect URIs, CORS origins and cookie
+// domain it uses, so the server can validate requests on its behalf, and a
+// secret that it authenticates back-channel calls with.
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/RMI/credential-service/allowlist"
+)
+
+// Config is the top-level structure of a clients file.
+type Config struct {
+	Format  string    `json:"format"`
+	Clients []*Client `json:"clients"`
+}
+
+// Client is a registered relying party.
+type Client struct {
+	// ID identifies the client in requests, e.g. as the 'client_id' parameter.
+	ID string `json:"clientID"`
+	// SecretHash is the hex-encoded SHA-256 hash of the client's secret, see
+	// HashSecret. Secrets should be long and randomly generated, so a fast hash
+	// is fine, and the file doesn't contain anything that can be used to
+	// impersonate the client.
+	SecretHash string `json:"secretHash"`
+	// Site is the site that the client serves, which tokens issued to it are
+	// scoped to.
+	Site allowlist.Site `json:"site"`
+	// RedirectURIs are where users can be sent back to after logging in, which
+	// must match exactly.
+	RedirectURIs []string `json:"redirectURIs"`
+	// Audiences are the 'aud' values the client can request tokens for.
+	Audiences []string `json:"audiences,omitempty"`
+	// Scopes are the OAuth scopes the client can request tokens with, which
+	// are recorded in the tokens' 'scope' claim, e.g. for downstream services
+	// to check with authz.Scopes.
+	Scopes []string `json:"scopes,omitempty"`
+	// CORSOrigins are the origins (e.g. https://pacta.rmi.org) that the
+	// client's frontend calls the credential service from.
+	CORSOrigins []string `json:"corsOrigins,omitempty"`
+	// CookieDomain, if set, is the domain of the 'jwt' cookie set for logins
+	// from the client, instead of --cookie_domain.
+	CookieDomain string `json:"cookieDomain,omitempty"`
+}
+
+func (c *Client) validate() error {
+	if c.ID == "" {
+		return errors.New("no client ID was provided")
+	}
+	if b, err := hex.DecodeString(c.SecretHash); err != nil || len(b) != sha256.Size {
+		return errors.New("secret hash should be a hex-encoded SHA-256 hash")
+	}
+	if _, err := allowlist.ParseSite(string(c.Site)); err != nil {
+		return fmt.Errorf("invalid site %q: %w", c.Site, err)
+	}
+	if len(c.RedirectURIs) == 0 {
+		return errors.New("no redirect URIs were provided")
+	}
+	for _, uri := range c.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return fmt.Errorf("failed to parse redirect URI %q: %w", uri, err)
+		}
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Fragment != "" {
+			return fmt.Errorf("redirect URI %q should be an absolute http(s) URL without a fragment", uri)
+		}
+	}
+	for _, aud := range c.Audiences {
+		if aud == "" {
+			return errors.New("audiences can't be empty")
+		}
+	}
+	for _, scope := range c.Scopes {
+		// Scopes are space-delimited in requests and tokens, see
+		// https://www.rfc-editor.org/rfc/rfc6749#section-3.3
+		if scope == "" || strings.ContainsAny(scope, " \t\r\n") {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	for _, origin := range c.CORSOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || origin != u.Scheme+"://"+u.Host {
+			return fmt.Errorf("CORS origin %q should be formatted like https://example.com", origin)
+		}
+	}
+	return nil
+}
+
+// AllowsRedirect returns true if uri is one of the client's redirect URIs.
+func (c *Client) AllowsRedirect(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope returns true if the client can request tokens with scope.
+func (c *Client) AllowsScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAudience returns true if the client can request tokens for aud.
+func (c *Client) AllowsAudience(aud string) bool {
+	for _, a := range c.Audiences {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// HashSecret returns the value of Client.SecretHash for the given secret.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ErrUnauthenticated is returned when a client's credentials are missing or
+// wrong.
+var ErrUnauthenticated = errors.New("client failed to authenticate")
+
+type Registry struct {
+	clients  map[string]*Client
+	byOrigin map[string]*Client
+}
+
+func NewRegistryFromConfigFile(fn string) (*Registry, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open clients file: %w", err)
+	}
+	defer f.Close()
+
+	cfg, err := DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistry(cfg)
+}
+
+// DecodeConfig reads a JSON-formatted clients config, without validating it,
+// e.g. after it's been decrypted. Use NewRegistry to validate the config.
+func DecodeConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode clients config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// NewRegistry validates the given config and returns a *Registry for it.
+func NewRegistry(cfg *Config) (*Registry, error) {
+	switch cfg.Format {
+	case "v1":
+		// Valid, continue
+	case "":
+		return nil, errors.New("clients config had no 'format' field, which is required")
+	default:
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+
+	r := &Registry{
+		clients:  make(map[string]*Client),
+		byOrigin: make(map[string]*Client),
+	}
+	for i, c := range cfg.Clients {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("invalid client %d: %w", i, err)
+		}
+		if _, ok := r.clients[c.ID]; ok {
+			return nil, fmt.Errorf("client %q was provided more than once", c.ID)
+		}
+		r.clients[c.ID] = c
+		for _, origin := range c.CORSOrigins {
+			if other, ok := r.byOrigin[origin]; ok {
+				return nil, fmt.Errorf("CORS origin %q was registered by both %q and %q", origin, other.ID, c.ID)
+			}
+			r.byOrigin[origin] = c
+		}
+	}
+	return r, nil
+}
+
+// Client returns the client with the given ID.
+func (r *Registry) Client(id string) (*Client, bool) {
+	c, ok := r.clients[id]
+	return c, ok
+}
+
+// Authenticate returns the client with the given ID, if secret is its secret.
+func (r *Registry) Authenticate(id, secret string) (*Client, error) {
+	c, ok := r.clients[id]
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(strings.ToLower(c.SecretHash))) != 1 {
+		return nil, ErrUnauthenticated
+	}
+	return c, nil
+}
+
+// AuthenticateRequest authenticates a back-channel call from a client, which
+// sends its credentials with HTTP basic auth, or as 'client_id' and
+// 'client_secret' form parameters, see
+// https://www.rfc-editor.org/rfc/rfc6749#section-2.3.1
+func (r *Registry) AuthenticateRequest(req *http.Request) (*Client, error) {
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		if err := req.ParseForm(); err != nil {
+			return nil, fmt.Errorf("failed to parse form: %w", err)
+		}
+		id, secret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	if id == "" {
+		return nil, ErrUnauthenticated
+	}
+	return r.Authenticate(id, secret)
+}
+
+// ForOrigin returns the client that registered the given CORS origin, or
+// failing that, the first client (by ID) with a redirect URI on the origin.
+func (r *Registry) ForOrigin(origin string) (*Client, bool) {
+	if origin == "" {
+		return nil, false
+	}
+	if c, ok := r.byOrigin[origin]; ok {
+		return c, true
+	}
+	var ids []string
+	for id := range r.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, uri := range r.clients[id].RedirectURIs {
+			if strings.HasPrefix(uri, origin+"/") || uri == origin {
+				return r.clients[id], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// CORSOrigins returns the CORS origins of all clients, sorted.
+func (r *Registry) CORSOrigins() []string {
+	var out []string
+	for origin := range r.byOrigin {
+		out = append(out, origin)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// RedirectOrigins returns the origins of all clients' redirect URIs, sorted
+// and deduplicated.
+func (r *Registry) RedirectOrigins() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, c := range r.clients {
+		for _, uri := range c.RedirectURIs {
+			u, _ := url.Parse(uri) // Already validated.
+			origin := u.Scheme + "://" + u.Host
+			if !seen[origin] {
+				seen[origin] = true
+				out = append(out, origin)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+type originKey struct{}
+
+// WithOrigin returns a context carrying the origin a request came from, which
+// is used to pick the client's cookie domain.
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFromContext returns the origin added with WithOrigin, if any.
+func OriginFromContext(ctx context.Context) string {
+	origin, _ := ctx.Value(originKey{}).(string)
+	return origin
+}
+
+// OriginMiddleware adds the request's 'Origin' header to its context, see
+// WithOrigin.
+func OriginMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			r = r.WithContext(WithOrigin(r.Context(), origin))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CookieDomain returns the cookie domain of the client that the request in
+// ctx came from, or def if there isn't one.
+func (r *Registry) CookieDomain(ctx context.Context, def string) string {
+	if r == nil {
+		return def
+	}
+	c, ok := r.ForOrigin(OriginFromContext(ctx))
+	if !ok || c.CookieDomain == "" {
+		return def
+	}
+	return c.CookieDomain
+}
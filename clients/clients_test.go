@@ -0,0 +1,195 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// The secrets are 'pacta-secret' and 'opgee-secret'.
+const testConfig = `{
+  "format": "v1",
+  "clients": [
+    {
+      "clientID": "pacta",
+      "secretHash": "09fe5695e0e33de2c29c043dd86c826191c75b0a451b37c612403ea64e85f140",
+      "site": "PACTA",
+      "redirectURIs": ["https://pacta.example.com/auth/callback"],
+      "audiences": ["pacta-api"],
+      "corsOrigins": ["https://pacta.example.com", "https://app.pacta.example.com"],
+      "cookieDomain": "pacta.example.com"
+    },
+    {
+      "clientID": "opgee",
+      "secretHash": "c141d2d6a1b42074f2d37fc5cb20fc3c1486fd21853d55fd72f27cc176e1b5cd",
+      "site": "OPGEE",
+      "redirectURIs": ["https://opgee.example.com/callback", "http://localhost:3000/callback"]
+    }
+  ]
+}`
+
+func TestNewRegistry_Invalid(t *testing.T) {
+	valid := func() *Client {
+		return &Client{
+			ID:           "pacta",
+			SecretHash:   HashSecret("secret"),
+			Site:         "PACTA",
+			RedirectURIs: []string{"https://pacta.example.com/callback"},
+		}
+	}
+	tests := []struct {
+		desc   string
+		modify func(c *Client)
+	}{
+		{desc: "no ID", modify: func(c *Client) { c.ID = "" }},
+		{desc: "plaintext secret", modify: func(c *Client) { c.SecretHash = "secret" }},
+		{desc: "unknown site", modify: func(c *Client) { c.Site = "NOTASITE" }},
+		{desc: "no redirect URIs", modify: func(c *Client) { c.RedirectURIs = nil }},
+		{desc: "relative redirect URI", modify: func(c *Client) { c.RedirectURIs = []string{"/callback"} }},
+		{desc: "redirect URI with fragment", modify: func(c *Client) { c.RedirectURIs = []string{"https://pacta.example.com/#callback"} }},
+		{desc: "CORS origin with path", modify: func(c *Client) { c.CORSOrigins = []string{"https://pacta.example.com/"} }},
+		{desc: "empty audience", modify: func(c *Client) { c.Audiences = []string{""} }},
+		{desc: "empty scope", modify: func(c *Client) { c.Scopes = []string{""} }},
+		{desc: "scope with a space", modify: func(c *Client) { c.Scopes = []string{"projects:read projects:write"} }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c := valid()
+			test.modify(c)
+			if _, err := NewRegistry(&Config{Format: "v1", Clients: []*Client{c}}); err == nil {
+				t.Error("NewRegistry succeeded, want an error")
+			}
+		})
+	}
+
+	for _, format := range []string{"", "v0"} {
+		if _, err := NewRegistry(&Config{Format: format, Clients: []*Client{valid()}}); err == nil {
+			t.Errorf("NewRegistry with format %q succeeded, want an error", format)
+		}
+	}
+
+	t.Run("duplicate ID", func(t *testing.T) {
+		if _, err := NewRegistry(&Config{Format: "v1", Clients: []*Client{valid(), valid()}}); err == nil {
+			t.Error("NewRegistry succeeded, want an error")
+		}
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	r := newRegistry(t)
+
+	tests := []struct {
+		desc   string
+		id     string
+		secret string
+		want   string
+	}{
+		{desc: "valid", id: "pacta", secret: "pacta-secret", want: "pacta"},
+		{desc: "other client's secret", id: "pacta", secret: "opgee-secret"},
+		{desc: "wrong secret", id: "opgee", secret: "wrong"},
+		{desc: "unknown client", id: "unknown", secret: "pacta-secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c, err := r.Authenticate(test.id, test.secret)
+			if test.want == "" {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("Authenticate returned %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if c.ID != test.want {
+				t.Errorf("Authenticate returned client %q, want %q", c.ID, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	r := newRegistry(t)
+
+	basic := httptest.NewRequest(http.MethodPost, "/", nil)
+	basic.SetBasicAuth("opgee", "opgee-secret")
+	if c, err := r.AuthenticateRequest(basic); err != nil || c.ID != "opgee" {
+		t.Errorf("AuthenticateRequest with basic auth = %v, %v, want opgee", c, err)
+	}
+
+	form := url.Values{"client_id": {"pacta"}, "client_secret": {"pacta-secret"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c, err := r.AuthenticateRequest(req); err != nil || c.ID != "pacta" {
+		t.Errorf("AuthenticateRequest with form = %v, %v, want pacta", c, err)
+	}
+
+	none := httptest.NewRequest(http.MethodPost, "/", nil)
+	if _, err := r.AuthenticateRequest(none); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("AuthenticateRequest without credentials returned %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestOrigins(t *testing.T) {
+	r := newRegistry(t)
+
+	if diff := cmp.Diff([]string{"https://app.pacta.example.com", "https://pacta.example.com"}, r.CORSOrigins()); diff != "" {
+		t.Errorf("unexpected CORS origins (-want +got)\n%s", diff)
+	}
+	want := []string{"http://localhost:3000", "https://opgee.example.com", "https://pacta.example.com"}
+	if diff := cmp.Diff(want, r.RedirectOrigins()); diff != "" {
+		t.Errorf("unexpected redirect origins (-want +got)\n%s", diff)
+	}
+}
+
+func TestCookieDomain(t *testing.T) {
+	r := newRegistry(t)
+
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{origin: "https://app.pacta.example.com", want: "pacta.example.com"},
+		// Matched by redirect URI, e.g. after a server-side login.
+		{origin: "https://pacta.example.com", want: "pacta.example.com"},
+		// Registered, but without its own cookie domain.
+		{origin: "https://opgee.example.com", want: "example.com"},
+		{origin: "https://unknown.example.com", want: "example.com"},
+		{origin: "", want: "example.com"},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.origin != "" {
+			ctx = WithOrigin(ctx, test.origin)
+		}
+		if got := r.CookieDomain(ctx, "example.com"); got != test.want {
+			t.Errorf("CookieDomain(%q) = %q, want %q", test.origin, got, test.want)
+		}
+	}
+
+	var nilRegistry *Registry
+	if got := nilRegistry.CookieDomain(WithOrigin(context.Background(), "https://pacta.example.com"), "example.com"); got != "example.com" {
+		t.Errorf("CookieDomain on nil registry = %q, want the default", got)
+	}
+}
+
+func newRegistry(t *testing.T) *Registry {
+	cfg, err := DecodeConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+	r, err := NewRegistry(cfg)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	return r
+}
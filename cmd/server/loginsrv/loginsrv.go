@@ -0,0 +1,465 @@
+// Package loginsrv implements a server-side (backend-for-frontend) login flow,
+// so that RMI web apps don't each need to embed an OpenID Connect client like
+// MSAL.js. The browser is sent to GET /login/start, which redirects it to the
+// identity provider, which in turn redirects it back to GET /login/callback
+// with an authorization code. We exchange that code (with PKCE) for an ID
+// token, check it like any other source token, and set the usual 'jwt' cookie
+// before sending the browser back to the app.
+package loginsrv
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/authn/oidc"
+	"github.com/RMI/credential-service/clients"
+	"github.com/RMI/credential-service/tokenctx"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+)
+
+const (
+	// stateCookie holds the state of a login between /login/start and
+	// /login/callback.
+	stateCookie = "login_state"
+	// callbackPath is where the state cookie is sent, which should be the path
+	// of Config.RedirectURL.
+	callbackPath = "/login/callback"
+	// stateTTL is how long users have to log in with the provider.
+	stateTTL = 10 * time.Minute
+)
+
+// CookieIssuer issues the 'jwt' cookie for a context populated by
+// authn.Registry, which *usersrv.Server implements.
+type CookieIssuer interface {
+	AuthCookie(ctx context.Context) (*http.Cookie, error)
+}
+
+type Server struct {
+	logger    *zap.Logger
+	registry  *authn.Registry
+	cookies   CookieIssuer
+	endpoints *oidc.Endpoints
+	client    *http.Client
+	stateKey  jwk.Key
+	now       func() time.Time
+
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	origins      map[string]bool
+}
+
+type Config struct {
+	Logger *zap.Logger
+
+	// Registry checks the ID tokens we get from the provider, so they need to
+	// be from one of its registered providers.
+	Registry *authn.Registry
+	Cookies  CookieIssuer
+
+	// DiscoveryURL is the provider's discovery document, which the
+	// authorization and token endpoints are loaded from.
+	DiscoveryURL string
+	ClientID     string
+	// ClientSecret is optional, since PKCE doesn't need one. It's sent in the
+	// body of token requests.
+	ClientSecret string
+	// RedirectURL is the public URL of /login/callback, which has to be
+	// registered with the provider.
+	RedirectURL string
+	// Scopes requested from the provider, defaults to just 'openid'.
+	Scopes []string
+	// ReturnToOrigins are the origins (e.g. https://pacta.rmi.org) that users
+	// can be sent back to after logging in. Any other return_to is rejected,
+	// so we can't be used as an open redirect. With a client registry, these are
+	// usually the origins of the clients' redirect URIs, see
+	// clients.Registry.RedirectOrigins.
+	ReturnToOrigins []string
+	// StateKey is used to sign the state cookie, see keyutil.DeriveKey. It has
+	// to be the same on every instance of the server.
+	StateKey []byte
+
+	// HTTPClient is used to load the discovery document and exchange codes,
+	// defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+func (c *Config) validate() error {
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+	if c.Registry == nil {
+		return errors.New("no *authn.Registry was provided")
+	}
+	if c.Cookies == nil {
+		return errors.New("no CookieIssuer was provided")
+	}
+
+	if c.DiscoveryURL == "" {
+		return errors.New("no discovery URL was provided")
+	}
+	if c.ClientID == "" {
+		return errors.New("no client ID was provided")
+	}
+	if c.RedirectURL == "" {
+		return errors.New("no redirect URL was provided")
+	}
+	if u, err := url.Parse(c.RedirectURL); err != nil || u.Path != callbackPath {
+		return fmt.Errorf("redirect URL %q should be the absolute URL of %s", c.RedirectURL, callbackPath)
+	}
+	if len(c.ReturnToOrigins) == 0 {
+		return errors.New("no return_to origins were provided")
+	}
+	for _, o := range c.ReturnToOrigins {
+		if _, err := origin(o); err != nil {
+			return fmt.Errorf("invalid return_to origin %q: %w", o, err)
+		}
+	}
+	if len(c.StateKey) < 32 {
+		return errors.New("state key should be at least 32 bytes")
+	}
+
+	return nil
+}
+
+// New returns a server for the login flow, after loading the provider's
+// endpoints.
+func New(ctx context.Context, cfg *Config) (*Server, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	endpoints, err := oidc.LoadEndpoints(ctx, client, cfg.DiscoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider endpoints: %w", err)
+	}
+	stateKey, err := jwk.FromRaw(cfg.StateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make state key: %w", err)
+	}
+	origins := make(map[string]bool)
+	for _, o := range cfg.ReturnToOrigins {
+		// Already validated above.
+		o, _ = origin(o)
+		origins[o] = true
+	}
+
+	return &Server{
+		logger:    cfg.Logger,
+		registry:  cfg.Registry,
+		cookies:   cfg.Cookies,
+		endpoints: endpoints,
+		client:    client,
+		stateKey:  stateKey,
+		now:       now,
+
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURL:  cfg.RedirectURL,
+		scopes:       scopes,
+		origins:      origins,
+	}, nil
+}
+
+// origin returns the scheme://host[:port] of an absolute URL.
+func origin(inp string) (string, error) {
+	u, err := url.Parse(inp)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("URL had scheme %q, should be http or https", u.Scheme)
+	}
+	if u.Host == "" || u.User != nil {
+		return "", errors.New("URL should have a host, and no user info")
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host), nil
+}
+
+// loginState is what we remember about a login between /login/start and
+// /login/callback, in a signed cookie.
+type loginState struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+	ReturnTo     string
+	// Site is empty if the app didn't ask for a specific site.
+	Site allowlist.Site
+}
+
+// Start redirects the user to the provider to log in.
+// (GET /login/start?site=...&return_to=...)
+func (s *Server) Start(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	returnTo := q.Get("return_to")
+	if o, err := origin(returnTo); err != nil || !s.origins[o] {
+		s.logger.Warn("rejecting login with disallowed return_to", zap.String("return_to", returnTo), zap.Error(err))
+		http.Error(w, "return_to isn't allowed", http.StatusBadRequest)
+		return
+	}
+	var site allowlist.Site
+	if v := q.Get("site"); v != "" {
+		var err error
+		if site, err = allowlist.ParseSite(v); err != nil {
+			http.Error(w, "unknown site", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ls := &loginState{
+		State:        randomString(),
+		CodeVerifier: randomString(),
+		Nonce:        randomString(),
+		ReturnTo:     returnTo,
+		Site:         site,
+	}
+	cookie, err := s.stateCookie(ls)
+	if err != nil {
+		s.logger.Error("failed to create login state", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, cookie)
+
+	challenge := sha256.Sum256([]byte(ls.CodeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.clientID},
+		"redirect_uri":          {s.redirectURL},
+		"scope":                 {strings.Join(s.scopes, " ")},
+		"state":                 {ls.State},
+		"nonce":                 {ls.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := s.endpoints.Authorization
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + params.Encode()
+	} else {
+		authURL += "?" + params.Encode()
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes the login, after the provider redirects the user back to
+// us. (GET /login/callback?code=...&state=...)
+func (s *Server) Callback(w http.ResponseWriter, r *http.Request) {
+	// The state is single-use, so we clear it whether or not the login works.
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Path:     callbackPath,
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		s.logger.Warn("provider returned an error", zap.String("error", e), zap.String("error_description", q.Get("error_description")))
+		http.Error(w, "failed to log in with identity provider", http.StatusUnauthorized)
+		return
+	}
+
+	ls, err := s.loadState(r)
+	if err != nil {
+		s.logger.Warn("failed to load login state", zap.Error(err))
+		http.Error(w, "login expired or invalid, please try again", http.StatusBadRequest)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(ls.State)) != 1 {
+		s.logger.Warn("login state didn't match")
+		http.Error(w, "login expired or invalid, please try again", http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := s.exchangeCode(r.Context(), q.Get("code"), ls.CodeVerifier)
+	if err != nil {
+		s.logger.Warn("failed to exchange authorization code", zap.Error(err))
+		http.Error(w, "failed to log in with identity provider", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, err := s.registry.AuthenticateToken(r.Context(), idToken, ls.Nonce)
+	if err != nil {
+		s.logger.Warn("failed to authenticate ID token", zap.Error(err))
+		if errors.Is(err, authn.ErrNotAllowlisted) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		} else {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
+		return
+	}
+	if ls.Site != "" {
+		ae, err := tokenctx.AllowlistEntityFromContext(ctx)
+		if err != nil || ae == nil || !ae.Allows(ls.Site) {
+			s.logger.Warn("user isn't allowed to access site", zap.String("site", string(ls.Site)), zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+	}
+
+	// The browser doesn't send an 'Origin' header on redirects, so the cookie
+	// domain is picked based on where the user is going back to.
+	if o, err := origin(ls.ReturnTo); err == nil {
+		ctx = clients.WithOrigin(ctx, o)
+	}
+	cookie, err := s.cookies.AuthCookie(ctx)
+	if err != nil {
+		s.logger.Error("failed to issue auth cookie", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, ls.ReturnTo, http.StatusSeeOther)
+}
+
+func (s *Server) stateCookie(ls *loginState) (*http.Cookie, error) {
+	exp := s.now().Add(stateTTL)
+	tkn, err := jwt.NewBuilder().
+		Expiration(exp).
+		Claim("state", ls.State).
+		Claim("code_verifier", ls.CodeVerifier).
+		Claim("nonce", ls.Nonce).
+		Claim("return_to", ls.ReturnTo).
+		Claim("site", string(ls.Site)).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build state token: %w", err)
+	}
+	dat, err := jwt.Sign(tkn, jwt.WithKey(jwa.HS256, s.stateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign state token: %w", err)
+	}
+	return &http.Cookie{
+		Name:     stateCookie,
+		Value:    string(dat),
+		Path:     callbackPath,
+		Expires:  exp,
+		Secure:   true,
+		HttpOnly: true,
+		// The callback is a top-level navigation from the provider, which Lax
+		// cookies are sent with.
+		SameSite: http.SameSiteLaxMode,
+	}, nil
+}
+
+func (s *Server) loadState(r *http.Request) (*loginState, error) {
+	c, err := r.Cookie(stateCookie)
+	if err != nil {
+		return nil, fmt.Errorf("no state cookie: %w", err)
+	}
+	tkn, err := jwt.Parse([]byte(c.Value),
+		jwt.WithKey(jwa.HS256, s.stateKey),
+		jwt.WithValidate(true),
+		jwt.WithClock(jwt.ClockFunc(s.now)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify state token: %w", err)
+	}
+	var ls loginState
+	for claim, dst := range map[string]*string{
+		"state":         &ls.State,
+		"code_verifier": &ls.CodeVerifier,
+		"nonce":         &ls.Nonce,
+		"return_to":     &ls.ReturnTo,
+	} {
+		v, _ := tkn.Get(claim)
+		str, ok := v.(string)
+		if !ok || str == "" {
+			return nil, fmt.Errorf("state token had no %q claim", claim)
+		}
+		*dst = str
+	}
+	if v, ok := tkn.Get("site"); ok {
+		site, _ := v.(string)
+		ls.Site = allowlist.Site(site)
+	}
+	return &ls, nil
+}
+
+// exchangeCode exchanges an authorization code for an ID token, see
+// https://openid.net/specs/openid-connect-core-1_0.html#TokenRequest
+func (s *Server) exchangeCode(ctx context.Context, code, verifier string) (string, error) {
+	if code == "" {
+		return "", errors.New("no authorization code was provided")
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.redirectURL},
+		"client_id":     {s.clientID},
+		"code_verifier": {verifier},
+	}
+	if s.clientSecret != "" {
+		form.Set("client_secret", s.clientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoints.Token, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response with status %d: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d: %s: %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response had no 'id_token'")
+	}
+	return body.IDToken, nil
+}
+
+// randomString returns 32 random bytes, base64url-encoded, which is also a
+// valid PKCE code verifier.
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on any platform we run on.
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,312 @@
+package loginsrv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/authn/oidc"
+	"github.com/RMI/credential-service/keyutil"
+	"github.com/RMI/credential-service/tokenctx"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+const testAllowlist = `{
+  "format": "v1",
+  "allowlist": [
+    {"domain": "example.com", "sites": ["PACTA"]}
+  ]
+}`
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		desc     string
+		site     string
+		returnTo string
+		email    string
+		// tamper modifies the callback request, to simulate attacks.
+		tamper       func(q url.Values)
+		wantStart    int
+		wantCallback int
+	}{
+		{
+			desc:         "success",
+			site:         "PACTA",
+			returnTo:     "https://pacta.example.com/dashboard",
+			email:        "user@example.com",
+			wantStart:    http.StatusFound,
+			wantCallback: http.StatusSeeOther,
+		},
+		{
+			desc:      "return_to not allowed",
+			returnTo:  "https://evil.example.com/",
+			wantStart: http.StatusBadRequest,
+		},
+		{
+			desc:      "unknown site",
+			site:      "NOTASITE",
+			returnTo:  "https://pacta.example.com/",
+			wantStart: http.StatusBadRequest,
+		},
+		{
+			desc:         "not allowlisted",
+			returnTo:     "https://pacta.example.com/",
+			email:        "user@example.net",
+			wantStart:    http.StatusFound,
+			wantCallback: http.StatusForbidden,
+		},
+		{
+			desc:         "site not allowed",
+			site:         "OPGEE",
+			returnTo:     "https://pacta.example.com/",
+			email:        "user@example.com",
+			wantStart:    http.StatusFound,
+			wantCallback: http.StatusForbidden,
+		},
+		{
+			desc:         "state mismatch",
+			returnTo:     "https://pacta.example.com/",
+			email:        "user@example.com",
+			tamper:       func(q url.Values) { q.Set("state", "other-state") },
+			wantStart:    http.StatusFound,
+			wantCallback: http.StatusBadRequest,
+		},
+		{
+			desc:         "provider error",
+			returnTo:     "https://pacta.example.com/",
+			email:        "user@example.com",
+			tamper:       func(q url.Values) { q.Set("error", "access_denied") },
+			wantStart:    http.StatusFound,
+			wantCallback: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			idp := newFakeIdP(t, test.email)
+			srv := newServer(t, idp)
+
+			q := url.Values{"return_to": {test.returnTo}}
+			if test.site != "" {
+				q.Set("site", test.site)
+			}
+			w := httptest.NewRecorder()
+			srv.Start(w, httptest.NewRequest(http.MethodGet, "/login/start?"+q.Encode(), nil))
+			if w.Code != test.wantStart {
+				t.Fatalf("/login/start returned status %d, want %d", w.Code, test.wantStart)
+			}
+			if w.Code != http.StatusFound {
+				return
+			}
+
+			// Play the part of the provider, which remembers the challenge and
+			// sends the user back with a code and the same state.
+			loc, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse redirect: %v", err)
+			}
+			authParams := loc.Query()
+			if got := loc.Scheme + "://" + loc.Host + loc.Path; got != idp.srv.URL+"/authorize" {
+				t.Errorf("redirected to %q, want the authorization endpoint", got)
+			}
+			if got := authParams.Get("code_challenge_method"); got != "S256" {
+				t.Errorf("code_challenge_method = %q, want S256", got)
+			}
+			idp.challenge = authParams.Get("code_challenge")
+			idp.nonce = authParams.Get("nonce")
+
+			cbParams := url.Values{"code": {"test-code"}, "state": {authParams.Get("state")}}
+			if test.tamper != nil {
+				test.tamper(cbParams)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/login/callback?"+cbParams.Encode(), nil)
+			for _, c := range w.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			w = httptest.NewRecorder()
+			srv.Callback(w, req)
+			if w.Code != test.wantCallback {
+				t.Fatalf("/login/callback returned status %d, want %d", w.Code, test.wantCallback)
+			}
+			if w.Code != http.StatusSeeOther {
+				return
+			}
+
+			if got := w.Header().Get("Location"); got != test.returnTo {
+				t.Errorf("redirected to %q, want %q", got, test.returnTo)
+			}
+			cookies := make(map[string]*http.Cookie)
+			for _, c := range w.Result().Cookies() {
+				cookies[c.Name] = c
+			}
+			if c := cookies["jwt"]; c == nil || c.Value != test.email {
+				t.Errorf("jwt cookie was %v, want one for %q", c, test.email)
+			}
+			if c := cookies[stateCookie]; c == nil || c.MaxAge >= 0 {
+				t.Errorf("state cookie was %v, want it to be cleared", c)
+			}
+		})
+	}
+}
+
+func TestCallback_ExpiredState(t *testing.T) {
+	idp := newFakeIdP(t, "user@example.com")
+	srv := newServer(t, idp)
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+
+	w := httptest.NewRecorder()
+	srv.Start(w, httptest.NewRequest(http.MethodGet, "/login/start?return_to=https://pacta.example.com/", nil))
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse redirect: %v", err)
+	}
+
+	now = now.Add(stateTTL + time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/login/callback?code=test-code&state="+loc.Query().Get("state"), nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	srv.Callback(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("/login/callback returned status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func newServer(t *testing.T, idp *fakeIdP) *Server {
+	logger := zaptest.NewLogger(t)
+	reg := authn.NewRegistry(logger)
+	if err := reg.Register("test", &fakeProvider{iss: idp.srv.URL}, loadAllowlist(t)); err != nil {
+		t.Fatalf("failed to register provider: %v", err)
+	}
+	srv, err := New(context.Background(), &Config{
+		Logger:          logger,
+		Registry:        reg,
+		Cookies:         fakeCookieIssuer{},
+		DiscoveryURL:    idp.srv.URL + oidc.DiscoveryPath,
+		ClientID:        "test-client",
+		RedirectURL:     "https://creds.example.com/login/callback",
+		ReturnToOrigins: []string{"https://pacta.example.com"},
+		StateKey:        keyutil.DeriveKey([]byte("test-secret"), "login state"),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return srv
+}
+
+// fakeIdP is an OpenID Connect provider that issues unsigned ID tokens for
+// one user, after checking the PKCE code verifier.
+type fakeIdP struct {
+	srv       *httptest.Server
+	email     string
+	challenge string
+	nonce     string
+}
+
+func newFakeIdP(t *testing.T, email string) *fakeIdP {
+	idp := &fakeIdP{email: email}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidc.DiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse token request: %v", err)
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "test-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"id_token": unsignedToken(t, map[string]any{
+				"iss":   idp.srv.URL,
+				"sub":   "user1",
+				"email": idp.email,
+				"nonce": idp.nonce,
+				"exp":   time.Now().Add(time.Hour),
+			}),
+		})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// fakeProvider trusts any token with its issuer.
+type fakeProvider struct {
+	iss string
+}
+
+func (f *fakeProvider) Issuer() string {
+	return f.iss
+}
+
+func (f *fakeProvider) Authenticate(ctx context.Context, tknStr string) (*authn.Identity, error) {
+	tkn, err := jwt.ParseInsecure([]byte(tknStr))
+	if err != nil {
+		return nil, err
+	}
+	if tkn.Issuer() != f.iss {
+		return nil, errors.New("wrong issuer")
+	}
+	email, _ := tkn.Get("email")
+	return &authn.Identity{Subject: tkn.Subject(), Emails: []string{email.(string)}, Token: tkn}, nil
+}
+
+// fakeCookieIssuer sets the 'jwt' cookie to the user's email.
+type fakeCookieIssuer struct{}
+
+func (fakeCookieIssuer) AuthCookie(ctx context.Context) (*http.Cookie, error) {
+	emails, err := tokenctx.EmailsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Cookie{Name: "jwt", Value: strings.Join(emails, ",")}, nil
+}
+
+func unsignedToken(t *testing.T, claims map[string]any) string {
+	tkn := jwt.New()
+	for k, v := range claims {
+		if err := tkn.Set(k, v); err != nil {
+			t.Fatalf("failed to set claim %q: %v", k, err)
+		}
+	}
+	payload, err := jwt.NewSerializer().Serialize(tkn)
+	if err != nil {
+		t.Fatalf("failed to serialize token: %v", err)
+	}
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func loadAllowlist(t *testing.T) *allowlist.Checker {
+	fn := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := os.WriteFile(fn, []byte(testAllowlist), 0600); err != nil {
+		t.Fatalf("failed to write allowlist: %v", err)
+	}
+	c, err := allowlist.NewCheckerFromConfigFile(fn)
+	if err != nil {
+		t.Fatalf("failed to load allowlist: %v", err)
+	}
+	return c
+}
@@ -2,24 +2,40 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/allowlist/sqlallowlist"
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/authn/cognito"
+	"github.com/RMI/credential-service/authn/firebase"
 	"github.com/RMI/credential-service/authn/localjwt"
 	"github.com/RMI/credential-service/azure/azjwt"
+	"github.com/RMI/credential-service/clients"
+	"github.com/RMI/credential-service/cmd/server/loginsrv"
+	"github.com/RMI/credential-service/cmd/server/ssosrv"
 	"github.com/RMI/credential-service/cmd/server/testcredsrv"
 	"github.com/RMI/credential-service/cmd/server/usersrv"
+	"github.com/RMI/credential-service/encfile"
 	"github.com/RMI/credential-service/flagext"
 	"github.com/RMI/credential-service/httpreq"
+	"github.com/RMI/credential-service/keyutil"
 	"github.com/RMI/credential-service/openapi/testcreds"
 	"github.com/RMI/credential-service/openapi/user"
 	"github.com/RMI/credential-service/secrets"
+	"github.com/RMI/credential-service/verify"
+	"github.com/RMI/credential-service/verify/sqlrevocation"
 	"github.com/Silicon-Ally/zaphttplog"
 	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/go-chi/chi/v5"
@@ -33,6 +49,10 @@ import (
 
 	oapimiddleware "github.com/deepmap/oapi-codegen/pkg/chi-middleware"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
+
+	// Database drivers for --allowlist_db_driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
@@ -71,14 +91,61 @@ func run(args []string) error {
 		rateLimitMaxRequests = fs.Int("rate_limit_max_requests", 100, "The maximum number of requests to allow per rate_limit_unit_time before rate limiting the caller.")
 		rateLimitUnitTime    = fs.Duration("rate_limit_unit_time", 1*time.Minute, "The unit of time over which to measure the rate_limit_max_requests.")
 
-		useLocalJWTs = fs.Bool("use_local_jwts", false, "If true, expect source JWTs to be self-signed, instead of from Azure B2C")
+		useLocalJWTs = fs.Bool("use_local_jwts", false, "If true, expect source JWTs to be self-signed, instead of from Azure B2C or an OIDC provider")
+
+		azureADBaseURL = fs.String("azure_ad_base_url", "", "If set, overrides https://<tenant>.b2clogin.com as the Azure AD B2C endpoint, only allowed in a local environment for use with //cmd/tools/fakeb2c")
+
+		oidcDiscoveryURL   = fs.String("oidc_discovery_url", "", "If set, also accept ID tokens from the OpenID Connect provider with this discovery document URL, e.g. https://<org>.okta.com/.well-known/openid-configuration")
+		oidcClientID       = fs.String("oidc_client_id", "", "The client ID users are authenticating against with the OIDC provider, expected as the 'aud' claim")
+		oidcEmailClaim     = fs.String("oidc_email_claim", "email", "The claim in OIDC ID tokens containing the user's email address")
+		oidcRequiredClaims flagext.StringList
+
+		requireSourceNonce       = fs.Bool("require_source_token_nonce", false, "If true, require clients to send the nonce from their authentication request in the "+authn.NonceHeader+" header, which must match the source token's 'nonce' claim. Otherwise, the nonce is only checked when the header is sent")
+		maxSourceAuthAge         = fs.Duration("max_source_auth_age", 0, "If set, reject source tokens whose 'auth_time' claim is older than this, i.e. require users to have recently logged in with their identity provider")
+		requireVerifiedEmails    flagext.StringList
+		preventSourceTokenReplay = fs.Bool("prevent_source_token_replay", false, "If true, each source token can only be exchanged once, until it expires. Exchanged tokens are recorded in the allowlist database (see authn.ReplaySchema) so that this holds across instances, so it requires --allowlist_db_driver, unless --replay_single_instance is set")
+		replaySingleInstance     = fs.Bool("replay_single_instance", false, "If true, --prevent_source_token_replay records exchanged source tokens in memory instead of the allowlist database. Only set this if exactly one instance of the server runs, otherwise each token can be exchanged once per instance")
+
+		entraClientID  = fs.String("entra_client_id", "", "If set along with --entra_tenant_ids, also accept ID tokens from Microsoft Entra ID (workforce) tenants for this app registration, expected as the 'aud' claim")
+		entraTenantIDs flagext.StringList
+
+		firebaseProjectID   = fs.String("firebase_project_id", "", "If set, also accept ID tokens from Firebase Auth (Google Cloud Identity Platform) for this project, expected as the 'aud' claim")
+		firebaseGroupsClaim = fs.String("firebase_groups_claim", "groups", "The custom claim in Firebase ID tokens containing the user's groups")
+
+		cognitoUserPoolID = fs.String("cognito_user_pool_id", "", "If set along with --cognito_client_id, also accept ID tokens from this AWS Cognito user pool, formatted as <region>_<ID>")
+		cognitoClientID   = fs.String("cognito_client_id", "", "The ID of the Cognito user pool's app client that users sign in with, expected as the 'aud' claim")
+
+		loginDiscoveryURL = fs.String("login_discovery_url", "", "If set, enables the server-side login flow at /login/start and /login/callback, which logs users in with the provider at this discovery document URL. Its ID tokens must be accepted by one of the other configured providers")
+		loginClientID     = fs.String("login_client_id", "", "The client ID of the app registered with the --login_discovery_url provider")
+		loginRedirectURL  = fs.String("login_redirect_url", "", "The public URL of /login/callback, e.g. https://credentials.rmi.org/login/callback, which has to be registered with the provider as a redirect URI")
+		loginScopes       flagext.StringList
+		loginReturnTo     flagext.StringList
+
+		clientsFile       = fs.String("clients_file", "", "JSON-formatted file registering the sites (relying parties) that use the credential service. If set, it enables single sign-on at /sso/authorize, /sso/token and /sso/site-token, and the clients' origins are used instead of --allowed_cors_origins and --login_return_to_origins. Authorization codes are single-use across instances by recording them in the allowlist database (see ssosrv.CodesSchema), so it requires --allowlist_db_driver, unless --sso_single_instance is set. Can be encrypted like --allowlist_file")
+		ssoSingleInstance = fs.Bool("sso_single_instance", false, "If true, single sign-on records used authorization codes in memory instead of the allowlist database. Only set this if exactly one instance of the server runs, otherwise each code can be exchanged once per instance")
+
+		identityProvidersFile = fs.String("identity_providers_file", "", "JSON-formatted file describing additional OIDC providers to accept tokens from, each with its own client ID, claims and allowlist. Can be encrypted like --allowlist_file")
 
-		enableCredTest = fs.Bool("enable_credential_test_api", false, "If true, enables the credential testing API, which returns if credentials are valid")
+		enableCredTest       = fs.Bool("enable_credential_test_api", false, "If true, enables the credential testing API, which returns if credentials are valid")
+		credTestMaxBatchSize = fs.Int("credential_test_max_batch_size", testcredsrv.DefaultMaxBatchSize, "The most tokens that can be checked in one request to /credentials:batchCheck")
+		checkTokenRevocation = fs.Bool("check_token_revocation", false, "If true, the credential test API reports whether tokens were revoked, by looking up their 'jti' claim in the allowlist database (see sqlrevocation.Schema), so it requires --allowlist_db_driver")
 
 		cookieDomain = fs.String("cookie_domain", "", "Domain to return in the cookie response")
+		tokenIssuer  = fs.String("token_issuer", "", "If set, the 'iss' claim of issued tokens, usually the public URL of the service, e.g. https://credentials.rmi.org")
+
+		structuredSitesClaim = fs.Bool("structured_sites_claim", false, "If true, issue the 'sites' claim as a versioned JSON object instead of a comma-separated string. Only enable once every service checking tokens accepts both forms, see the sitesclaim package")
+
+		allowlistFile     = fs.String("allowlist_file", "", "JSON-formatted file containing the allowlist, which can be age- or sops-encrypted if --decryption_key_file is set")
+		decryptionKeyFile = fs.String("decryption_key_file", "", "File containing age identities, used to decrypt the allowlist file and --encrypted_config")
+		allowPlaintext    = fs.Bool("allow_plaintext_config", false, "If true, files that would be decrypted with --decryption_key_file can also be plaintext, e.g. for local development. Otherwise, unencrypted files are rejected")
+		encryptedConfig   = fs.String("encrypted_config", "", "Path to an age- or sops-encrypted config file, in the same format as --config. Requires --decryption_key_file")
+
+		allowlistDBDriver       = fs.String("allowlist_db_driver", "", "If set, load the allowlist from a database instead of --allowlist_file. Options: 'sqlite', 'pgx' (Postgres)")
+		allowlistDBPollInterval = fs.Duration("allowlist_db_poll_interval", 1*time.Minute, "How often to reload the allowlist from the database.")
+		allowlistDBCreateSchema = fs.Bool("allowlist_db_create_schema", false, "If true, create any missing tables in the allowlist database at startup: the allowlist itself, and the tables for used SSO codes, revoked tokens, and exchanged source tokens. Existing tables aren't changed, so new columns still have to be added by hand")
 
-		allowlistFile      = fs.String("allowlist_file", "", "JSON-formatted file containing the allowlist")
 		allowedCORSOrigins flagext.StringList
+		siteAudiences      flagext.StringList
 		minLogLevel        zapcore.Level = zapcore.WarnLevel
 
 		// Secrets
@@ -86,10 +153,20 @@ func run(args []string) error {
 		authKeyData = fs.String("secret_auth_private_key_data", "", "PEM-encoded Ed25519 private key to sign JWT tokens with, contains literal \\n characters that will need to be replaced before parsing")
 
 		azureADTenantName = fs.String("secret_azure_ad_tenant_name", "", "The name of the tenant user tokens should come from")
-		azureADUserFlow   = fs.String("secret_azure_ad_user_flow", "", "The user flow that users are using to sign in/sign up")
+		azureADUserFlow   = fs.String("secret_azure_ad_user_flow", "", "A comma-separated list of the user flows/custom policies that users sign in/sign up with, e.g. separate sign-in, password reset and invite flows")
 		azureADClientID   = fs.String("secret_azure_ad_client_id", "", "The client ID the users are authenticating against")
 		azureADTenantID   = fs.String("secret_azure_ad_tenant_id", "", "The ID of the tenant user tokens should come from")
+
+		loginClientSecret = fs.String("secret_login_client_secret", "", "Optional client secret for the --login_client_id app, which isn't needed for public clients, since the login flow uses PKCE")
+
+		allowlistDBDSN = fs.String("secret_allowlist_db_dsn", "", "The data source name of the allowlist database, e.g. a postgres:// URL or a SQLite file path")
 	)
+	fs.Var(&requireVerifiedEmails, "require_verified_emails", "A comma-separated list of provider names (e.g. 'azure,oidc', or names from --identity_providers_file) whose users' emails are only checked against the allowlist if the provider says it verified them, e.g. with an 'email_verified' claim. Emails that a provider says are unverified are never checked")
+	fs.Var(&loginScopes, "login_scopes", "A comma-separated list of scopes to request in the server-side login flow, defaults to 'openid'")
+	fs.Var(&loginReturnTo, "login_return_to_origins", "A comma-separated list of origins (e.g. https://pacta.rmi.org) that users can be sent back to after the server-side login flow, via its return_to parameter")
+	fs.Var(&entraTenantIDs, "entra_tenant_ids", "A comma-separated list of the Entra ID tenant (directory) IDs whose users can sign in, see --entra_client_id")
+	fs.Var(&oidcRequiredClaims, "oidc_required_claims", "A comma-separated list of <claim>=<value> pairs that OIDC ID tokens must contain, e.g. 'email_verified=true,hd=example.com'")
+	fs.Var(&siteAudiences, "site_audiences", "A comma-separated list of <site>=<audience> pairs, e.g. 'PACTA=pacta.rmi.org', which are the 'aud' claim of tokens issued for just that site, e.g. by single sign-on, instead of 'rmi.org'")
 	fs.Var(&allowedCORSOrigins, "allowed_cors_origins", "A comma-separated list of CORS origins to allow traffic from")
 	fs.Var(&minLogLevel, "min_log_level", "If set, retains logs at the given level and above. Options: 'debug', 'info', 'warn', 'error', 'dpanic', 'panic', 'fatal' - default warn.")
 
@@ -100,6 +177,35 @@ func run(args []string) error {
 		return fmt.Errorf("failed to parse flags: %v", err)
 	}
 
+	var decrypter *encfile.Decrypter
+	if *decryptionKeyFile != "" {
+		var opts []encfile.Option
+		if *allowPlaintext {
+			opts = append(opts, encfile.AllowPlaintext())
+		}
+		d, err := encfile.NewDecrypterFromKeyFile(*decryptionKeyFile, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to load decryption key: %w", err)
+		}
+		decrypter = d
+	}
+
+	// Flags from --encrypted_config that were already set elsewhere, which we
+	// log once we have a logger.
+	var overridden []string
+	if *encryptedConfig != "" {
+		if decrypter == nil {
+			return errors.New("--encrypted_config requires --decryption_key_file")
+		}
+		dat, err := decrypter.ReadFile(*encryptedConfig)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt config: %w", err)
+		}
+		if overridden, err = parseConfigData(fs, dat); err != nil {
+			return fmt.Errorf("failed to parse encrypted config: %w", err)
+		}
+	}
+
 	reqFlags := []requiredFlag{
 		{
 			name: "env",
@@ -113,6 +219,9 @@ func run(args []string) error {
 	if *useLocalJWTs && *env != "local" {
 		return fmt.Errorf("can only use local JWTs in a local environment, env was %q", *env)
 	}
+	if *azureADBaseURL != "" && *env != "local" {
+		return fmt.Errorf("can only override the Azure AD base URL in a local environment, env was %q", *env)
+	}
 
 	var (
 		logger *zap.Logger
@@ -127,26 +236,44 @@ func run(args []string) error {
 			return fmt.Errorf("failed to init logger: %w", err)
 		}
 	}
+	if len(overridden) > 0 {
+		logger.Warn("Ignoring flags in --encrypted_config that were set on the command line, in the environment, or in --config", zap.Strings("flags", overridden))
+	}
 
-	sec, err := secrets.Load(&secrets.RawConfig{
+	rawSec := &secrets.RawConfig{
 		AuthSigningKey: &secrets.RawAuthSigningKey{
 			ID:   *authKeyID,
 			Data: *authKeyData,
 		},
-		AzureAD: &secrets.RawAzureAD{
+	}
+	// Azure AD is optional when an OIDC provider is configured instead.
+	if *azureADTenantName != "" || *azureADUserFlow != "" || *azureADClientID != "" || *azureADTenantID != "" {
+		rawSec.AzureAD = &secrets.RawAzureAD{
 			TenantName: *azureADTenantName,
 			UserFlow:   *azureADUserFlow,
 			ClientID:   *azureADClientID,
 			TenantID:   *azureADTenantID,
-		},
-	})
+		}
+	}
+	sec, err := secrets.Load(rawSec)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt secrets: %w", err)
 	}
 	priv := sec.AuthSigningKey.PrivateKey
 
-	if !*useLocalJWTs && sec.AzureAD == nil {
-		return errors.New("no Azure AD config was provided, but not running in local JWT mode")
+	if !*useLocalJWTs && sec.AzureAD == nil && *entraClientID == "" && *firebaseProjectID == "" && *cognitoUserPoolID == "" && *oidcDiscoveryURL == "" && *identityProvidersFile == "" {
+		return errors.New("no Azure AD, Entra ID, Firebase, Cognito or OIDC config was provided, but not running in local JWT mode")
+	}
+	if (*entraClientID == "") != (len(entraTenantIDs) == 0) {
+		return errors.New("--entra_client_id and --entra_tenant_ids must be set together")
+	}
+	if (*cognitoUserPoolID == "") != (*cognitoClientID == "") {
+		return errors.New("--cognito_user_pool_id and --cognito_client_id must be set together")
+	}
+
+	oidcClaims, err := parseRequiredClaims(oidcRequiredClaims)
+	if err != nil {
+		return fmt.Errorf("invalid --oidc_required_claims: %w", err)
 	}
 
 	userSwagger, err := user.GetSwagger()
@@ -170,18 +297,57 @@ func run(args []string) error {
 	}
 	jwKey.Set(jwk.KeyIDKey, sec.AuthSigningKey.ID)
 
+	var clientRegistry *clients.Registry
+	if *clientsFile != "" {
+		if len(allowedCORSOrigins) > 0 {
+			return errors.New("--allowed_cors_origins can't be used with --clients_file, which has each client's CORS origins")
+		}
+		if *allowlistDBDriver == "" && !*ssoSingleInstance {
+			return errors.New("--clients_file requires --allowlist_db_driver to share used authorization codes across instances, or --sso_single_instance if there's only one instance")
+		}
+		if clientRegistry, err = loadClients(*clientsFile, decrypter); err != nil {
+			return fmt.Errorf("failed to load clients: %w", err)
+		}
+		allowedCORSOrigins = clientRegistry.CORSOrigins()
+		if len(loginReturnTo) == 0 {
+			loginReturnTo = clientRegistry.RedirectOrigins()
+		}
+	}
+
+	siteAuds, err := parseSiteAudiences(siteAudiences)
+	if err != nil {
+		return fmt.Errorf("failed to parse --site_audiences: %w", err)
+	}
+
+	if *checkTokenRevocation && *allowlistDBDriver == "" {
+		return errors.New("--check_token_revocation requires --allowlist_db_driver, where revoked tokens are recorded")
+	}
+	if *preventSourceTokenReplay && *allowlistDBDriver == "" && !*replaySingleInstance {
+		return errors.New("--prevent_source_token_replay requires --allowlist_db_driver to share exchanged source tokens across instances, or --replay_single_instance if there's only one instance")
+	}
+
+	if *credTestMaxBatchSize <= 0 {
+		return fmt.Errorf("--credential_test_max_batch_size must be positive, was %d", *credTestMaxBatchSize)
+	}
+
 	userSrv := &usersrv.Server{
 		Issuer: &usersrv.TokenIssuer{
-			Key: jwKey,
-			Now: time.Now,
+			Key:             jwKey,
+			Now:             time.Now,
+			SiteAudiences:   siteAuds,
+			IssuerURL:       *tokenIssuer,
+			StructuredSites: *structuredSitesClaim,
 		},
 		Logger:       logger,
 		Now:          func() time.Time { return time.Now().UTC() },
 		CookieDomain: *cookieDomain,
+		Clients:      clientRegistry,
 	}
 	testCredsSrv := &testcredsrv.Server{
-		Now:     func() time.Time { return time.Now().UTC() },
-		JWTAuth: jwtauth.New("EdDSA", nil, priv.Public()),
+		Now:          func() time.Time { return time.Now().UTC() },
+		JWTAuth:      jwtauth.New("EdDSA", nil, priv.Public()),
+		MaxBatchSize: *credTestMaxBatchSize,
+		Clients:      clientRegistry,
 	}
 
 	userStrictHandler := user.NewStrictHandlerWithOptions(userSrv, nil /* middleware */, user.StrictHTTPServerOptions{
@@ -205,6 +371,7 @@ func run(args []string) error {
 			// LogEntry created by the logging middleware.
 			chimiddleware.RequestID,
 			chimiddleware.RealIP,
+			clients.OriginMiddleware,
 			zaphttplog.NewMiddleware(logger),
 			chimiddleware.Recoverer,
 		}
@@ -213,41 +380,258 @@ func run(args []string) error {
 		return r.With(m...)
 	}
 
-	var authenticator, verifier func(http.Handler) http.Handler
+	var (
+		allowlistSrc allowlist.Source
+		allowlistDB  *sql.DB
+	)
+	if *allowlistDBDriver != "" {
+		logger.Info("Loading allowlist from database", zap.String("driver", *allowlistDBDriver))
+		if allowlistDB, err = sql.Open(*allowlistDBDriver, *allowlistDBDSN); err != nil {
+			return fmt.Errorf("failed to open allowlist database: %w", err)
+		}
+		defer allowlistDB.Close()
+		if *allowlistDBCreateSchema {
+			for _, schema := range []string{sqlallowlist.Schema, ssosrv.CodesSchema, sqlrevocation.Schema, authn.ReplaySchema} {
+				if _, err := allowlistDB.ExecContext(ctx, schema); err != nil {
+					return fmt.Errorf("failed to create allowlist database schema: %w", err)
+				}
+			}
+		}
+		if allowlistSrc, err = sqlallowlist.New(ctx, &sqlallowlist.Config{
+			DB:           allowlistDB,
+			Logger:       logger,
+			PollInterval: *allowlistDBPollInterval,
+		}); err != nil {
+			return fmt.Errorf("failed to init database allowlist: %w", err)
+		}
+	} else {
+		checker, err := loadAllowlist(*allowlistFile, decrypter)
+		if err != nil {
+			return fmt.Errorf("failed to init allowlist checker: %w", err)
+		}
+		allowlistSrc = checker
+	}
+
+	if *checkTokenRevocation {
+		if testCredsSrv.Revocation, err = sqlrevocation.New(ctx, allowlistDB, nil); err != nil {
+			return fmt.Errorf("failed to init token revocation checker: %w", err)
+		}
+	}
+
+	// Each provider is registered under a name, which is recorded in the
+	// tokens we issue. The registry routes each token to the provider that
+	// issued it, and applies the allowlist.
+	var registryOpts []authn.RegistryOption
+	if *requireSourceNonce {
+		registryOpts = append(registryOpts, authn.WithRequiredNonce())
+	}
+	if *maxSourceAuthAge > 0 {
+		registryOpts = append(registryOpts, authn.WithMaxAuthAge(*maxSourceAuthAge))
+	}
+	if *preventSourceTokenReplay {
+		var replay authn.ReplayStore
+		if *replaySingleInstance {
+			logger.Warn("Recording exchanged source tokens in memory, which is only safe with a single server instance")
+			replay = authn.NewMemoryReplayStore(nil)
+		} else if replay, err = authn.NewSQLReplayStore(ctx, allowlistDB, nil); err != nil {
+			return fmt.Errorf("failed to init source token replay store: %w", err)
+		}
+		registryOpts = append(registryOpts, authn.WithReplayProtection(replay))
+	}
+	registry := authn.NewRegistry(logger, registryOpts...)
+	// We track which of the --require_verified_emails providers were actually
+	// registered, so that a typo doesn't silently weaken the policy.
+	verifiedEmailProviders := make(map[string]bool)
+	for _, name := range requireVerifiedEmails {
+		verifiedEmailProviders[name] = false
+	}
+	providerOpts := func(name string) []authn.ProviderOption {
+		if _, ok := verifiedEmailProviders[name]; !ok {
+			return nil
+		}
+		verifiedEmailProviders[name] = true
+		return []authn.ProviderOption{authn.RequireVerifiedEmails()}
+	}
 	if *useLocalJWTs {
 		logger.Info("Using local JWTs for source auth, see //cmd/tools/genjwt for more info")
-		localAuth := localjwt.NewAuth(jwtauth.New("EdDSA", priv, priv.Public()), logger)
-		authenticator, verifier = localAuth.Authenticator, localAuth.Verifier
+		localAuth := localjwt.NewAuth(jwtauth.New("EdDSA", priv, priv.Public()))
+		if err := registry.Register("local", localAuth, allowlistSrc, providerOpts("local")...); err != nil {
+			return fmt.Errorf("failed to register local provider: %w", err)
+		}
 	} else {
-		logger.Info("Using Azure AD for source auth",
-			zap.String("tenant_id", sec.AzureAD.TenantID),
-			zap.String("tenant_name", sec.AzureAD.TenantName),
-			zap.String("user_flow", sec.AzureAD.UserFlow),
-			zap.String("client_id", sec.AzureAD.ClientID),
+		if sec.AzureAD != nil {
+			logger.Info("Using Azure AD for source auth",
+				zap.String("tenant_id", sec.AzureAD.TenantID),
+				zap.String("tenant_name", sec.AzureAD.TenantName),
+				zap.Strings("user_flows", sec.AzureAD.UserFlows),
+				zap.String("client_id", sec.AzureAD.ClientID),
+			)
+			// Accept Microsoft-issued JWTs
+			azJWTAuth, err := azjwt.NewAuth(ctx, &azjwt.Config{
+				Logger:   logger,
+				Tenant:   sec.AzureAD.TenantName,
+				TenantID: sec.AzureAD.TenantID,
+				Policies: sec.AzureAD.UserFlows,
+				ClientID: sec.AzureAD.ClientID,
+				BaseURL:  *azureADBaseURL,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to init Azure JWT client: %w", err)
+			}
+			if err := registry.Register("azure", azJWTAuth, allowlistSrc, providerOpts("azure")...); err != nil {
+				return fmt.Errorf("failed to register Azure provider: %w", err)
+			}
+		}
+		if *entraClientID != "" {
+			logger.Info("Using Entra ID for source auth",
+				zap.Strings("tenant_ids", entraTenantIDs),
+				zap.String("client_id", *entraClientID),
+			)
+			entraAuth, err := azjwt.NewEntraAuth(ctx, &azjwt.EntraConfig{
+				Logger:    logger,
+				TenantIDs: entraTenantIDs,
+				ClientID:  *entraClientID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to init Entra ID JWT client: %w", err)
+			}
+			if err := registry.Register("entra", entraAuth, allowlistSrc, providerOpts("entra")...); err != nil {
+				return fmt.Errorf("failed to register Entra ID provider: %w", err)
+			}
+		}
+		if *firebaseProjectID != "" {
+			logger.Info("Using Firebase Auth for source auth", zap.String("project_id", *firebaseProjectID))
+			firebaseAuth, err := firebase.NewAuth(ctx, &firebase.Config{
+				Logger:      logger,
+				ProjectID:   *firebaseProjectID,
+				GroupsClaim: *firebaseGroupsClaim,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to init Firebase JWT client: %w", err)
+			}
+			if err := registry.Register("firebase", firebaseAuth, allowlistSrc, providerOpts("firebase")...); err != nil {
+				return fmt.Errorf("failed to register Firebase provider: %w", err)
+			}
+		}
+		if *cognitoUserPoolID != "" {
+			logger.Info("Using Cognito for source auth",
+				zap.String("user_pool_id", *cognitoUserPoolID),
+				zap.String("client_id", *cognitoClientID),
+			)
+			cognitoAuth, err := cognito.NewAuth(ctx, &cognito.Config{
+				Logger:     logger,
+				UserPoolID: *cognitoUserPoolID,
+				ClientID:   *cognitoClientID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to init Cognito JWT client: %w", err)
+			}
+			if err := registry.Register("cognito", cognitoAuth, allowlistSrc, providerOpts("cognito")...); err != nil {
+				return fmt.Errorf("failed to register Cognito provider: %w", err)
+			}
+		}
+		provCfg := &providersConfig{}
+		if *identityProvidersFile != "" {
+			if provCfg, err = loadProvidersConfig(*identityProvidersFile, decrypter); err != nil {
+				return fmt.Errorf("failed to load identity providers: %w", err)
+			}
+		}
+		if *oidcDiscoveryURL != "" {
+			provCfg.Providers = append(provCfg.Providers, &providerConfig{
+				Name:           "oidc",
+				DiscoveryURL:   *oidcDiscoveryURL,
+				ClientID:       *oidcClientID,
+				EmailClaim:     *oidcEmailClaim,
+				RequiredClaims: oidcClaims,
+			})
+		}
+		if err := registerProviders(ctx, registry, provCfg, allowlistSrc, providerOpts, decrypter, logger); err != nil {
+			return fmt.Errorf("failed to init identity providers: %w", err)
+		}
+	}
+	for name, registered := range verifiedEmailProviders {
+		if !registered {
+			return fmt.Errorf("--require_verified_emails included %q, which isn't a configured provider", name)
+		}
+	}
+
+	// Downstream services verify our tokens with this key set, see the verify
+	// package.
+	jwks, err := userSrv.Issuer.PublicKeySet()
+	if err != nil {
+		return fmt.Errorf("failed to create public key set: %w", err)
+	}
+	jwksJSON, err := json.Marshal(jwks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key set: %w", err)
+	}
+	routerWithMiddleware().Get(verify.JWKSPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(jwksJSON)
+	})
+
+	if *loginDiscoveryURL != "" {
+		logger.Info("Enabling server-side login flow",
+			zap.String("discovery_url", *loginDiscoveryURL),
+			zap.String("client_id", *loginClientID),
+			zap.Strings("return_to_origins", loginReturnTo),
 		)
-		checker, err := allowlist.NewCheckerFromConfigFile(*allowlistFile)
+		loginSrv, err := loginsrv.New(ctx, &loginsrv.Config{
+			Logger:          logger,
+			Registry:        registry,
+			Cookies:         userSrv,
+			DiscoveryURL:    *loginDiscoveryURL,
+			ClientID:        *loginClientID,
+			ClientSecret:    *loginClientSecret,
+			RedirectURL:     *loginRedirectURL,
+			Scopes:          loginScopes,
+			ReturnToOrigins: loginReturnTo,
+			StateKey:        keyutil.DeriveKey(priv.Seed(), "login state"),
+		})
 		if err != nil {
-			return fmt.Errorf("failed to init allowlist checker: %w", err)
+			return fmt.Errorf("failed to init login flow: %w", err)
+		}
+		// These are browser redirects rather than API calls, so they aren't in
+		// the OpenAPI spec, and don't go through the registry middleware, since
+		// the user doesn't have a source token yet.
+		loginRouter := routerWithMiddleware(rateLimitMiddleware(*rateLimitMaxRequests, *rateLimitUnitTime, logger))
+		loginRouter.Get("/login/start", loginSrv.Start)
+		loginRouter.Get("/login/callback", loginSrv.Callback)
+	}
+
+	if clientRegistry != nil {
+		var codes ssosrv.CodeStore
+		if *ssoSingleInstance {
+			logger.Warn("Recording used SSO authorization codes in memory, which is only safe with a single server instance")
+			codes = ssosrv.NewMemoryCodeStore(nil)
+		} else if codes, err = ssosrv.NewSQLCodeStore(ctx, allowlistDB, nil); err != nil {
+			return fmt.Errorf("failed to init SSO code store: %w", err)
 		}
-		// Accept Microsoft-issued JWTs
-		azJWTAuth, err := azjwt.NewAuth(ctx, &azjwt.Config{
-			Logger:    logger,
-			Allowlist: checker,
-			Tenant:    sec.AzureAD.TenantName,
-			TenantID:  sec.AzureAD.TenantID,
-			Policy:    sec.AzureAD.UserFlow,
-			ClientID:  sec.AzureAD.ClientID,
+		ssoSrv, err := ssosrv.New(&ssosrv.Config{
+			Logger:  logger,
+			Clients: clientRegistry,
+			Session: jwtauth.New("EdDSA", nil, priv.Public()),
+			Issuer:  userSrv.Issuer,
+			CodeKey: keyutil.DeriveKey(priv.Seed(), "sso code"),
+			Codes:   codes,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to init Azure JWT client: %w", err)
+			return fmt.Errorf("failed to init single sign-on: %w", err)
 		}
-		authenticator, verifier = azJWTAuth.Authenticator, azJWTAuth.Verifier
+		logger.Info("Enabling single sign-on", zap.Strings("cors_origins", allowedCORSOrigins))
+		// Like the login flow, /sso/authorize is a browser redirect, and
+		// /sso/token is called by sites with their client secret rather than a
+		// source token, so neither is in the OpenAPI spec.
+		ssoRouter := routerWithMiddleware(rateLimitMiddleware(*rateLimitMaxRequests, *rateLimitUnitTime, logger))
+		ssoRouter.Get("/sso/authorize", ssoSrv.Authorize)
+		ssoRouter.Post("/sso/token", ssoSrv.Token)
+		ssoRouter.Post("/sso/site-token", ssoSrv.SiteToken)
 	}
 
 	user.HandlerWithOptions(userStrictHandler, user.ChiServerOptions{
 		BaseRouter: routerWithMiddleware(
-			verifier,
-			authenticator,
+			registry.Middleware,
 			// Use our validation middleware to check all requests against the OpenAPI
 			// schema. We do this after the logging stuff so we have info about
 			// failed/malformed requests.
@@ -302,7 +686,7 @@ func run(args []string) error {
 		handler = cors.New(cors.Options{
 			AllowedOrigins:   allowedCORSOrigins,
 			AllowCredentials: true,
-			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			AllowedHeaders:   []string{"Authorization", "Content-Type", authn.NonceHeader},
 			Debug:            *env == "local",
 		}).Handler(r)
 	} else {
@@ -322,6 +706,120 @@ func run(args []string) error {
 	return nil
 }
 
+// parseConfigData parses flags from config file contents, in the same format
+// as the --config file, and returns the names of flags it skipped. Like
+// --config, flags that were already set take precedence, except for secret
+// flags: a secret set in both places is an error, since it's likely a
+// plaintext copy of the secret that was meant to be removed. We can't use
+// fs.ParseFile directly, because we don't want to write decrypted
+// configuration to disk.
+func parseConfigData(fs *flag.FlagSet, dat []byte) ([]string, error) {
+	alreadySet := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		alreadySet[f.Name] = true
+	})
+
+	var overridden []string
+
+	sc := bufio.NewScanner(bytes.NewReader(dat))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, hasValue := line, "", false
+		if i := strings.IndexAny(line, "= "); i >= 0 {
+			name, value, hasValue = line[:i], line[i+1:], true
+		}
+		if fs.Lookup(name) == nil {
+			return nil, fmt.Errorf("configuration variable provided but not defined: %s", name)
+		}
+		if alreadySet[name] {
+			if strings.HasPrefix(name, "secret_") {
+				return nil, fmt.Errorf("%s was set both in the encrypted config and on the command line, in the environment, or in --config, but secrets should only be set in one place", name)
+			}
+			overridden = append(overridden, name)
+			continue
+		}
+		if !hasValue {
+			// Like --config, a flag without a value is treated as a boolean.
+			value = "true"
+		}
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value for configuration variable %s: %w", name, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return overridden, nil
+}
+
+// parseRequiredClaims parses a list of <claim>=<value> pairs.
+func parseRequiredClaims(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string)
+	for _, p := range pairs {
+		name, value, ok := strings.Cut(p, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q wasn't of the form <claim>=<value>", p)
+		}
+		out[name] = value
+	}
+	return out, nil
+}
+
+func parseSiteAudiences(pairs []string) (map[allowlist.Site]string, error) {
+	out := make(map[allowlist.Site]string)
+	for _, p := range pairs {
+		siteStr, aud, ok := strings.Cut(p, "=")
+		if !ok || aud == "" {
+			return nil, fmt.Errorf("%q wasn't of the form <site>=<audience>", p)
+		}
+		site, err := allowlist.ParseSite(siteStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid site in %q: %w", p, err)
+		}
+		if aud == usersrv.DefaultAudience {
+			return nil, fmt.Errorf("%q used %q, which every session and API key has, so site tokens wouldn't be restricted to the site", p, usersrv.DefaultAudience)
+		}
+		out[site] = aud
+	}
+	return out, nil
+}
+
+func loadAllowlist(fn string, decrypter *encfile.Decrypter) (*allowlist.Checker, error) {
+	if decrypter == nil {
+		return allowlist.NewCheckerFromConfigFile(fn)
+	}
+	dat, err := decrypter.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt allowlist file: %w", err)
+	}
+	cfg, err := allowlist.DecodeConfig(bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	return allowlist.NewChecker(cfg)
+}
+
+func loadClients(fn string, decrypter *encfile.Decrypter) (*clients.Registry, error) {
+	if decrypter == nil {
+		return clients.NewRegistryFromConfigFile(fn)
+	}
+	dat, err := decrypter.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt clients file: %w", err)
+	}
+	cfg, err := clients.DecodeConfig(bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	return clients.NewRegistry(cfg)
+}
+
 func rateLimitMiddleware(maxReq int, windowLength time.Duration, logger *zap.Logger) func(http.Handler) http.Handler {
 	// This example uses an in-memory rate limiter for simplicity, an application
 	// that will be running multiple API instances should likely use something like
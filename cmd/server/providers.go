@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/authn/oidc"
+	"github.com/RMI/credential-service/encfile"
+	"go.uber.org/zap"
+)
+
+// providersConfig is the format of the --identity_providers_file, which
+// describes OIDC identity providers to accept tokens from, in addition to
+// Azure AD B2C and the --oidc_* flags. For example:
+//
+//	{
+//	  "providers": [
+//	    {
+//	      "name": "partner-okta",
+//	      "discoveryURL": "https://partner.okta.com/.well-known/openid-configuration",
+//	      "clientID": "0oa1b2c3d4",
+//	      "requiredClaims": {"email_verified": "true"},
+//	      "allowlistFile": "cmd/server/configs/allowlists/partner.json"
+//	    }
+//	  ]
+//	}
+type providersConfig struct {
+	Providers []*providerConfig `json:"providers"`
+}
+
+type providerConfig struct {
+	// Name identifies the provider in logs and in the 'idp' claim of issued
+	// tokens.
+	Name         string `json:"name"`
+	DiscoveryURL string `json:"discoveryURL"`
+	// ClientID is the expected 'aud' claim of the provider's tokens.
+	ClientID string `json:"clientID"`
+	// EmailClaim is the claim checked against the allowlist, defaults to
+	// 'email'.
+	EmailClaim string `json:"emailClaim,omitempty"`
+	// GroupsClaim is the claim containing the user's groups, which allowlist
+	// entries for the 'groups' claim are checked against. Defaults to 'groups'.
+	GroupsClaim    string            `json:"groupsClaim,omitempty"`
+	RequiredClaims map[string]string `json:"requiredClaims,omitempty"`
+	// AllowlistFile, if set, is checked instead of the shared allowlist for
+	// users from this provider, e.g. to limit a partner's users to one site.
+	AllowlistFile string `json:"allowlistFile,omitempty"`
+}
+
+func loadProvidersConfig(fn string, decrypter *encfile.Decrypter) (*providersConfig, error) {
+	var (
+		dat []byte
+		err error
+	)
+	if decrypter == nil {
+		dat, err = os.ReadFile(fn)
+	} else {
+		dat, err = decrypter.ReadFile(fn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity providers file: %w", err)
+	}
+
+	var cfg providersConfig
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode identity providers file: %w", err)
+	}
+	return &cfg, nil
+}
+
+// registerProviders adds each provider in the config to the registry, with the
+// options returned by providerOpts for its name. Users from providers without
+// their own allowlist are checked against the shared allowlist.
+func registerProviders(ctx context.Context, reg *authn.Registry, cfg *providersConfig, shared allowlist.Source, providerOpts func(name string) []authn.ProviderOption, decrypter *encfile.Decrypter, logger *zap.Logger) error {
+	for i, pc := range cfg.Providers {
+		if pc.Name == "" {
+			return fmt.Errorf("provider %d had no name", i)
+		}
+		if pc.DiscoveryURL == "" {
+			return fmt.Errorf("provider %q had no discoveryURL", pc.Name)
+		}
+
+		src := shared
+		if pc.AllowlistFile != "" {
+			checker, err := loadAllowlist(pc.AllowlistFile, decrypter)
+			if err != nil {
+				return fmt.Errorf("failed to load allowlist for provider %q: %w", pc.Name, err)
+			}
+			src = checker
+		}
+
+		logger.Info("Using OIDC provider for source auth",
+			zap.String("name", pc.Name),
+			zap.String("discovery_url", pc.DiscoveryURL),
+			zap.String("client_id", pc.ClientID),
+		)
+		auth, err := oidc.NewAuth(ctx, &oidc.Config{
+			Logger:         logger.With(zap.String("provider", pc.Name)),
+			DiscoveryURL:   pc.DiscoveryURL,
+			Audience:       pc.ClientID,
+			RequiredClaims: pc.RequiredClaims,
+			EmailsClaim:    pc.EmailClaim,
+			GroupsClaim:    pc.GroupsClaim,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to init OIDC client for provider %q: %w", pc.Name, err)
+		}
+		if err := reg.Register(pc.Name, auth, src, providerOpts(pc.Name)...); err != nil {
+			return fmt.Errorf("failed to register provider %q: %w", pc.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package ssosrv
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCodeUsed is returned by CodeStore.MarkUsed when the code was already
+// exchanged.
+var ErrCodeUsed = errors.New("code was already used")
+
+// CodeStore records which authorization codes were exchanged, so that each
+// can only be exchanged once. Every server instance that shares a CodeKey has
+// to share a CodeStore too, or a code could be exchanged once per instance.
+type CodeStore interface {
+	// MarkUsed records that the code with the given ID was exchanged, or
+	// returns ErrCodeUsed if it already was. The code can be forgotten once it
+	// expires at exp.
+	MarkUsed(ctx context.Context, id string, exp time.Time) error
+}
+
+// MemoryCodeStore is a CodeStore for a single server instance.
+type MemoryCodeStore struct {
+	now func() time.Time
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+var _ CodeStore = (*MemoryCodeStore)(nil)
+
+// NewMemoryCodeStore returns a CodeStore that keeps used codes in memory, so
+// it's only correct when there's one instance of the server. If now is nil,
+// time.Now is used.
+func NewMemoryCodeStore(now func() time.Time) *MemoryCodeStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryCodeStore{now: now, used: make(map[string]time.Time)}
+}
+
+func (m *MemoryCodeStore) MarkUsed(_ context.Context, id string, exp time.Time) error {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for usedID, usedExp := range m.used {
+		if !now.Before(usedExp) {
+			delete(m.used, usedID)
+		}
+	}
+	if _, ok := m.used[id]; ok {
+		return ErrCodeUsed
+	}
+	m.used[id] = exp
+	return nil
+}
+
+// CodesSchema creates the table that SQLCodeStore records used codes in, with
+// their expiry as a Unix timestamp. The schema is compatible with both SQLite
+// and Postgres.
+const CodesSchema = `CREATE TABLE IF NOT EXISTS sso_used_codes (
+	id         TEXT PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+)`
+
+// SQLCodeStore is a CodeStore backed by a SQL database (SQLite or Postgres),
+// which server instances can share.
+type SQLCodeStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+var _ CodeStore = (*SQLCodeStore)(nil)
+
+// NewSQLCodeStore returns a CodeStore that records used codes in the
+// database, which should already have the CodesSchema table. If now is nil,
+// time.Now is used.
+func NewSQLCodeStore(ctx context.Context, db *sql.DB, now func() time.Time) (*SQLCodeStore, error) {
+	if db == nil {
+		return nil, errors.New("no *sql.DB was provided")
+	}
+	if now == nil {
+		now = time.Now
+	}
+	// Fail at startup instead of on the first exchange if the table is missing.
+	rows, err := db.QueryContext(ctx, `SELECT id FROM sso_used_codes LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query used codes table, was it created with ssosrv.CodesSchema?: %w", err)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+	return &SQLCodeStore{db: db, now: now}, nil
+}
+
+func (s *SQLCodeStore) MarkUsed(ctx context.Context, id string, exp time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM sso_used_codes WHERE expires_at <= $1`, s.now().Unix()); err != nil {
+		return fmt.Errorf("failed to delete expired codes: %w", err)
+	}
+	// The primary key makes this atomic across instances: only the first insert
+	// for a code adds a row.
+	res, err := s.db.ExecContext(ctx, `INSERT INTO sso_used_codes (id, expires_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, id, exp.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to record used code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrCodeUsed
+	}
+	return nil
+}
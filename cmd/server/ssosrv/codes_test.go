@@ -0,0 +1,72 @@
+package ssosrv
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestCodeStores(t *testing.T) {
+	stores := map[string]func(t *testing.T, now func() time.Time) CodeStore{
+		"memory": func(t *testing.T, now func() time.Time) CodeStore {
+			return NewMemoryCodeStore(now)
+		},
+		"sql": func(t *testing.T, now func() time.Time) CodeStore {
+			db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "codes.db"))
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+			if _, err := db.Exec(CodesSchema); err != nil {
+				t.Fatalf("failed to create schema: %v", err)
+			}
+			s, err := NewSQLCodeStore(context.Background(), db, now)
+			if err != nil {
+				t.Fatalf("NewSQLCodeStore: %v", err)
+			}
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			s := newStore(t, func() time.Time { return now })
+			exp := now.Add(codeTTL)
+
+			if err := s.MarkUsed(ctx, "code1", exp); err != nil {
+				t.Fatalf("MarkUsed(code1): %v", err)
+			}
+			if err := s.MarkUsed(ctx, "code2", exp); err != nil {
+				t.Fatalf("MarkUsed(code2): %v", err)
+			}
+			if err := s.MarkUsed(ctx, "code1", exp); !errors.Is(err, ErrCodeUsed) {
+				t.Fatalf("MarkUsed(code1) again = %v, want ErrCodeUsed", err)
+			}
+
+			// Once codes expire, they're forgotten.
+			now = exp
+			if err := s.MarkUsed(ctx, "code1", now.Add(codeTTL)); err != nil {
+				t.Fatalf("MarkUsed(code1) after expiry: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewSQLCodeStore_NoTable(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "codes.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := NewSQLCodeStore(context.Background(), db, nil); err == nil {
+		t.Error("NewSQLCodeStore returned no error for a database without the codes table")
+	}
+}
@@ -0,0 +1,519 @@
+// Package ssosrv implements single sign-on across RMI sites. A site that
+// needs the user to log in redirects them to GET /sso/authorize with its
+// client ID and redirect URI. If the user already has a session (the 'jwt'
+// cookie from logging in to another site), we immediately redirect them back
+// with a one-time authorization code, which the site exchanges server-side at
+// POST /sso/token for a token scoped to just that site. This is a minimal
+// subset of the OAuth 2.0 authorization code flow, see
+// https://www.rfc-editor.org/rfc/rfc6749#section-4.1
+//
+// Sites' frontends can also exchange the session directly for a site-scoped
+// token at POST /sso/site-token, but only for the site of the client whose
+// origin the request comes from. Site-scoped tokens have the site's audience
+// (see usersrv.TokenIssuer.SiteAudiences), so they're only accepted by that
+// site's services.
+package ssosrv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/authn"
+	"github.com/RMI/credential-service/clients"
+	"github.com/RMI/credential-service/cmd/server/usersrv"
+	"github.com/RMI/credential-service/sitesclaim"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+)
+
+// codeTTL is how long sites have to exchange an authorization code, which they
+// should do immediately.
+const codeTTL = time.Minute
+
+// TokenIssuer issues site-scoped tokens, which *usersrv.TokenIssuer
+// implements. If aud is empty, the site's configured audience is used, and if
+// there isn't one, usersrv.ErrNoAudience is returned. Site tokens can't have
+// usersrv.DefaultAudience, see usersrv.ErrDefaultAudience.
+type TokenIssuer interface {
+	IssueSiteToken(userID, idp, idpPolicy string, emails, roles []string, site allowlist.Site, aud, scope string, exp time.Time) (string, string, error)
+}
+
+type Server struct {
+	logger  *zap.Logger
+	clients *clients.Registry
+	session *jwtauth.JWTAuth
+	issuer  TokenIssuer
+	codeKey []byte
+	codes   CodeStore
+	now     func() time.Time
+}
+
+type Config struct {
+	Logger *zap.Logger
+	// Clients are the sites that users can sign on to.
+	Clients *clients.Registry
+	// Session verifies the user's 'jwt' cookie, so it should have the public
+	// key that we sign tokens with.
+	Session *jwtauth.JWTAuth
+	Issuer  TokenIssuer
+	// CodeKey encrypts authorization codes, see keyutil.DeriveKey. It has to be
+	// 32 bytes, and the same on every instance of the server.
+	CodeKey []byte
+	// Codes records exchanged codes, so each can only be exchanged once. It has
+	// to be shared by every instance of the server, see CodeStore.
+	Codes CodeStore
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+func (c *Config) validate() error {
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+	if c.Session == nil {
+		return errors.New("no session *jwtauth.JWTAuth was provided")
+	}
+	if c.Issuer == nil {
+		return errors.New("no TokenIssuer was provided")
+	}
+	if len(c.CodeKey) != 32 {
+		return errors.New("code key should be 32 bytes")
+	}
+	if c.Codes == nil {
+		return errors.New("no CodeStore was provided")
+	}
+
+	if c.Clients == nil {
+		return errors.New("no *clients.Registry was provided")
+	}
+
+	return nil
+}
+
+func New(cfg *Config) (*Server, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &Server{
+		logger:  cfg.Logger,
+		clients: cfg.Clients,
+		session: cfg.Session,
+		issuer:  cfg.Issuer,
+		codeKey: cfg.CodeKey,
+		codes:   cfg.Codes,
+		now:     now,
+	}, nil
+}
+
+// authCode is the contents of an authorization code. Codes are encrypted, so
+// sites can't read or modify them, and the user's details don't end up in
+// the logs of whatever the redirect passes through.
+type authCode struct {
+	ID          string `json:"jti"`
+	ClientID    string `json:"client_id"`
+	RedirectURI string `json:"redirect_uri"`
+	Expires     int64  `json:"exp"`
+
+	Subject   string   `json:"sub"`
+	Emails    []string `json:"emails,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	IDP       string   `json:"idp,omitempty"`
+	IDPPolicy string   `json:"idp_policy,omitempty"`
+	// SessionExpires caps the lifetime of the site-scoped token.
+	SessionExpires int64 `json:"session_exp"`
+}
+
+// Authorize sends the user back to the site with an authorization code if
+// they have a session, or with an 'error' parameter if not.
+// (GET /sso/authorize?client_id=...&redirect_uri=...&state=...)
+func (s *Server) Authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	// Until the client and redirect URI are checked, we can't send the user
+	// anywhere, or we'd be an open redirect.
+	c, ok := s.clients.Client(q.Get("client_id"))
+	if !ok {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if !c.AllowsRedirect(redirectURI) {
+		s.logger.Warn("rejecting SSO with unregistered redirect_uri", zap.String("client_id", c.ID), zap.String("redirect_uri", redirectURI))
+		http.Error(w, "redirect_uri isn't registered for client", http.StatusBadRequest)
+		return
+	}
+	redirect := func(params url.Values) {
+		if state := q.Get("state"); state != "" {
+			params.Set("state", state)
+		}
+		u, _ := url.Parse(redirectURI) // Already validated.
+		uq := u.Query()
+		for k, v := range params {
+			uq[k] = v
+		}
+		u.RawQuery = uq.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	}
+
+	session, err := s.loadSession(r)
+	if err != nil {
+		s.logger.Info("no valid session for SSO", zap.String("client_id", c.ID), zap.Error(err))
+		redirect(url.Values{"error": {"login_required"}})
+		return
+	}
+	if sites, err := sessionSites(session); err != nil || !sites.Allows(c.Site) {
+		s.logger.Info("user isn't allowed to access SSO client's site", zap.String("client_id", c.ID), zap.Error(err))
+		redirect(url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	code, err := s.newCode(c, redirectURI, session)
+	if err != nil {
+		s.logger.Error("failed to create authorization code", zap.Error(err))
+		redirect(url.Values{"error": {"server_error"}})
+		return
+	}
+	redirect(url.Values{"code": {code}})
+}
+
+func (s *Server) loadSession(r *http.Request) (jwt.Token, error) {
+	tknStr := jwtauth.TokenFromCookie(r)
+	if tknStr == "" {
+		return nil, jwtauth.ErrNoTokenFound
+	}
+	tkn, err := jwtauth.VerifyToken(s.session, tknStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify session: %w", err)
+	}
+	if _, ok := tkn.Get("local_auth"); ok {
+		// Local source tokens are signed with the same key, but aren't sessions.
+		return nil, errors.New("session was a source token")
+	}
+	if tkn.Subject() == "" {
+		return nil, errors.New("session had no 'sub' claim")
+	}
+	// Site-scoped tokens are only for their site's services, so they can't be
+	// exchanged for tokens for other sites.
+	if aud := tkn.Audience(); len(aud) != 1 || aud[0] != usersrv.DefaultAudience {
+		return nil, fmt.Errorf("session had audience %q, not %q", aud, usersrv.DefaultAudience)
+	}
+	// API keys are long-lived bearer credentials, which don't mean the user is
+	// logged in, so only session tokens count.
+	if use, _ := tkn.Get(usersrv.TokenUseClaim); use != string(usersrv.TokenUseSession) {
+		return nil, fmt.Errorf("session had %s %q, not %q", usersrv.TokenUseClaim, use, usersrv.TokenUseSession)
+	}
+	return tkn, nil
+}
+
+func (s *Server) newCode(c *clients.Client, redirectURI string, session jwt.Token) (string, error) {
+	sc, err := claimsFromSession(session)
+	if err != nil {
+		return "", err
+	}
+	ac := &authCode{
+		ID:             randomString(),
+		ClientID:       c.ID,
+		RedirectURI:    redirectURI,
+		Expires:        s.now().Add(codeTTL).Unix(),
+		Subject:        session.Subject(),
+		Emails:         sc.Emails,
+		Roles:          sc.Roles,
+		IDP:            sc.IDP,
+		IDPPolicy:      sc.IDPPolicy,
+		SessionExpires: session.Expiration().Unix(),
+	}
+
+	payload, err := json.Marshal(ac)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal code: %w", err)
+	}
+	dat, err := jwe.Encrypt(payload, jwe.WithKey(jwa.DIRECT, s.codeKey), jwe.WithContentEncryption(jwa.A256GCM))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt code: %w", err)
+	}
+	return string(dat), nil
+}
+
+// sessionClaims are the claims of the session that are copied into
+// site-scoped tokens.
+type sessionClaims struct {
+	Emails    []string
+	Roles     []string
+	IDP       string
+	IDPPolicy string
+}
+
+func claimsFromSession(session jwt.Token) (*sessionClaims, error) {
+	var sc sessionClaims
+	if v, ok := session.Get("emails"); ok {
+		emails, err := authn.StringsFromClaim(v)
+		if err != nil {
+			return nil, fmt.Errorf("session had invalid 'emails' claim: %w", err)
+		}
+		sc.Emails = emails
+	}
+	if v, ok := session.Get("roles"); ok {
+		roles, err := authn.StringsFromClaim(v)
+		if err != nil {
+			return nil, fmt.Errorf("session had invalid 'roles' claim: %w", err)
+		}
+		sc.Roles = roles
+	}
+	if v, ok := session.Get("idp"); ok {
+		sc.IDP, _ = v.(string)
+	}
+	if v, ok := session.Get("idp_policy"); ok {
+		sc.IDPPolicy, _ = v.(string)
+	}
+	return &sc, nil
+}
+
+// sessionSites returns the sites the session's user can access, in either form
+// of the claim.
+func sessionSites(session jwt.Token) (*sitesclaim.Claim, error) {
+	v, ok := session.Get(sitesclaim.Name)
+	if !ok {
+		return nil, errors.New("session had no 'sites' claim")
+	}
+	return sitesclaim.Parse(v)
+}
+
+// tokenError is an error response from the token endpoint, see
+// https://www.rfc-editor.org/rfc/rfc6749#section-5.2
+type tokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+// Token exchanges an authorization code for a token scoped to the client's
+// site. Clients authenticate with their secret, either with HTTP basic auth
+// or 'client_id' and 'client_secret' form parameters, and can request any of
+// their registered scopes with a space-delimited 'scope' parameter.
+// (POST /sso/token)
+func (s *Server) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	resp, tErr := s.token(r)
+	if tErr != nil {
+		w.WriteHeader(tErr.status)
+		if err := json.NewEncoder(w).Encode(tErr); err != nil {
+			s.logger.Warn("failed to write token error", zap.Error(err))
+		}
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.Warn("failed to write token response", zap.Error(err))
+	}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+func (s *Server) token(r *http.Request) (*tokenResponse, *tokenError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &tokenError{Code: "invalid_request", Description: "failed to parse form", status: http.StatusBadRequest}
+	}
+	if gt := r.PostForm.Get("grant_type"); gt != "authorization_code" {
+		return nil, &tokenError{Code: "unsupported_grant_type", status: http.StatusBadRequest}
+	}
+
+	c, err := s.clients.AuthenticateRequest(r)
+	if err != nil {
+		s.logger.Warn("SSO client failed to authenticate", zap.Error(err))
+		return nil, &tokenError{Code: "invalid_client", status: http.StatusUnauthorized}
+	}
+
+	ac, err := s.redeemCode(r.Context(), r.PostForm.Get("code"))
+	if errors.Is(err, errCodeStore) {
+		s.logger.Error("failed to redeem authorization code", zap.String("client_id", c.ID), zap.Error(err))
+		return nil, &tokenError{Code: "server_error", status: http.StatusInternalServerError}
+	} else if err != nil {
+		s.logger.Warn("failed to redeem authorization code", zap.String("client_id", c.ID), zap.Error(err))
+		return nil, &tokenError{Code: "invalid_grant", status: http.StatusBadRequest}
+	}
+	if ac.ClientID != c.ID || ac.RedirectURI != r.PostForm.Get("redirect_uri") {
+		s.logger.Warn("authorization code was issued for another client or redirect_uri", zap.String("client_id", c.ID), zap.String("code_client_id", ac.ClientID))
+		return nil, &tokenError{Code: "invalid_grant", status: http.StatusBadRequest}
+	}
+
+	// Clients can request one of their other audiences, see
+	// https://www.rfc-editor.org/rfc/rfc8707
+	aud := r.PostForm.Get("audience")
+	if aud != "" && !c.AllowsAudience(aud) {
+		s.logger.Warn("SSO client requested an audience it isn't registered for", zap.String("client_id", c.ID), zap.String("audience", aud))
+		return nil, &tokenError{Code: "invalid_target", status: http.StatusBadRequest}
+	}
+
+	// See https://www.rfc-editor.org/rfc/rfc6749#section-3.3
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+	for _, sc := range scopes {
+		if !c.AllowsScope(sc) {
+			s.logger.Warn("SSO client requested a scope it isn't registered for", zap.String("client_id", c.ID), zap.String("scope", sc))
+			return nil, &tokenError{Code: "invalid_scope", status: http.StatusBadRequest}
+		}
+	}
+	scope := strings.Join(scopes, " ")
+
+	exp := time.Unix(ac.SessionExpires, 0)
+	tkn, id, err := s.issuer.IssueSiteToken(ac.Subject, ac.IDP, ac.IDPPolicy, ac.Emails, ac.Roles, c.Site, aud, scope, exp)
+	if err != nil {
+		return nil, s.issueError(err)
+	}
+	s.logger.Info("issuing SSO token",
+		zap.String("id", id),
+		zap.String("client_id", c.ID),
+		zap.String("site", string(c.Site)),
+		zap.String("audience", aud),
+		zap.String("scope", scope),
+		zap.String("idp", ac.IDP),
+	)
+	return &tokenResponse{
+		AccessToken: tkn,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(exp.Sub(s.now()).Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func (s *Server) issueError(err error) *tokenError {
+	if errors.Is(err, usersrv.ErrNoAudience) {
+		s.logger.Error("no audience is configured for site, see --site_audiences", zap.Error(err))
+		return &tokenError{Code: "invalid_target", Description: "no audience is configured for site", status: http.StatusBadRequest}
+	}
+	if errors.Is(err, usersrv.ErrDefaultAudience) {
+		s.logger.Error("client requested the default audience for a site token, remove it from the client's audiences", zap.Error(err))
+		return &tokenError{Code: "invalid_target", Description: "site tokens can't have the default audience", status: http.StatusBadRequest}
+	}
+	s.logger.Error("failed to issue site token", zap.Error(err))
+	return &tokenError{Code: "server_error", status: http.StatusInternalServerError}
+}
+
+// SiteToken exchanges the user's session for a token scoped to one site, and
+// restricted to its audience, e.g. for the site's frontend to call its own
+// backend with. Unlike the session, the token can't be replayed at services
+// for other sites. The request's Origin has to belong to a client for the
+// site, so one site's frontend can't get tokens for another.
+// (POST /sso/site-token, with a 'site' form parameter)
+func (s *Server) SiteToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	resp, tErr := s.siteToken(r)
+	if tErr != nil {
+		w.WriteHeader(tErr.status)
+		if err := json.NewEncoder(w).Encode(tErr); err != nil {
+			s.logger.Warn("failed to write site token error", zap.Error(err))
+		}
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.Warn("failed to write site token response", zap.Error(err))
+	}
+}
+
+func (s *Server) siteToken(r *http.Request) (*tokenResponse, *tokenError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &tokenError{Code: "invalid_request", Description: "failed to parse form", status: http.StatusBadRequest}
+	}
+	site, err := allowlist.ParseSite(r.PostForm.Get("site"))
+	if err != nil {
+		return nil, &tokenError{Code: "invalid_request", Description: "invalid site", status: http.StatusBadRequest}
+	}
+	origin := r.Header.Get("Origin")
+	if c, ok := s.clients.ForOrigin(origin); !ok || c.Site != site {
+		s.logger.Warn("site token requested from an origin that isn't registered for the site", zap.String("site", string(site)), zap.String("origin", origin))
+		return nil, &tokenError{Code: "unauthorized_client", Description: "origin isn't registered for site", status: http.StatusForbidden}
+	}
+
+	session, err := s.loadSession(r)
+	if err != nil {
+		s.logger.Info("no valid session for site token", zap.Error(err))
+		return nil, &tokenError{Code: "login_required", status: http.StatusUnauthorized}
+	}
+	if sites, err := sessionSites(session); err != nil || !sites.Allows(site) {
+		s.logger.Info("user isn't allowed to access site", zap.String("site", string(site)), zap.Error(err))
+		return nil, &tokenError{Code: "access_denied", status: http.StatusForbidden}
+	}
+	sc, err := claimsFromSession(session)
+	if err != nil {
+		s.logger.Warn("invalid session", zap.Error(err))
+		return nil, &tokenError{Code: "login_required", status: http.StatusUnauthorized}
+	}
+
+	exp := session.Expiration()
+	tkn, id, err := s.issuer.IssueSiteToken(session.Subject(), sc.IDP, sc.IDPPolicy, sc.Emails, sc.Roles, site, "", "", exp)
+	if err != nil {
+		return nil, s.issueError(err)
+	}
+	s.logger.Info("issuing site token",
+		zap.String("id", id),
+		zap.String("site", string(site)),
+		zap.String("idp", sc.IDP),
+	)
+	return &tokenResponse{
+		AccessToken: tkn,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(exp.Sub(s.now()).Seconds()),
+	}, nil
+}
+
+// errCodeStore wraps errors from the CodeStore, as opposed to invalid codes.
+var errCodeStore = errors.New("code store failed")
+
+// redeemCode decrypts an authorization code, and marks it as used.
+func (s *Server) redeemCode(ctx context.Context, code string) (*authCode, error) {
+	if code == "" {
+		return nil, errors.New("no code was provided")
+	}
+	payload, err := jwe.Decrypt([]byte(code), jwe.WithKey(jwa.DIRECT, s.codeKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt code: %w", err)
+	}
+	var ac authCode
+	if err := json.Unmarshal(payload, &ac); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal code: %w", err)
+	}
+
+	now := s.now()
+	exp := time.Unix(ac.Expires, 0)
+	if !now.Before(exp) {
+		return nil, errors.New("code has expired")
+	}
+
+	if err := s.codes.MarkUsed(ctx, ac.ID, exp); errors.Is(err, ErrCodeUsed) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCodeStore, err)
+	}
+	return &ac, nil
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on any platform we run on.
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
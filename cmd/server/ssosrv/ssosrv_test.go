@@ -0,0 +1,537 @@
+package ssosrv
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/clients"
+	"github.com/RMI/credential-service/cmd/server/usersrv"
+	"github.com/RMI/credential-service/keyutil"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	pactaRedirect = "https://pacta.example.com/auth/callback"
+	opgeeRedirect = "https://opgee.example.com/auth/callback"
+)
+
+func TestSSO(t *testing.T) {
+	env := setup(t)
+	session := env.session(t, &allowlist.Entity{AllowAllSites: true})
+
+	// PACTA redirects the user to us, and they come back with a code.
+	w := env.authorize(t, "pacta", pactaRedirect, session)
+	if w.Code != http.StatusFound {
+		t.Fatalf("/sso/authorize returned status %d, want %d", w.Code, http.StatusFound)
+	}
+	params := redirectParams(t, w, pactaRedirect)
+	if got := params.Get("state"); got != "test-state" {
+		t.Errorf("state = %q, want %q", got, "test-state")
+	}
+	code := params.Get("code")
+
+	// PACTA's backend exchanges the code for a token scoped to PACTA.
+	w = env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"pacta"},
+		"client_secret": {"pacta-secret"},
+		"redirect_uri":  {pactaRedirect},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("/sso/token returned status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp tokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode token response: %v", err)
+	}
+	tkn, err := jwtauth.VerifyToken(env.srv.session, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to verify issued token: %v", err)
+	}
+	got := map[string]any{"sub": tkn.Subject(), "aud": tkn.Audience(), "idp": mustGet(tkn.Get("idp")), "sites": mustGet(tkn.Get("sites")), "emails": mustGet(tkn.Get("emails"))}
+	want := map[string]any{"sub": "user123", "aud": []string{"pacta.example.com"}, "idp": "azure", "sites": "PACTA", "emails": []any{"user@example.com"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected token claims (-want +got)\n%s", diff)
+	}
+
+	// Codes can only be used once.
+	w = env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"pacta"},
+		"client_secret": {"pacta-secret"},
+		"redirect_uri":  {pactaRedirect},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("reusing code returned status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAuthorize_Errors(t *testing.T) {
+	env := setup(t)
+
+	tests := []struct {
+		desc        string
+		clientID    string
+		redirectURI string
+		session     string
+		wantStatus  int
+		wantError   string
+	}{
+		{
+			desc:        "unknown client",
+			clientID:    "unknown",
+			redirectURI: pactaRedirect,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			desc:        "unregistered redirect URI",
+			clientID:    "pacta",
+			redirectURI: "https://evil.example.com/callback",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			desc:        "other client's redirect URI",
+			clientID:    "pacta",
+			redirectURI: opgeeRedirect,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			desc:        "no session",
+			clientID:    "pacta",
+			redirectURI: pactaRedirect,
+			wantStatus:  http.StatusFound,
+			wantError:   "login_required",
+		},
+		{
+			desc:        "session for another site",
+			clientID:    "opgee",
+			redirectURI: opgeeRedirect,
+			session:     env.session(t, &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}}),
+			wantStatus:  http.StatusFound,
+			wantError:   "access_denied",
+		},
+		{
+			desc:        "invalid session",
+			clientID:    "pacta",
+			redirectURI: pactaRedirect,
+			session:     "not-a-token",
+			wantStatus:  http.StatusFound,
+			wantError:   "login_required",
+		},
+		{
+			desc:        "site token as session",
+			clientID:    "pacta",
+			redirectURI: pactaRedirect,
+			session:     env.siteToken(t, allowlist.SitePACTA),
+			wantStatus:  http.StatusFound,
+			wantError:   "login_required",
+		},
+		{
+			desc:        "API key as session",
+			clientID:    "pacta",
+			redirectURI: pactaRedirect,
+			session:     env.apiKey(t, &allowlist.Entity{AllowAllSites: true}),
+			wantStatus:  http.StatusFound,
+			wantError:   "login_required",
+		},
+		{
+			// Allowlist entries that end soon cap the expiry of API keys, so
+			// they can be as short-lived as a session.
+			desc:        "API key capped by allowlist entry as session",
+			clientID:    "pacta",
+			redirectURI: pactaRedirect,
+			session:     env.apiKey(t, &allowlist.Entity{AllowAllSites: true, NotAfter: time.Now().Add(time.Hour)}),
+			wantStatus:  http.StatusFound,
+			wantError:   "login_required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			w := env.authorize(t, test.clientID, test.redirectURI, test.session)
+			if w.Code != test.wantStatus {
+				t.Fatalf("/sso/authorize returned status %d, want %d", w.Code, test.wantStatus)
+			}
+			if w.Code != http.StatusFound {
+				return
+			}
+			params := redirectParams(t, w, test.redirectURI)
+			if got := params.Get("error"); got != test.wantError {
+				t.Errorf("error = %q, want %q", got, test.wantError)
+			}
+			if params.Has("code") {
+				t.Error("redirect included a code, want none")
+			}
+		})
+	}
+}
+
+func TestToken_Errors(t *testing.T) {
+	env := setup(t)
+	session := env.session(t, &allowlist.Entity{AllowAllSites: true})
+	newCode := func() string {
+		w := env.authorize(t, "pacta", pactaRedirect, session)
+		return redirectParams(t, w, pactaRedirect).Get("code")
+	}
+
+	tests := []struct {
+		desc       string
+		form       url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{
+			desc:       "wrong secret",
+			form:       url.Values{"client_id": {"pacta"}, "client_secret": {"wrong"}, "redirect_uri": {pactaRedirect}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			desc:       "code for another client",
+			form:       url.Values{"client_id": {"opgee"}, "client_secret": {"opgee-secret"}, "redirect_uri": {pactaRedirect}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			desc:       "different redirect URI",
+			form:       url.Values{"client_id": {"pacta"}, "client_secret": {"pacta-secret"}, "redirect_uri": {"https://pacta.example.com/other"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			desc:       "unregistered audience",
+			form:       url.Values{"client_id": {"pacta"}, "client_secret": {"pacta-secret"}, "redirect_uri": {pactaRedirect}, "audience": {"opgee-api"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_target",
+		},
+		{
+			desc:       "registered default audience",
+			form:       url.Values{"client_id": {"pacta"}, "client_secret": {"pacta-secret"}, "redirect_uri": {pactaRedirect}, "audience": {usersrv.DefaultAudience}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_target",
+		},
+		{
+			desc:       "unregistered scope",
+			form:       url.Values{"client_id": {"pacta"}, "client_secret": {"pacta-secret"}, "redirect_uri": {pactaRedirect}, "scope": {"pacta:read pacta:admin"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_scope",
+		},
+		{
+			desc:       "tampered code",
+			form:       url.Values{"client_id": {"pacta"}, "client_secret": {"pacta-secret"}, "redirect_uri": {pactaRedirect}, "code": {"garbage"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.form.Set("grant_type", "authorization_code")
+			if !test.form.Has("code") {
+				test.form.Set("code", newCode())
+			}
+			w := env.token(t, test.form)
+			if w.Code != test.wantStatus {
+				t.Fatalf("/sso/token returned status %d, want %d", w.Code, test.wantStatus)
+			}
+			var resp tokenError
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if resp.Code != test.wantError {
+				t.Errorf("error = %q, want %q", resp.Code, test.wantError)
+			}
+		})
+	}
+}
+
+func TestToken_Audience(t *testing.T) {
+	env := setup(t)
+	w := env.authorize(t, "pacta", pactaRedirect, env.session(t, &allowlist.Entity{AllowAllSites: true}))
+	code := redirectParams(t, w, pactaRedirect).Get("code")
+
+	w = env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"pacta"},
+		"client_secret": {"pacta-secret"},
+		"redirect_uri":  {pactaRedirect},
+		"audience":      {"pacta-api"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("/sso/token returned status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp tokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode token response: %v", err)
+	}
+	tkn, err := jwtauth.VerifyToken(env.srv.session, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to verify issued token: %v", err)
+	}
+	if diff := cmp.Diff([]string{"pacta-api"}, tkn.Audience()); diff != "" {
+		t.Errorf("unexpected audience (-want +got)\n%s", diff)
+	}
+}
+
+func TestToken_ScopeAndRoles(t *testing.T) {
+	env := setup(t)
+	session := env.session(t, &allowlist.Entity{AllowAllSites: true, Roles: []string{"admin", "viewer"}})
+	w := env.authorize(t, "pacta", pactaRedirect, session)
+	code := redirectParams(t, w, pactaRedirect).Get("code")
+
+	w = env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"pacta"},
+		"client_secret": {"pacta-secret"},
+		"redirect_uri":  {pactaRedirect},
+		"scope":         {"pacta:read  pacta:write"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("/sso/token returned status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp tokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode token response: %v", err)
+	}
+	if want := "pacta:read pacta:write"; resp.Scope != want {
+		t.Errorf("response scope = %q, want %q", resp.Scope, want)
+	}
+	tkn, err := jwtauth.VerifyToken(env.srv.session, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to verify issued token: %v", err)
+	}
+	got := map[string]any{"scope": mustGet(tkn.Get("scope")), "roles": mustGet(tkn.Get("roles"))}
+	want := map[string]any{"scope": "pacta:read pacta:write", "roles": []any{"admin", "viewer"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected token claims (-want +got)\n%s", diff)
+	}
+}
+
+func TestSiteToken(t *testing.T) {
+	env := setup(t)
+	pactaOnly := env.session(t, &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}})
+	all := env.session(t, &allowlist.Entity{AllowAllSites: true})
+	withRoles := env.session(t, &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}, Roles: []string{"admin"}})
+	env.issuer.StructuredSites = true
+	structured := env.session(t, &allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SitePACTA}})
+	env.issuer.StructuredSites = false
+
+	const (
+		pactaOrigin = "https://pacta.example.com"
+		opgeeOrigin = "https://opgee.example.com"
+	)
+
+	tests := []struct {
+		desc       string
+		site       string
+		origin     string
+		session    string
+		wantStatus int
+		wantError  string
+		wantRoles  any
+	}{
+		{desc: "success", site: "PACTA", origin: pactaOrigin, session: pactaOnly, wantStatus: http.StatusOK},
+		{desc: "session with roles", site: "PACTA", origin: pactaOrigin, session: withRoles, wantStatus: http.StatusOK, wantRoles: []any{"admin"}},
+		{desc: "no session", site: "PACTA", origin: pactaOrigin, wantStatus: http.StatusUnauthorized, wantError: "login_required"},
+		{desc: "site not allowed", site: "OPGEE", origin: opgeeOrigin, session: pactaOnly, wantStatus: http.StatusForbidden, wantError: "access_denied"},
+		{desc: "structured sites claim", site: "PACTA", origin: pactaOrigin, session: structured, wantStatus: http.StatusOK},
+		{desc: "structured sites claim, site not allowed", site: "OPGEE", origin: opgeeOrigin, session: structured, wantStatus: http.StatusForbidden, wantError: "access_denied"},
+		{desc: "unknown site", site: "NOTASITE", origin: pactaOrigin, session: all, wantStatus: http.StatusBadRequest, wantError: "invalid_request"},
+		{desc: "no audience configured", site: "OPGEE", origin: opgeeOrigin, session: all, wantStatus: http.StatusBadRequest, wantError: "invalid_target"},
+		{desc: "no origin", site: "PACTA", session: all, wantStatus: http.StatusForbidden, wantError: "unauthorized_client"},
+		{desc: "unregistered origin", site: "PACTA", origin: "https://evil.example.com", session: all, wantStatus: http.StatusForbidden, wantError: "unauthorized_client"},
+		{desc: "other site's origin", site: "PACTA", origin: opgeeOrigin, session: all, wantStatus: http.StatusForbidden, wantError: "unauthorized_client"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			form := url.Values{"site": {test.site}}
+			req := httptest.NewRequest(http.MethodPost, "/sso/site-token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			if test.session != "" {
+				req.AddCookie(&http.Cookie{Name: "jwt", Value: test.session})
+			}
+			w := httptest.NewRecorder()
+			env.srv.SiteToken(w, req)
+			if w.Code != test.wantStatus {
+				t.Fatalf("/sso/site-token returned status %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+
+			if test.wantError != "" {
+				var resp tokenError
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("failed to decode error response: %v", err)
+				}
+				if resp.Code != test.wantError {
+					t.Errorf("error = %q, want %q", resp.Code, test.wantError)
+				}
+				return
+			}
+
+			var resp tokenResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode token response: %v", err)
+			}
+			tkn, err := jwtauth.VerifyToken(env.srv.session, resp.AccessToken)
+			if err != nil {
+				t.Fatalf("failed to verify issued token: %v", err)
+			}
+			roles, _ := tkn.Get("roles")
+			got := map[string]any{"sub": tkn.Subject(), "aud": tkn.Audience(), "sites": mustGet(tkn.Get("sites")), "roles": roles}
+			want := map[string]any{"sub": "user123", "aud": []string{"pacta.example.com"}, "sites": "PACTA", "roles": test.wantRoles}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("unexpected token claims (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestToken_ExpiredCode(t *testing.T) {
+	env := setup(t)
+	now := time.Now()
+	env.srv.now = func() time.Time { return now }
+	w := env.authorize(t, "pacta", pactaRedirect, env.session(t, &allowlist.Entity{AllowAllSites: true}))
+	code := redirectParams(t, w, pactaRedirect).Get("code")
+
+	now = now.Add(codeTTL)
+	w = env.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"pacta"},
+		"client_secret": {"pacta-secret"},
+		"redirect_uri":  {pactaRedirect},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("/sso/token returned status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+type testEnv struct {
+	srv    *Server
+	issuer *usersrv.TokenIssuer
+}
+
+func setup(t *testing.T) *testEnv {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		t.Fatalf("failed to make JWK: %v", err)
+	}
+	issuer := &usersrv.TokenIssuer{
+		Key: key,
+		Now: time.Now,
+		SiteAudiences: map[allowlist.Site]string{
+			allowlist.SitePACTA: "pacta.example.com",
+		},
+	}
+	reg, err := clients.NewRegistry(&clients.Config{
+		Format: "v1",
+		Clients: []*clients.Client{
+			{ID: "pacta", SecretHash: clients.HashSecret("pacta-secret"), Site: allowlist.SitePACTA, RedirectURIs: []string{pactaRedirect}, Audiences: []string{"pacta-api", usersrv.DefaultAudience}, Scopes: []string{"pacta:read", "pacta:write"}},
+			{ID: "opgee", SecretHash: clients.HashSecret("opgee-secret"), Site: allowlist.SiteOPGEE, RedirectURIs: []string{opgeeRedirect}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client registry: %v", err)
+	}
+	srv, err := New(&Config{
+		Logger:  zaptest.NewLogger(t),
+		Clients: reg,
+		Session: jwtauth.New("EdDSA", nil, pub),
+		Issuer:  issuer,
+		CodeKey: keyutil.DeriveKey(priv.Seed(), "sso code"),
+		Codes:   NewMemoryCodeStore(nil),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return &testEnv{srv: srv, issuer: issuer}
+}
+
+// session returns a 'jwt' cookie value, like the one issued by /login/cookie.
+func (env *testEnv) session(t *testing.T, ae *allowlist.Entity) string {
+	tkn, _, err := env.issuer.IssueToken(usersrv.TokenUseSession, "user123", "azure", "", []string{"user@example.com"}, ae, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue session token: %v", err)
+	}
+	return tkn
+}
+
+// siteToken returns a token scoped to one site, like the ones issued by
+// /sso/token.
+func (env *testEnv) siteToken(t *testing.T, site allowlist.Site) string {
+	tkn, _, err := env.issuer.IssueSiteToken("user123", "azure", "", []string{"user@example.com"}, nil, site, "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue site token: %v", err)
+	}
+	return tkn
+}
+
+// apiKey returns a token like the ones issued by /login/apikey, which never
+// expire unless the allowlist entity's NotAfter caps them.
+func (env *testEnv) apiKey(t *testing.T, ae *allowlist.Entity) string {
+	exp := time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if !ae.NotAfter.IsZero() {
+		exp = ae.NotAfter
+	}
+	tkn, _, err := env.issuer.IssueToken(usersrv.TokenUseAPIKey, "user123", "azure", "", nil, ae, exp)
+	if err != nil {
+		t.Fatalf("failed to issue API key: %v", err)
+	}
+	return tkn
+}
+
+func (env *testEnv) authorize(t *testing.T, clientID, redirectURI, session string) *httptest.ResponseRecorder {
+	q := url.Values{"client_id": {clientID}, "redirect_uri": {redirectURI}, "state": {"test-state"}}
+	req := httptest.NewRequest(http.MethodGet, "/sso/authorize?"+q.Encode(), nil)
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "jwt", Value: session})
+	}
+	w := httptest.NewRecorder()
+	env.srv.Authorize(w, req)
+	return w
+}
+
+func (env *testEnv) token(t *testing.T, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/sso/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.srv.Token(w, req)
+	return w
+}
+
+func redirectParams(t *testing.T, w *httptest.ResponseRecorder, wantURI string) url.Values {
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse redirect: %v", err)
+	}
+	if got := loc.Scheme + "://" + loc.Host + loc.Path; got != wantURI {
+		t.Fatalf("redirected to %q, want %q", got, wantURI)
+	}
+	return loc.Query()
+}
+
+func mustGet(v any, _ bool) any {
+	return v
+}
@@ -7,15 +7,51 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/clients"
 	"github.com/RMI/credential-service/httpreq"
 	"github.com/RMI/credential-service/openapi/testcreds"
+	"github.com/RMI/credential-service/sitesclaim"
+	"github.com/RMI/credential-service/verify"
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
+// DefaultMaxBatchSize is the most tokens checked in one batch, if
+// Server.MaxBatchSize isn't set.
+const DefaultMaxBatchSize = 100
+
 type Server struct {
 	Now     func() time.Time
 	JWTAuth *jwtauth.JWTAuth
+	// Revocation, if set, is used to check if tokens were revoked.
+	Revocation verify.RevocationChecker
+	// MaxBatchSize is the most tokens that can be checked in one batch. If
+	// zero, DefaultMaxBatchSize is used.
+	MaxBatchSize int
+	// Clients, if set, restricts checking tokens to registered clients, which
+	// authenticate like they do at /sso/token, see
+	// clients.Registry.AuthenticateRequest. For /credentials:check, where the
+	// Authorization header holds the token being checked, that means with
+	// 'client_id' and 'client_secret' form parameters.
+	Clients *clients.Registry
+}
+
+// errUnauthenticated is returned by authenticateClient when the caller isn't
+// a registered client.
+var errUnauthenticated = errors.New("client authentication is required to check credentials")
+
+// authenticateClient authenticates the caller as a registered client, if
+// Clients is set.
+func (s *Server) authenticateClient(r *http.Request) error {
+	if s.Clients == nil {
+		return nil
+	}
+	if _, err := s.Clients.AuthenticateRequest(r); err != nil {
+		return errUnauthenticated
+	}
+	return nil
 }
 
 func (s *Server) CheckCredentials(ctx context.Context, req testcreds.CheckCredentialsRequestObject) (testcreds.CheckCredentialsResponseObject, error) {
@@ -26,72 +62,211 @@ func (s *Server) CheckCredentials(ctx context.Context, req testcreds.CheckCreden
 			Body:       testcreds.Error{Message: http.StatusText(http.StatusInternalServerError)},
 		}, nil
 	}
+	if err := s.authenticateClient(r); err != nil {
+		return testcreds.CheckCredentialsdefaultJSONResponse{
+			StatusCode: http.StatusUnauthorized,
+			Body:       testcreds.Error{Message: err.Error()},
+		}, nil
+	}
+
+	site, err := parseSite(req.Params.Site)
+	if err != nil {
+		return testcreds.CheckCredentialsdefaultJSONResponse{
+			StatusCode: http.StatusBadRequest,
+			Body:       testcreds.Error{Message: err.Error()},
+		}, nil
+	}
+	var aud string
+	if req.Params.Audience != nil {
+		aud = *req.Params.Audience
+	}
 
 	tknStr, ok := getTokenString(r)
 	if !ok {
-		return testcreds.CheckCredentials200JSONResponse{
-			FailureReason: ptr("no token found in the 'Authorization' header or 'jwt' cookie"),
-			Valid:         false,
-		}, nil
+		resp := failure(&testcreds.CredentialCheck{}, testcreds.NoToken, "no token found in the 'Authorization' header or 'jwt' cookie")
+		return testcreds.CheckCredentials200JSONResponse(*resp), nil
 	}
 
-	tkn, err := s.JWTAuth.Decode(tknStr)
+	resp, err := s.check(ctx, tknStr, site, aud)
 	if err != nil {
-		return testcreds.CheckCredentials200JSONResponse{
-			FailureReason: ptr(fmt.Sprintf("failed to decode token: %v", err)),
-			Valid:         false,
-		}, nil
+		return nil, err
 	}
+	return testcreds.CheckCredentials200JSONResponse(*resp), nil
+}
 
-	if tkn == nil {
-		return testcreds.CheckCredentialsdefaultJSONResponse{
+func (s *Server) BatchCheckCredentials(ctx context.Context, req testcreds.BatchCheckCredentialsRequestObject) (testcreds.BatchCheckCredentialsResponseObject, error) {
+	r, ok := httpreq.FromContext(ctx)
+	if !ok {
+		return testcreds.BatchCheckCredentialsdefaultJSONResponse{
 			StatusCode: http.StatusInternalServerError,
 			Body:       testcreds.Error{Message: http.StatusText(http.StatusInternalServerError)},
 		}, nil
 	}
+	if err := s.authenticateClient(r); err != nil {
+		return testcreds.BatchCheckCredentialsdefaultJSONResponse{
+			StatusCode: http.StatusUnauthorized,
+			Body:       testcreds.Error{Message: err.Error()},
+		}, nil
+	}
+
+	if req.Body == nil {
+		return testcreds.BatchCheckCredentialsdefaultJSONResponse{
+			StatusCode: http.StatusBadRequest,
+			Body:       testcreds.Error{Message: "no request body given"},
+		}, nil
+	}
+
+	maxSize := s.MaxBatchSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxBatchSize
+	}
+	if len(req.Body.Tokens) > maxSize {
+		return testcreds.BatchCheckCredentialsdefaultJSONResponse{
+			StatusCode: http.StatusBadRequest,
+			Body:       testcreds.Error{Message: fmt.Sprintf("%d tokens given, at most %d can be checked at once", len(req.Body.Tokens), maxSize)},
+		}, nil
+	}
+
+	site, err := parseSite(req.Body.Site)
+	if err != nil {
+		return testcreds.BatchCheckCredentialsdefaultJSONResponse{
+			StatusCode: http.StatusBadRequest,
+			Body:       testcreds.Error{Message: err.Error()},
+		}, nil
+	}
+	var aud string
+	if req.Body.Audience != nil {
+		aud = *req.Body.Audience
+	}
+
+	results := []testcreds.CredentialCheck{}
+	for i, tknStr := range req.Body.Tokens {
+		if tknStr == "" {
+			results = append(results, *failure(&testcreds.CredentialCheck{}, testcreds.NoToken, "token was empty"))
+			continue
+		}
+		resp, err := s.check(ctx, tknStr, site, aud)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token %d: %w", i, err)
+		}
+		results = append(results, *resp)
+	}
+	return testcreds.BatchCheckCredentials200JSONResponse{Results: results}, nil
+}
+
+func parseSite(site *string) (allowlist.Site, error) {
+	if site == nil {
+		return "", nil
+	}
+	s, err := allowlist.ParseSite(*site)
+	if err != nil {
+		return "", fmt.Errorf("invalid site %q", *site)
+	}
+	return s, nil
+}
+
+// check validates the token, and if site or aud are non-empty, that the token
+// grants access to them. It only returns an error if the check itself failed.
+func (s *Server) check(ctx context.Context, tknStr string, site allowlist.Site, aud string) (*testcreds.CredentialCheck, error) {
+	msg, err := jws.Parse([]byte(tknStr))
+	if err != nil {
+		return failure(&testcreds.CredentialCheck{}, testcreds.MalformedToken, fmt.Sprintf("failed to parse token: %v", err)), nil
+	}
+	resp := &testcreds.CredentialCheck{}
+	if kid := msg.Signatures()[0].ProtectedHeaders().KeyID(); kid != "" {
+		resp.KeyID = ptr(kid)
+	}
+
+	tkn, err := s.JWTAuth.Decode(tknStr)
+	if err != nil {
+		return failure(resp, testcreds.InvalidSignature, fmt.Sprintf("failed to decode token: %v", err)), nil
+	}
+
+	if tkn == nil {
+		return nil, errors.New("decoded token was nil")
+	}
+
+	// The token was signed by us, so from here on we return its details even if
+	// it's invalid, to help debug why.
+	claims, err := tkn.AsMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token claims: %w", err)
+	}
+	resp.Claims = &claims
+	if exp := tkn.Expiration(); !exp.IsZero() {
+		resp.ExpiresAt = ptr(exp)
+	}
 
 	if _, ok := tkn.Get("local_auth"); ok {
 		// If you get this error, it's because you're using a 'source' JWT, which is a
 		// stand-in for an auth system (e.g. Azure AD, Auth0, etc) issued ID token.
-		return testcreds.CheckCredentials200JSONResponse{
-			FailureReason: ptr("'source' auth token used as end-user API token"),
-			Valid:         false,
-		}, nil
+		return failure(resp, testcreds.SourceToken, "'source' auth token used as end-user API token"), nil
+	}
+
+	// Either form of the 'sites' claim is accepted, see the sitesclaim package.
+	var sites *sitesclaim.Claim
+	if v, ok := tkn.Get(sitesclaim.Name); ok {
+		if sites, err = sitesclaim.Parse(v); err != nil {
+			return failure(resp, testcreds.InvalidClaims, fmt.Sprintf("token had malformed 'sites' claim: %v", err)), nil
+		}
+		resp.AllSites = ptr(sites.All)
+		if !sites.All {
+			allowed := []string{}
+			for _, s := range sites.List() {
+				allowed = append(allowed, string(s))
+			}
+			resp.AllowedSites = &allowed
+		}
 	}
 
-	if err := jwt.Validate(tkn); err != nil {
-		return responseForValidationError(err), nil
+	if err := jwt.Validate(tkn, jwt.WithClock(jwt.ClockFunc(s.Now))); err != nil {
+		code, reason := reasonForValidationError(err)
+		return failure(resp, code, reason), nil
+	}
+
+	if aud != "" && !contains(tkn.Audience(), aud) {
+		return failure(resp, testcreds.WrongAudience, fmt.Sprintf("token was issued for %q, not %q", tkn.Audience(), aud)), nil
+	}
+
+	if site != "" && (sites == nil || !sites.Allows(site)) {
+		return failure(resp, testcreds.SiteNotAllowed, fmt.Sprintf("token doesn't grant access to site %q", site)), nil
+	}
+
+	if s.Revocation != nil {
+		revoked, err := s.Revocation.IsRevoked(ctx, tkn.JwtID())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check revocation: %w", err)
+		}
+		resp.Revoked = ptr(revoked)
+		if revoked {
+			return failure(resp, testcreds.Revoked, "token was revoked"), nil
+		}
 	}
 
-	return testcreds.CheckCredentials200JSONResponse{
-		Valid:   true,
-		UserID:  ptr(tkn.Subject()),
-		TokenID: ptr(tkn.JwtID()),
-	}, nil
+	resp.Valid = true
+	resp.UserID = ptr(tkn.Subject())
+	resp.TokenID = ptr(tkn.JwtID())
+	return resp, nil
 }
 
-func responseForValidationError(err error) testcreds.CheckCredentialsResponseObject {
+// failure marks the response as invalid, for the given reason.
+func failure(resp *testcreds.CredentialCheck, code testcreds.FailureCode, reason string) *testcreds.CredentialCheck {
+	resp.Valid = false
+	resp.FailureCode = ptr(code)
+	resp.FailureReason = ptr(reason)
+	return resp
+}
+
+func reasonForValidationError(err error) (testcreds.FailureCode, string) {
 	switch {
 	case errors.Is(err, jwt.ErrInvalidIssuedAt()):
-		return testcreds.CheckCredentials200JSONResponse{
-			FailureReason: ptr("token had invalid 'iat' (issued at) claim"),
-			Valid:         false,
-		}
+		return testcreds.InvalidIssuedAt, "token had invalid 'iat' (issued at) claim"
 	case errors.Is(err, jwt.ErrTokenExpired()):
-		return testcreds.CheckCredentials200JSONResponse{
-			FailureReason: ptr("token was expired"),
-			Valid:         false,
-		}
+		return testcreds.Expired, "token was expired"
 	case errors.Is(err, jwt.ErrTokenNotYetValid()):
-		return testcreds.CheckCredentials200JSONResponse{
-			FailureReason: ptr("token was not yet valid"),
-			Valid:         false,
-		}
+		return testcreds.NotYetValid, "token was not yet valid"
 	default:
-		return testcreds.CheckCredentials200JSONResponse{
-			FailureReason: ptr(fmt.Sprintf("failed to validate JWT: %v", err)),
-			Valid:         false,
-		}
+		return testcreds.InvalidClaims, fmt.Sprintf("failed to validate JWT: %v", err)
 	}
 }
 
@@ -107,6 +282,15 @@ func getTokenString(r *http.Request) (string, bool) {
 	return "", false
 }
 
+func contains(list []string, want string) bool {
+	for _, v := range list {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
 func ptr[T any](in T) *T {
 	return &in
 }
@@ -0,0 +1,518 @@
+package testcredsrv
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/clients"
+	"github.com/RMI/credential-service/httpreq"
+	"github.com/RMI/credential-service/openapi/testcreds"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+func TestCheckCredentials(t *testing.T) {
+	env := setup(t)
+	exp := env.now.Add(time.Hour)
+
+	legacy := env.token(t, map[string]any{"sub": "user1", "jti": "tkn1", "aud": "rmi.org", "sites": "PACTA"})
+	structured := env.token(t, map[string]any{
+		"sub":   "user2",
+		"jti":   "tkn2",
+		"aud":   "opgee.rmi.org",
+		"sites": map[string]any{"v": 1, "sites": map[string]any{"OPGEE": map[string]any{}, "PACTA": map[string]any{}}},
+	})
+	all := env.token(t, map[string]any{"sub": "user3", "jti": "tkn3", "aud": "rmi.org", "sites": "all"})
+	revoked := env.token(t, map[string]any{"sub": "user4", "jti": "revoked-tkn", "aud": "rmi.org", "sites": "all"})
+	expired := env.token(t, map[string]any{"sub": "user5", "jti": "tkn5", "exp": env.now.Add(-time.Minute), "sites": "PACTA"})
+	source := env.token(t, map[string]any{"sub": "user6", "local_auth": true})
+	malformedSites := env.token(t, map[string]any{"sub": "user7", "sites": map[string]any{"v": 2}})
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	otherEnv := &testEnv{now: env.now, key: otherKey}
+	wrongKey := otherEnv.token(t, map[string]any{"sub": "user1"})
+
+	tests := []struct {
+		desc     string
+		token    string
+		site     string
+		audience string
+		want     testcreds.CredentialCheck
+	}{
+		{
+			desc: "no token",
+			want: testcreds.CredentialCheck{FailureCode: ptr(testcreds.NoToken)},
+		},
+		{
+			desc:  "malformed",
+			token: "not-a-token",
+			want:  testcreds.CredentialCheck{FailureCode: ptr(testcreds.MalformedToken)},
+		},
+		{
+			desc:  "wrong key",
+			token: wrongKey,
+			want:  testcreds.CredentialCheck{FailureCode: ptr(testcreds.InvalidSignature), KeyID: ptr("test-key-id")},
+		},
+		{
+			desc:  "source token",
+			token: source,
+			want:  testcreds.CredentialCheck{FailureCode: ptr(testcreds.SourceToken), KeyID: ptr("test-key-id"), ExpiresAt: &exp},
+		},
+		{
+			desc:  "malformed sites claim",
+			token: malformedSites,
+			want:  testcreds.CredentialCheck{FailureCode: ptr(testcreds.InvalidClaims), KeyID: ptr("test-key-id"), ExpiresAt: &exp},
+		},
+		{
+			desc:  "expired",
+			token: expired,
+			want: testcreds.CredentialCheck{
+				FailureCode:  ptr(testcreds.Expired),
+				KeyID:        ptr("test-key-id"),
+				ExpiresAt:    ptr(env.now.Add(-time.Minute)),
+				AllSites:     ptr(false),
+				AllowedSites: &[]string{"PACTA"},
+			},
+		},
+		{
+			desc:  "valid",
+			token: legacy,
+			want: testcreds.CredentialCheck{
+				Valid:        true,
+				UserID:       ptr("user1"),
+				TokenID:      ptr("tkn1"),
+				KeyID:        ptr("test-key-id"),
+				ExpiresAt:    &exp,
+				AllSites:     ptr(false),
+				AllowedSites: &[]string{"PACTA"},
+				Revoked:      ptr(false),
+			},
+		},
+		{
+			desc:     "site and audience",
+			token:    structured,
+			site:     "OPGEE",
+			audience: "opgee.rmi.org",
+			want: testcreds.CredentialCheck{
+				Valid:        true,
+				UserID:       ptr("user2"),
+				TokenID:      ptr("tkn2"),
+				KeyID:        ptr("test-key-id"),
+				ExpiresAt:    &exp,
+				AllSites:     ptr(false),
+				AllowedSites: &[]string{"OPGEE", "PACTA"},
+				Revoked:      ptr(false),
+			},
+		},
+		{
+			desc:  "all sites",
+			token: all,
+			site:  "OPGEE",
+			want: testcreds.CredentialCheck{
+				Valid:     true,
+				UserID:    ptr("user3"),
+				TokenID:   ptr("tkn3"),
+				KeyID:     ptr("test-key-id"),
+				ExpiresAt: &exp,
+				AllSites:  ptr(true),
+				Revoked:   ptr(false),
+			},
+		},
+		{
+			desc:  "site not allowed",
+			token: legacy,
+			site:  "OPGEE",
+			want: testcreds.CredentialCheck{
+				FailureCode:  ptr(testcreds.SiteNotAllowed),
+				KeyID:        ptr("test-key-id"),
+				ExpiresAt:    &exp,
+				AllSites:     ptr(false),
+				AllowedSites: &[]string{"PACTA"},
+			},
+		},
+		{
+			desc:     "wrong audience",
+			token:    legacy,
+			audience: "pacta.rmi.org",
+			want: testcreds.CredentialCheck{
+				FailureCode:  ptr(testcreds.WrongAudience),
+				KeyID:        ptr("test-key-id"),
+				ExpiresAt:    &exp,
+				AllSites:     ptr(false),
+				AllowedSites: &[]string{"PACTA"},
+			},
+		},
+		{
+			desc:  "revoked",
+			token: revoked,
+			want: testcreds.CredentialCheck{
+				FailureCode: ptr(testcreds.Revoked),
+				KeyID:       ptr("test-key-id"),
+				ExpiresAt:   &exp,
+				AllSites:    ptr(true),
+				Revoked:     ptr(true),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/credentials:check", nil)
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			var params testcreds.CheckCredentialsParams
+			if test.site != "" {
+				params.Site = &test.site
+			}
+			if test.audience != "" {
+				params.Audience = &test.audience
+			}
+
+			resp, err := env.srv.CheckCredentials(requestContext(r), testcreds.CheckCredentialsRequestObject{Params: params})
+			if err != nil {
+				t.Fatalf("CheckCredentials: %v", err)
+			}
+			got, ok := resp.(testcreds.CheckCredentials200JSONResponse)
+			if !ok {
+				t.Fatalf("CheckCredentials returned %T, want a 200 response", resp)
+			}
+			if !got.Valid && got.FailureReason == nil {
+				t.Error("invalid token had no failure reason")
+			}
+			opts := []cmp.Option{
+				cmpopts.IgnoreFields(testcreds.CredentialCheck{}, "FailureReason", "Claims"),
+			}
+			if diff := cmp.Diff(test.want, testcreds.CredentialCheck(got), opts...); diff != "" {
+				t.Errorf("unexpected check response (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckCredentials_Claims(t *testing.T) {
+	env := setup(t)
+	tkn := env.token(t, map[string]any{"sub": "user1", "sites": "PACTA", "emails": []string{"user1@example.com"}})
+
+	r := httptest.NewRequest(http.MethodPost, "/credentials:check", nil)
+	r.AddCookie(&http.Cookie{Name: "jwt", Value: tkn})
+	resp, err := env.srv.CheckCredentials(requestContext(r), testcreds.CheckCredentialsRequestObject{})
+	if err != nil {
+		t.Fatalf("CheckCredentials: %v", err)
+	}
+	got := resp.(testcreds.CheckCredentials200JSONResponse).Claims
+	want := &map[string]any{
+		"sub":    "user1",
+		"sites":  "PACTA",
+		"emails": []any{"user1@example.com"},
+		"exp":    env.now.Add(time.Hour),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected claims (-want +got)\n%s", diff)
+	}
+}
+
+func TestCheckCredentials_InvalidSite(t *testing.T) {
+	env := setup(t)
+	r := httptest.NewRequest(http.MethodPost, "/credentials:check", nil)
+	resp, err := env.srv.CheckCredentials(requestContext(r), testcreds.CheckCredentialsRequestObject{
+		Params: testcreds.CheckCredentialsParams{Site: ptr("NOTASITE")},
+	})
+	if err != nil {
+		t.Fatalf("CheckCredentials: %v", err)
+	}
+	got, ok := resp.(testcreds.CheckCredentialsdefaultJSONResponse)
+	if !ok || got.StatusCode != http.StatusBadRequest {
+		t.Errorf("CheckCredentials returned %+v, want a 400 response", resp)
+	}
+}
+
+func TestCheckCredentials_RevocationError(t *testing.T) {
+	env := setup(t)
+	env.srv.Revocation = fakeRevocation{err: errors.New("database is down")}
+	tkn := env.token(t, map[string]any{"sub": "user1", "jti": "tkn1"})
+
+	r := httptest.NewRequest(http.MethodPost, "/credentials:check", nil)
+	r.Header.Set("Authorization", "Bearer "+tkn)
+	if _, err := env.srv.CheckCredentials(requestContext(r), testcreds.CheckCredentialsRequestObject{}); err == nil {
+		t.Error("CheckCredentials returned no error, want one when revocation can't be checked")
+	}
+}
+
+func TestBatchCheckCredentials(t *testing.T) {
+	env := setup(t)
+	pacta := env.token(t, map[string]any{"sub": "user1", "jti": "tkn1", "sites": "PACTA"})
+	opgee := env.token(t, map[string]any{"sub": "user2", "jti": "tkn2", "sites": "OPGEE"})
+	expired := env.token(t, map[string]any{"sub": "user3", "exp": env.now.Add(-time.Minute), "sites": "PACTA"})
+	revoked := env.token(t, map[string]any{"sub": "user4", "jti": "revoked-tkn", "sites": "PACTA"})
+
+	resp, err := env.srv.BatchCheckCredentials(batchRequestContext(), testcreds.BatchCheckCredentialsRequestObject{
+		Body: &testcreds.BatchCredentialCheckRequest{
+			Tokens: []string{pacta, opgee, expired, revoked, "", "not-a-token"},
+			Site:   ptr("PACTA"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("BatchCheckCredentials: %v", err)
+	}
+	got, ok := resp.(testcreds.BatchCheckCredentials200JSONResponse)
+	if !ok {
+		t.Fatalf("BatchCheckCredentials returned %T, want a 200 response", resp)
+	}
+
+	type result struct {
+		Valid       bool
+		UserID      string
+		FailureCode testcreds.FailureCode
+	}
+	var gotResults []result
+	for _, r := range got.Results {
+		var res result
+		res.Valid = r.Valid
+		if r.UserID != nil {
+			res.UserID = *r.UserID
+		}
+		if r.FailureCode != nil {
+			res.FailureCode = *r.FailureCode
+		}
+		gotResults = append(gotResults, res)
+	}
+	want := []result{
+		{Valid: true, UserID: "user1"},
+		{FailureCode: testcreds.SiteNotAllowed},
+		{FailureCode: testcreds.Expired},
+		{FailureCode: testcreds.Revoked},
+		{FailureCode: testcreds.NoToken},
+		{FailureCode: testcreds.MalformedToken},
+	}
+	if diff := cmp.Diff(want, gotResults); diff != "" {
+		t.Errorf("unexpected results (-want +got)\n%s", diff)
+	}
+}
+
+func TestBatchCheckCredentials_BadRequest(t *testing.T) {
+	env := setup(t)
+	env.srv.MaxBatchSize = 2
+	tkn := env.token(t, map[string]any{"sub": "user1"})
+
+	tests := []struct {
+		desc string
+		body *testcreds.BatchCredentialCheckRequest
+	}{
+		{desc: "no body"},
+		{desc: "too many tokens", body: &testcreds.BatchCredentialCheckRequest{Tokens: []string{tkn, tkn, tkn}}},
+		{desc: "invalid site", body: &testcreds.BatchCredentialCheckRequest{Tokens: []string{tkn}, Site: ptr("NOTASITE")}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			resp, err := env.srv.BatchCheckCredentials(batchRequestContext(), testcreds.BatchCheckCredentialsRequestObject{Body: test.body})
+			if err != nil {
+				t.Fatalf("BatchCheckCredentials: %v", err)
+			}
+			got, ok := resp.(testcreds.BatchCheckCredentialsdefaultJSONResponse)
+			if !ok || got.StatusCode != http.StatusBadRequest {
+				t.Errorf("BatchCheckCredentials returned %+v, want a 400 response", resp)
+			}
+		})
+	}
+}
+
+func TestClientAuthentication(t *testing.T) {
+	env := setup(t)
+	reg, err := clients.NewRegistry(&clients.Config{
+		Format: "v1",
+		Clients: []*clients.Client{
+			{ID: "pacta", SecretHash: clients.HashSecret("pacta-secret"), Site: allowlist.SitePACTA, RedirectURIs: []string{"https://pacta.example.com/auth/callback"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client registry: %v", err)
+	}
+	env.srv.Clients = reg
+	tkn := env.token(t, map[string]any{"sub": "user1", "jti": "tkn1"})
+
+	checkStatus := func(t *testing.T, form url.Values) int {
+		var body io.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		r := httptest.NewRequest(http.MethodPost, "/credentials:check", body)
+		if form != nil {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		r.Header.Set("Authorization", "Bearer "+tkn)
+		resp, err := env.srv.CheckCredentials(requestContext(r), testcreds.CheckCredentialsRequestObject{})
+		if err != nil {
+			t.Fatalf("CheckCredentials: %v", err)
+		}
+		switch resp := resp.(type) {
+		case testcreds.CheckCredentials200JSONResponse:
+			return http.StatusOK
+		case testcreds.CheckCredentialsdefaultJSONResponse:
+			return resp.StatusCode
+		default:
+			t.Fatalf("unexpected response type %T", resp)
+			return 0
+		}
+	}
+	batchStatus := func(t *testing.T, id, secret string) int {
+		r := httptest.NewRequest(http.MethodPost, "/credentials:batchCheck", nil)
+		if id != "" {
+			r.SetBasicAuth(id, secret)
+		}
+		resp, err := env.srv.BatchCheckCredentials(requestContext(r), testcreds.BatchCheckCredentialsRequestObject{
+			Body: &testcreds.BatchCredentialCheckRequest{Tokens: []string{tkn}},
+		})
+		if err != nil {
+			t.Fatalf("BatchCheckCredentials: %v", err)
+		}
+		switch resp := resp.(type) {
+		case testcreds.BatchCheckCredentials200JSONResponse:
+			return http.StatusOK
+		case testcreds.BatchCheckCredentialsdefaultJSONResponse:
+			return resp.StatusCode
+		default:
+			t.Fatalf("unexpected response type %T", resp)
+			return 0
+		}
+	}
+
+	tests := []struct {
+		desc       string
+		status     func(t *testing.T) int
+		wantStatus int
+	}{
+		{
+			desc:       "check without client credentials",
+			status:     func(t *testing.T) int { return checkStatus(t, nil) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc: "check with wrong secret",
+			status: func(t *testing.T) int {
+				return checkStatus(t, url.Values{"client_id": {"pacta"}, "client_secret": {"wrong"}})
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc: "check with client credentials",
+			status: func(t *testing.T) int {
+				return checkStatus(t, url.Values{"client_id": {"pacta"}, "client_secret": {"pacta-secret"}})
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "batch check without client credentials",
+			status:     func(t *testing.T) int { return batchStatus(t, "", "") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "batch check with wrong secret",
+			status:     func(t *testing.T) int { return batchStatus(t, "pacta", "wrong") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "batch check with client credentials",
+			status:     func(t *testing.T) int { return batchStatus(t, "pacta", "pacta-secret") },
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := test.status(t); got != test.wantStatus {
+				t.Errorf("got status %d, want %d", got, test.wantStatus)
+			}
+		})
+	}
+}
+
+type testEnv struct {
+	srv *Server
+	now time.Time
+	key ed25519.PrivateKey
+}
+
+func setup(t *testing.T) *testEnv {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	now := time.Unix(123456789, 0).UTC()
+	return &testEnv{
+		srv: &Server{
+			Now:        func() time.Time { return now },
+			JWTAuth:    jwtauth.New("EdDSA", nil, pub),
+			Revocation: fakeRevocation{revoked: map[string]bool{"revoked-tkn": true}},
+		},
+		now: now,
+		key: priv,
+	}
+}
+
+// token returns a token signed by the environment's key, with the given claims
+// and, unless otherwise set, an expiry an hour from now.
+func (env *testEnv) token(t *testing.T, claims map[string]any) string {
+	key, err := jwk.FromRaw(env.key)
+	if err != nil {
+		t.Fatalf("failed to make JWK: %v", err)
+	}
+	key.Set(jwk.KeyIDKey, "test-key-id")
+
+	tkn := jwt.New()
+	tkn.Set(jwt.ExpirationKey, env.now.Add(time.Hour))
+	for k, v := range claims {
+		if err := tkn.Set(k, v); err != nil {
+			t.Fatalf("failed to set claim %q: %v", k, err)
+		}
+	}
+	signed, err := jwt.Sign(tkn, jwt.WithKey(jwa.EdDSA, key))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return string(signed)
+}
+
+// batchRequestContext returns the context of a /credentials:batchCheck
+// request, see requestContext.
+func batchRequestContext() context.Context {
+	return requestContext(httptest.NewRequest(http.MethodPost, "/credentials:batchCheck", nil))
+}
+
+// requestContext returns the request's context as the OpenAPI handlers see it,
+// with the request added by httpreq.Middleware.
+func requestContext(r *http.Request) context.Context {
+	var ctx context.Context
+	httpreq.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	return ctx
+}
+
+type fakeRevocation struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (f fakeRevocation) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.revoked[tokenID], nil
+}
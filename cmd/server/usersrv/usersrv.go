@@ -5,7 +5,6 @@
 package usersrv
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -13,8 +12,10 @@ import (
 	"time"
 
 	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/clients"
 	"github.com/RMI/credential-service/tokenctx"
 	"github.com/RMI/credential-service/openapi/user"
+	"github.com/RMI/credential-service/sitesclaim"
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/google/uuid"
 	"github.com/lestrrat-go/jwx/v2/jwa"
@@ -23,29 +24,143 @@ import (
 	"go.uber.org/zap"
 )
 
+// DefaultAudience is the 'aud' claim of tokens that aren't restricted to a
+// single site.
+const DefaultAudience = "rmi.org"
+
+// TokenUseClaim is the claim that says what an issued token is for, one of
+// the TokenUse values. Services shouldn't guess from other claims (like the
+// expiry) whether a token is e.g. a session, since allowlist entries can cap
+// the lifetime of any token.
+const TokenUseClaim = "token_use"
+
+// TokenUse is the kind of token that was issued, see TokenUseClaim.
+type TokenUse string
+
+const (
+	// TokenUseSession is for the 'jwt' cookie from /login/cookie, which
+	// expires with the source token it was exchanged for.
+	TokenUseSession TokenUse = "session"
+	// TokenUseAPIKey is for API keys from /login/apikey.
+	TokenUseAPIKey TokenUse = "api_key"
+	// TokenUseSite is for tokens scoped to one site, see IssueSiteToken.
+	TokenUseSite TokenUse = "site"
+)
+
+// ErrNoAudience is returned by IssueSiteToken when no audience was requested,
+// and none is configured for the site.
+var ErrNoAudience = errors.New("no audience is configured for site")
+
+// ErrDefaultAudience is returned by IssueSiteToken when the site's audience is
+// DefaultAudience, which would make the token valid everywhere the user's
+// session is.
+var ErrDefaultAudience = errors.New("site tokens can't have the default audience")
+
 type TokenIssuer struct {
 	Key jwk.Key
 	Now func() time.Time
+	// SiteAudiences maps sites to the 'aud' claim of tokens issued for just
+	// that site, see IssueSiteToken.
+	SiteAudiences map[allowlist.Site]string
+	// IssuerURL, if set, is the 'iss' claim of issued tokens, e.g.
+	// https://credentials.rmi.org
+	IssuerURL string
+	// StructuredSites switches the 'sites' claim from the legacy
+	// comma-separated string to the structured form, see the sitesclaim
+	// package. It should only be enabled once every service that checks the
+	// claim accepts both forms.
+	StructuredSites bool
+}
+
+// PublicKeySet returns the public key that tokens are signed with, for
+// downstream services to verify them with, see the verify package.
+func (t *TokenIssuer) PublicKeySet() (jwk.Set, error) {
+	pub, err := jwk.PublicKeyOf(t.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key: %w", err)
+	}
+	if err := pub.Set(jwk.AlgorithmKey, jwa.EdDSA); err != nil {
+		return nil, fmt.Errorf("failed to set 'alg' on key: %w", err)
+	}
+	if err := pub.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, fmt.Errorf("failed to set 'use' on key: %w", err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(pub); err != nil {
+		return nil, fmt.Errorf("failed to add key to set: %w", err)
+	}
+	return set, nil
 }
 
-func (t *TokenIssuer) IssueToken(userID string, emails []string, ae *allowlist.Entity, exp time.Time) (string, string, error) {
+// IssueToken signs a token of the given kind for the given user. If idp is set, it's recorded in
+// the 'idp' claim as the identity provider that authenticated the user, and
+// likewise for idpPolicy in the 'idp_policy' claim, the provider's user flow
+// or custom policy. The entity's roles are recorded in the 'roles' claim.
+func (t *TokenIssuer) IssueToken(use TokenUse, userID, idp, idpPolicy string, emails []string, ae *allowlist.Entity, exp time.Time) (string, string, error) {
+	var (
+		sites *sitesclaim.Claim
+		roles []string
+	)
+	if ae != nil {
+		sites = sitesclaim.FromEntity(ae)
+		roles = ae.Roles
+	}
+	return t.issue(use, userID, idp, idpPolicy, emails, roles, sites, DefaultAudience, "", exp)
+}
+
+// IssueSiteToken is like IssueToken, but the token only grants access to the
+// given site, and its 'aud' claim is aud, or if that's empty, the site's
+// configured audience. Services for other sites (which check the audience)
+// won't accept the token, so a compromised service can't replay it elsewhere.
+// If scope is set, it's recorded in the 'scope' claim, as the space-delimited
+// OAuth scopes the token was issued with.
+func (t *TokenIssuer) IssueSiteToken(userID, idp, idpPolicy string, emails, roles []string, site allowlist.Site, aud, scope string, exp time.Time) (string, string, error) {
+	if aud == "" {
+		aud = t.SiteAudiences[site]
+	}
+	if aud == "" {
+		return "", "", ErrNoAudience
+	}
+	if aud == DefaultAudience {
+		return "", "", ErrDefaultAudience
+	}
+	return t.issue(TokenUseSite, userID, idp, idpPolicy, emails, roles, sitesclaim.ForSites(site), aud, scope, exp)
+}
+
+func (t *TokenIssuer) issue(use TokenUse, userID, idp, idpPolicy string, emails, roles []string, sites *sitesclaim.Claim, aud, scope string, exp time.Time) (string, string, error) {
 	now := t.Now()
 	id := uuid.NewString()
 	builder := jwt.NewBuilder().
 		Subject(userID).
-		Audience([]string{"rmi.org"}).
+		Audience([]string{aud}).
 		Expiration(exp).
 		IssuedAt(now).
 		NotBefore(now.Add(-time.Minute)).
-		JwtID(id)
+		JwtID(id).
+		Claim(TokenUseClaim, string(use))
+	if t.IssuerURL != "" {
+		builder = builder.Issuer(t.IssuerURL)
+	}
+	if idp != "" {
+		builder = builder.Claim("idp", idp)
+	}
+	if idpPolicy != "" {
+		builder = builder.Claim("idp_policy", idpPolicy)
+	}
 	if len(emails) > 0 {
 		builder = builder.Claim("emails", emails)
 	}
-	if ae != nil {
-		if ae.AllowAllSites {
-			builder = builder.Claim("sites", "all")
+	if len(roles) > 0 {
+		builder = builder.Claim("roles", roles)
+	}
+	if scope != "" {
+		builder = builder.Claim("scope", scope)
+	}
+	if sites != nil {
+		if t.StructuredSites {
+			builder = builder.Claim(sitesclaim.Name, sites)
 		} else {
-			builder = builder.Claim("sites", formatSites(ae.AllowedSites))
+			builder = builder.Claim(sitesclaim.Name, sites.Legacy())
 		}
 	}
 	tkn, err := builder.Build()
@@ -59,15 +174,17 @@ func (t *TokenIssuer) IssueToken(userID string, emails []string, ae *allowlist.E
 	return string(dat), id, nil
 }
 
-func formatSites(sites []allowlist.Site) string {
-	var buf bytes.Buffer
-	for i, s := range sites {
-		buf.WriteString(string(s))
-		if i < len(sites)-1 {
-			buf.WriteRune(',')
-		}
+// sourceFields returns log fields describing how the user authenticated, for
+// the audit trail of issued credentials.
+func sourceFields(ctx context.Context) []zap.Field {
+	var fields []zap.Field
+	if idp, ok := tokenctx.ProviderFromContext(ctx); ok {
+		fields = append(fields, zap.String("idp", idp))
 	}
-	return buf.String()
+	if policy, ok := tokenctx.PolicyFromContext(ctx); ok {
+		fields = append(fields, zap.String("idp_policy", policy))
+	}
+	return fields
 }
 
 type Server struct {
@@ -75,17 +192,20 @@ type Server struct {
 	Logger       *zap.Logger
 	Now          func() time.Time
 	CookieDomain string
+	// Clients, if set, overrides CookieDomain for logins from registered
+	// clients with their own cookie domain.
+	Clients *clients.Registry
 }
 
 // Exchange a user JWT token for an API key that can be used with other RMI APIs
 // (POST /login/apikey)
 func (s *Server) CreateAPIKey(ctx context.Context, req user.CreateAPIKeyRequestObject) (user.CreateAPIKeyResponseObject, error) {
-	tkn, id, exp, err := s.exchangeToken(ctx, neverExpire)
+	tkn, id, exp, err := s.exchangeToken(ctx, TokenUseAPIKey, neverExpire)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange token: %w", err)
 	}
 
-	s.Logger.Info("issuing API key", zap.String("id", id))
+	s.Logger.Info("issuing API key", append([]zap.Field{zap.String("id", id)}, sourceFields(ctx)...)...)
 	return user.CreateAPIKey200JSONResponse{
 		Id:        id,
 		Key:       tkn,
@@ -108,7 +228,7 @@ func neverExpire(o *exchangeTokenOptions) {
 	o.neverExpire = true
 }
 
-func (s *Server) exchangeToken(ctx context.Context, opts ...exchangeOption) (string, string, time.Time, error) {
+func (s *Server) exchangeToken(ctx context.Context, use TokenUse, opts ...exchangeOption) (string, string, time.Time, error) {
 	eOpts := &exchangeTokenOptions{
 		includeEmails: false,
 		neverExpire:   false,
@@ -151,6 +271,12 @@ func (s *Server) exchangeToken(ctx context.Context, opts ...exchangeOption) (str
 		exp = tmp
 	}
 
+	// Time-bounded allowlist entries cap the lifetime of the issued token,
+	// including API keys that would otherwise never expire.
+	if ae != nil && !ae.NotAfter.IsZero() && ae.NotAfter.Before(exp) {
+		exp = ae.NotAfter
+	}
+
 	sub, ok := srcClaims["sub"]
 	if !ok {
 		return "", "", time.Time{}, errors.New("no 'sub' claim in source JWT")
@@ -161,7 +287,13 @@ func (s *Server) exchangeToken(ctx context.Context, opts ...exchangeOption) (str
 		return "", "", time.Time{}, fmt.Errorf("'sub' claim in source JWT was of type %T, expected a string", sub)
 	}
 
-	tkn, id, err := s.Issuer.IssueToken(subStr, emailsClaim, ae, exp)
+	// The provider is recorded by the authn middleware, so this is only empty
+	// if the request bypassed it. The policy is only set for providers that
+	// have them.
+	idp, _ := tokenctx.ProviderFromContext(ctx)
+	idpPolicy, _ := tokenctx.PolicyFromContext(ctx)
+
+	tkn, id, err := s.Issuer.IssueToken(use, subStr, idp, idpPolicy, emailsClaim, ae, exp)
 	if err != nil {
 		return "", "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -172,13 +304,29 @@ func (s *Server) exchangeToken(ctx context.Context, opts ...exchangeOption) (str
 // Exchange a user JWT token for an auth cookie that can be used with other RMI APIs
 // (POST /login/cookie)
 func (s *Server) Login(ctx context.Context, req user.LoginRequestObject) (user.LoginResponseObject, error) {
-	tkn, id, exp, err := s.exchangeToken(ctx, includeEmails)
+	c, err := s.AuthCookie(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Login200Response{
+		Headers: user.Login200ResponseHeaders{
+			SetCookie: c.String(),
+		},
+	}, nil
+}
+
+// AuthCookie exchanges the source token in the context (see authn.Registry)
+// for an auth token, and returns the 'jwt' cookie containing it. It's used by
+// Login, and by server-side logins, see loginsrv.
+func (s *Server) AuthCookie(ctx context.Context) (*http.Cookie, error) {
+	tkn, id, exp, err := s.exchangeToken(ctx, TokenUseSession, includeEmails)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange token: %w", err)
 	}
-	s.Logger.Info("issuing auth token", zap.String("id", id))
+	s.Logger.Info("issuing auth token", append([]zap.Field{zap.String("id", id)}, sourceFields(ctx)...)...)
 
-	c := http.Cookie{
+	return &http.Cookie{
 		Name:     "jwt",
 		Value:    tkn,
 		Path:     "/",
@@ -186,13 +334,7 @@ func (s *Server) Login(ctx context.Context, req user.LoginRequestObject) (user.L
 		Secure:   true,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
-		Domain:   s.CookieDomain,
-	}
-
-	return user.Login200Response{
-		Headers: user.Login200ResponseHeaders{
-			SetCookie: c.String(),
-		},
+		Domain:   s.Clients.CookieDomain(ctx, s.CookieDomain),
 	}, nil
 }
 
@@ -207,7 +349,7 @@ func (s *Server) Logout(ctx context.Context, req user.LogoutRequestObject) (user
 		Secure:   true,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
-		Domain:   s.CookieDomain,
+		Domain:   s.Clients.CookieDomain(ctx, s.CookieDomain),
 	}
 
 	return user.Logout200Response{
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+)
+
+const allSites = "all sites"
+
+// entryKey identifies the email, domain, or claim value (and provider) an
+// entry applies to.
+func entryKey(ae *allowlist.AllowlistEntry) string {
+	switch {
+	case ae.Email != "":
+		return "email " + strings.ToLower(ae.Email)
+	case ae.Domain != "":
+		return "domain " + strings.ToLower(ae.Domain)
+	case ae.Provider != "":
+		return fmt.Sprintf("claim %s=%s from %s", ae.Claim, ae.Value, ae.Provider)
+	default:
+		return fmt.Sprintf("claim %s=%s", ae.Claim, ae.Value)
+	}
+}
+
+func entrySites(ae *allowlist.AllowlistEntry) map[string]bool {
+	out := make(map[string]bool)
+	if len(ae.Sites) == 0 {
+		out[allSites] = true
+		return out
+	}
+	for _, s := range ae.Sites {
+		out[s] = true
+	}
+	return out
+}
+
+// diffConfigs returns a human-readable, sorted list of changes in site access
+// between the two configs. Both configs are assumed to be valid.
+func diffConfigs(oldCfg, newCfg *allowlist.Config) []string {
+	oldEntries, newEntries := indexEntries(oldCfg), indexEntries(newCfg)
+
+	keys := make(map[string]bool)
+	for k := range oldEntries {
+		keys[k] = true
+	}
+	for k := range newEntries {
+		keys[k] = true
+	}
+	var sortedKeys []string
+	for k := range keys {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+
+	var out []string
+	for _, k := range sortedKeys {
+		oldAE, newAE := oldEntries[k], newEntries[k]
+		switch {
+		case oldAE == nil:
+			out = append(out, fmt.Sprintf("+ %s: gained %s", k, formatSiteSet(entrySites(newAE))))
+		case newAE == nil:
+			out = append(out, fmt.Sprintf("- %s: lost %s", k, formatSiteSet(entrySites(oldAE))))
+		default:
+			var changes []string
+			gained, lost := diffSites(entrySites(oldAE), entrySites(newAE))
+			if len(gained) > 0 {
+				changes = append(changes, "gained "+formatSiteSet(gained))
+			}
+			if len(lost) > 0 {
+				changes = append(changes, "lost "+formatSiteSet(lost))
+			}
+			if c := diffTime("notBefore", oldAE.NotBefore, newAE.NotBefore); c != "" {
+				changes = append(changes, c)
+			}
+			if c := diffTime("notAfter", oldAE.NotAfter, newAE.NotAfter); c != "" {
+				changes = append(changes, c)
+			}
+			if len(changes) > 0 {
+				out = append(out, fmt.Sprintf("~ %s: %s", k, strings.Join(changes, "; ")))
+			}
+		}
+	}
+	return out
+}
+
+func indexEntries(cfg *allowlist.Config) map[string]*allowlist.AllowlistEntry {
+	out := make(map[string]*allowlist.AllowlistEntry)
+	for _, ae := range cfg.Allowlist {
+		out[entryKey(ae)] = ae
+	}
+	return out
+}
+
+func diffSites(oldSites, newSites map[string]bool) (gained, lost map[string]bool) {
+	gained, lost = make(map[string]bool), make(map[string]bool)
+	for s := range newSites {
+		if !oldSites[s] {
+			gained[s] = true
+		}
+	}
+	for s := range oldSites {
+		if !newSites[s] {
+			lost[s] = true
+		}
+	}
+	return gained, lost
+}
+
+func formatSiteSet(sites map[string]bool) string {
+	var out []string
+	for s := range sites {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
+
+func diffTime(name string, oldT, newT *time.Time) string {
+	format := func(t *time.Time) string {
+		if t == nil {
+			return "unset"
+		}
+		return t.Format(time.RFC3339)
+	}
+	if format(oldT) == format(newT) {
+		return ""
+	}
+	return fmt.Sprintf("%s changed from %s to %s", name, format(oldT), format(newT))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RMI/credential-service/allowlist"
+)
+
+// allowlistDoc is the raw contents of an allowlist file, along with the
+// locations of each entry in the 'allowlist' array. This lets us add and remove
+// entries without reformatting the rest of the file, which keeps diffs in
+// review small.
+type allowlistDoc struct {
+	raw []byte
+	// arrStart is the offset just after the '[' of the 'allowlist' array, and
+	// arrEnd is the offset of the closing ']'.
+	arrStart, arrEnd int
+	entries          []span
+}
+
+// span is the [start, end) byte range of a value in the document.
+type span struct {
+	start, end int
+}
+
+func decodeConfig(raw []byte) (*allowlist.Config, error) {
+	var cfg allowlist.Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode allowlist config: %w", err)
+	}
+	return &cfg, nil
+}
+
+func parseDoc(raw []byte) (*allowlistDoc, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	doc := &allowlistDoc{raw: raw, arrStart: -1}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key: %w", err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected an object key, got %v", tok)
+		}
+		if key != "allowlist" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, fmt.Errorf("failed to read value for %q: %w", key, err)
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return nil, err
+		}
+		doc.arrStart = int(dec.InputOffset())
+		prevEnd := doc.arrStart
+		for dec.More() {
+			start := skipSeparators(raw, prevEnd)
+			var entry json.RawMessage
+			if err := dec.Decode(&entry); err != nil {
+				return nil, fmt.Errorf("failed to read allowlist entry %d: %w", len(doc.entries), err)
+			}
+			prevEnd = int(dec.InputOffset())
+			doc.entries = append(doc.entries, span{start: start, end: prevEnd})
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+		doc.arrEnd = int(dec.InputOffset()) - 1
+	}
+	if doc.arrStart < 0 {
+		return nil, errors.New("file had no 'allowlist' array")
+	}
+	return doc, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", want, err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+func skipSeparators(raw []byte, i int) int {
+	for i < len(raw) {
+		switch raw[i] {
+		case ' ', '\t', '\n', '\r', ',':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// remove returns the document with the entry at index i removed, along with
+// the separator preceding it (or following it, for the first entry).
+func (d *allowlistDoc) remove(i int) []byte {
+	var cutStart, cutEnd int
+	switch {
+	case len(d.entries) == 1:
+		cutStart, cutEnd = d.arrStart, d.arrEnd
+	case i == 0:
+		cutStart, cutEnd = d.entries[0].start, d.entries[1].start
+	default:
+		cutStart, cutEnd = d.entries[i-1].end, d.entries[i].end
+	}
+	return splice(d.raw, cutStart, cutEnd, nil)
+}
+
+// add returns the document with the entry appended to the end of the
+// allowlist, formatted to match the existing last entry.
+func (d *allowlistDoc) add(ae *allowlist.AllowlistEntry) ([]byte, error) {
+	if len(d.entries) == 0 {
+		rendered, err := renderSingleLine(ae)
+		if err != nil {
+			return nil, err
+		}
+		return splice(d.raw, d.arrStart, d.arrEnd, rendered), nil
+	}
+
+	last := d.entries[len(d.entries)-1]
+	lastRaw := d.raw[last.start:last.end]
+
+	var sep []byte
+	if len(d.entries) >= 2 {
+		sep = d.raw[d.entries[len(d.entries)-2].end:last.start]
+	} else if indent, ok := lineIndent(d.raw, last.start); ok {
+		sep = []byte(",\n" + indent)
+	} else {
+		sep = []byte(", ")
+	}
+
+	var (
+		rendered []byte
+		err      error
+	)
+	if bytes.ContainsRune(lastRaw, '\n') {
+		indent, _ := lineIndent(d.raw, last.start)
+		rendered, err = json.MarshalIndent(ae, indent, detectIndentUnit(lastRaw, indent))
+	} else {
+		rendered, err = renderSingleLine(ae)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render entry: %w", err)
+	}
+
+	return splice(d.raw, last.end, last.end, append(append([]byte{}, sep...), rendered...)), nil
+}
+
+// renderSingleLine renders the entry like {"domain": "example.com", "sites": ["OPGEE"]},
+// which is the style used in our checked-in allowlists.
+func renderSingleLine(ae *allowlist.AllowlistEntry) ([]byte, error) {
+	dat, err := json.MarshalIndent(ae, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entry: %w", err)
+	}
+	// JSON strings can't contain literal newlines, so this only touches the
+	// whitespace added by MarshalIndent.
+	dat = bytes.ReplaceAll(dat, []byte(",\n"), []byte(", "))
+	dat = bytes.ReplaceAll(dat, []byte("\n"), nil)
+	return dat, nil
+}
+
+// lineIndent returns the whitespace between the start of the line and offset
+// i, and false if there's anything other than whitespace there.
+func lineIndent(raw []byte, i int) (string, bool) {
+	lineStart := bytes.LastIndexByte(raw[:i], '\n') + 1
+	indent := string(raw[lineStart:i])
+	if strings.TrimLeft(indent, " \t") != "" {
+		return "", false
+	}
+	return indent, true
+}
+
+// detectIndentUnit returns the additional indentation used for the fields of
+// a multi-line entry, relative to the entry itself.
+func detectIndentUnit(entry []byte, baseIndent string) string {
+	lines := bytes.Split(entry, []byte("\n"))
+	if len(lines) < 2 {
+		return "\t"
+	}
+	line := string(lines[1])
+	fieldIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	unit := strings.TrimPrefix(fieldIndent, baseIndent)
+	if unit == "" {
+		return "\t"
+	}
+	return unit
+}
+
+func splice(raw []byte, start, end int, insert []byte) []byte {
+	out := make([]byte, 0, len(raw)-(end-start)+len(insert))
+	out = append(out, raw[:start]...)
+	out = append(out, insert...)
+	out = append(out, raw[end:]...)
+	return out
+}
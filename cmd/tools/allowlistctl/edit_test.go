@@ -0,0 +1,218 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/google/go-cmp/cmp"
+)
+
+const singleLineDoc = `{
+  "format": "v1",
+  "allowlist": [
+    {"domain": "siliconally.org"},
+    {"domain": "opgee-only.not-a-domain", "sites": ["OPGEE"]}
+  ]
+}
+`
+
+const multiLineDoc = `{
+	"format": "v1",
+	"allowlist": [
+		{
+			"domain": "rmi.org"
+		}
+	]
+}
+`
+
+func TestAdd(t *testing.T) {
+	notAfter := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		desc  string
+		doc   string
+		entry *allowlist.AllowlistEntry
+		want  string
+	}{
+		{
+			desc:  "single line entries",
+			doc:   singleLineDoc,
+			entry: &allowlist.AllowlistEntry{Email: "pilot@example.com", Sites: []string{"PACTA"}, NotAfter: &notAfter},
+			want: `{
+  "format": "v1",
+  "allowlist": [
+    {"domain": "siliconally.org"},
+    {"domain": "opgee-only.not-a-domain", "sites": ["OPGEE"]},
+    {"email": "pilot@example.com", "sites": ["PACTA"], "notAfter": "2024-01-01T00:00:00Z"}
+  ]
+}
+`,
+		},
+		{
+			desc:  "multi-line entries",
+			doc:   multiLineDoc,
+			entry: &allowlist.AllowlistEntry{Claim: "groups", Value: "abc", Sites: []string{"OPGEE"}},
+			want: `{
+	"format": "v1",
+	"allowlist": [
+		{
+			"domain": "rmi.org"
+		},
+		{
+			"claim": "groups",
+			"value": "abc",
+			"sites": [
+				"OPGEE"
+			]
+		}
+	]
+}
+`,
+		},
+		{
+			desc:  "empty allowlist",
+			doc:   `{"format": "v1", "allowlist": []}`,
+			entry: &allowlist.AllowlistEntry{Domain: "rmi.org"},
+			want:  `{"format": "v1", "allowlist": [{"domain": "rmi.org"}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			doc, err := parseDoc([]byte(test.doc))
+			if err != nil {
+				t.Fatalf("parseDoc: %v", err)
+			}
+			got, err := doc.add(test.entry)
+			if err != nil {
+				t.Fatalf("add: %v", err)
+			}
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("unexpected document (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		desc string
+		doc  string
+		idx  int
+		want string
+	}{
+		{
+			desc: "first entry",
+			doc:  singleLineDoc,
+			idx:  0,
+			want: `{
+  "format": "v1",
+  "allowlist": [
+    {"domain": "opgee-only.not-a-domain", "sites": ["OPGEE"]}
+  ]
+}
+`,
+		},
+		{
+			desc: "last entry",
+			doc:  singleLineDoc,
+			idx:  1,
+			want: `{
+  "format": "v1",
+  "allowlist": [
+    {"domain": "siliconally.org"}
+  ]
+}
+`,
+		},
+		{
+			desc: "only entry",
+			doc:  multiLineDoc,
+			idx:  0,
+			want: `{
+	"format": "v1",
+	"allowlist": []
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			doc, err := parseDoc([]byte(test.doc))
+			if err != nil {
+				t.Fatalf("parseDoc: %v", err)
+			}
+			got := doc.remove(test.idx)
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("unexpected document (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	oldCfg := &allowlist.Config{
+		Format: "v1",
+		Allowlist: []*allowlist.AllowlistEntry{
+			{Domain: "rmi.org"},
+			{Domain: "opgee-only.example.com", Sites: []string{"OPGEE"}},
+			{Email: "removed@example.com", Sites: []string{"PACTA"}},
+			{Claim: "groups", Value: "partners", Provider: "okta", Sites: []string{"PACTA"}},
+		},
+	}
+	newCfg := &allowlist.Config{
+		Format: "v1",
+		Allowlist: []*allowlist.AllowlistEntry{
+			{Domain: "rmi.org"},
+			{Domain: "opgee-only.example.com", Sites: []string{"PACTA"}},
+			{Claim: "groups", Value: "abc"},
+			{Claim: "groups", Value: "partners", Provider: "partner-okta", Sites: []string{"PACTA"}},
+		},
+	}
+
+	got := diffConfigs(oldCfg, newCfg)
+	want := []string{
+		"+ claim groups=abc: gained all sites",
+		"- claim groups=partners from okta: lost PACTA",
+		"+ claim groups=partners from partner-okta: gained PACTA",
+		"~ domain opgee-only.example.com: gained PACTA; lost OPGEE",
+		"- email removed@example.com: lost PACTA",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
+func TestExpiringEntries(t *testing.T) {
+	now := time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+	cfg := &allowlist.Config{
+		Format: "v1",
+		Allowlist: []*allowlist.AllowlistEntry{
+			{Domain: "rmi.org"},
+			{Email: "expired@example.com", NotAfter: at(-time.Hour)},
+			{Domain: "pilot.example.com", NotAfter: at(48 * time.Hour)},
+			{Claim: "groups", Value: "partners", Provider: "partner-okta", NotAfter: at(24 * time.Hour)},
+			{Domain: "later.example.com", NotAfter: at(60 * 24 * time.Hour)},
+		},
+	}
+	checker, err := allowlist.NewChecker(cfg, allowlist.WithNow(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+
+	got := expiringEntries(checker, 30*24*time.Hour, now)
+	want := []string{
+		"email expired@example.com: expired at 2023-08-31T23:00:00Z",
+		"domain pilot.example.com: expires at 2023-09-03T00:00:00Z (in 48h0m0s)",
+		"claim groups=partners from partner-okta: expires at 2023-09-02T00:00:00Z (in 24h0m0s)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected expiring entries (-want +got)\n%s", diff)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+)
+
+// expiringEntries returns a human-readable line for each entry in the checker
+// that expires within the given duration of now, including entries that have
+// already expired. The checker should be evaluated at now.
+func expiringEntries(checker *allowlist.Checker, within time.Duration, now time.Time) []string {
+	var out []string
+	for _, ae := range checker.ExpiringWithin(within) {
+		notAfter := ae.NotAfter.Format(time.RFC3339)
+		if ae.NotAfter.After(now) {
+			out = append(out, fmt.Sprintf("%s: expires at %s (in %s)", entryKey(ae), notAfter, ae.NotAfter.Sub(now).Round(time.Hour)))
+		} else {
+			out = append(out, fmt.Sprintf("%s: expired at %s", entryKey(ae), notAfter))
+		}
+	}
+	return out
+}
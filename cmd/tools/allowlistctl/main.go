@@ -0,0 +1,428 @@
+// Command allowlistctl is a CLI tool for working with allowlist files. It
+// supports the following subcommands:
+//
+//   - 'validate' - Checks that allowlist files are valid, using the same rules
+//     as the server.
+//   - 'check' - Explains whether an email would be allowed, for which sites,
+//     and which entry is responsible.
+//   - 'add' - Adds an entry to an allowlist file, preserving the formatting of
+//     the rest of the file.
+//   - 'remove' - Removes an entry from an allowlist file, preserving the
+//     formatting of the rest of the file.
+//   - 'diff' - Shows which emails, domains, and claims gained or lost site
+//     access between two allowlist files.
+//   - 'expiring' - Lists entries that have expired or will expire soon, so
+//     that time-bounded access (e.g. for pilot partners) can be extended or
+//     cleaned up before it lapses.
+//
+// Flags come before positional arguments, e.g.
+//
+//	allowlistctl add --domain=example.com --sites=OPGEE path/to/allowlist.json
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/flagext"
+)
+
+func main() {
+	if err := run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+const usage = `usage: allowlistctl <validate|check|add|remove|diff|expiring> [flags] [args]`
+
+func run(args []string) error {
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+
+	cmd, args := args[1], args[2:]
+	switch cmd {
+	case "validate":
+		return runValidate(args)
+	case "check":
+		return runCheck(args)
+	case "add":
+		return runAdd(args)
+	case "remove":
+		return runRemove(args)
+	case "diff":
+		return runDiff(args)
+	case "expiring":
+		return runExpiring(args)
+	default:
+		return fmt.Errorf("unknown command %q, %s", cmd, usage)
+	}
+}
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: allowlistctl validate <file>...")
+	}
+
+	var failed bool
+	for _, fn := range fs.Args() {
+		cfg, err := loadAndValidate(fn)
+		if err != nil {
+			fmt.Printf("%s: INVALID: %v\n", fn, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: OK (%d entries)\n", fn, len(cfg.Allowlist))
+	}
+	if failed {
+		return errors.New("one or more allowlist files were invalid")
+	}
+	return nil
+}
+
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	at := fs.String("at", "", "If set, evaluate the allowlist at this RFC 3339 timestamp instead of now.")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: allowlistctl check [--at=<timestamp>] <file> <email>")
+	}
+	fn, email := fs.Arg(0), fs.Arg(1)
+
+	now := time.Now()
+	if *at != "" {
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("failed to parse --at: %w", err)
+		}
+		now = t
+	}
+
+	cfg, err := allowlist.LoadConfigFile(fn)
+	if err != nil {
+		return err
+	}
+	checker, err := allowlist.NewChecker(cfg, allowlist.WithNow(func() time.Time { return now }))
+	if err != nil {
+		return fmt.Errorf("invalid allowlist: %w", err)
+	}
+
+	m, err := checker.Match(email)
+	if err != nil {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+	if m != nil {
+		fmt.Printf("%s is ALLOWED on %s\n", email, describeSites(m.Entity))
+		fmt.Printf("  via %s\n", describeEntry(m.Entry))
+		return nil
+	}
+
+	fmt.Printf("%s is NOT ALLOWED\n", email)
+	// Explain any entries that would've matched, but aren't currently in effect.
+	for _, ae := range cfg.Allowlist {
+		if !entryMatchesEmail(ae, email) {
+			continue
+		}
+		fmt.Printf("  %s exists, but isn't in effect at %s\n", describeEntry(ae), now.Format(time.RFC3339))
+	}
+	if names := checker.ClaimNames(); len(names) > 0 {
+		fmt.Printf("  note: users may still be allowed based on the %s claim(s) in their token\n", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func runAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	var (
+		ek        = registerEntryKeyFlags(fs)
+		sites     flagext.StringList
+		notBefore = fs.String("not_before", "", "If set, the RFC 3339 timestamp the entry starts granting access at.")
+		notAfter  = fs.String("not_after", "", "If set, the RFC 3339 timestamp the entry stops granting access at.")
+	)
+	fs.Var(&sites, "sites", "A comma-separated list of sites to allow, all sites are allowed if empty.")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: allowlistctl add <--email|--domain|--claim+--value[+--provider]>=... [--sites=...] <file>")
+	}
+	fn := fs.Arg(0)
+
+	ae, err := ek.entry()
+	if err != nil {
+		return err
+	}
+	ae.Sites = sites
+	if ae.NotBefore, err = parseOptionalTime(*notBefore); err != nil {
+		return fmt.Errorf("failed to parse --not_before: %w", err)
+	}
+	if ae.NotAfter, err = parseOptionalTime(*notAfter); err != nil {
+		return fmt.Errorf("failed to parse --not_after: %w", err)
+	}
+
+	return editFile(fn, func(doc *allowlistDoc, cfg *allowlist.Config) ([]byte, error) {
+		if idx := findEntry(cfg, ae); idx >= 0 {
+			return nil, fmt.Errorf("%s already exists at index %d, remove it first", describeEntry(ae), idx)
+		}
+		return doc.add(ae)
+	})
+}
+
+func runRemove(args []string) error {
+	fs := flag.NewFlagSet("remove", flag.ContinueOnError)
+	ek := registerEntryKeyFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: allowlistctl remove <--email|--domain|--claim+--value[+--provider]>=... <file>")
+	}
+	fn := fs.Arg(0)
+
+	ae, err := ek.entry()
+	if err != nil {
+		return err
+	}
+
+	return editFile(fn, func(doc *allowlistDoc, cfg *allowlist.Config) ([]byte, error) {
+		idx := findEntry(cfg, ae)
+		if idx < 0 {
+			return nil, fmt.Errorf("%s wasn't found", describeEntry(ae))
+		}
+		return doc.remove(idx), nil
+	})
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: allowlistctl diff <old file> <new file>")
+	}
+
+	oldCfg, err := loadAndValidate(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to load old allowlist: %w", err)
+	}
+	newCfg, err := loadAndValidate(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("failed to load new allowlist: %w", err)
+	}
+
+	changes := diffConfigs(oldCfg, newCfg)
+	if len(changes) == 0 {
+		fmt.Println("No changes in site access")
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+func runExpiring(args []string) error {
+	fs := flag.NewFlagSet("expiring", flag.ContinueOnError)
+	var (
+		within = fs.Duration("within", 30*24*time.Hour, "List entries that expire within this long from now.")
+		at     = fs.String("at", "", "If set, evaluate the allowlist at this RFC 3339 timestamp instead of now.")
+	)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: allowlistctl expiring [--within=720h] [--at=<timestamp>] <file>")
+	}
+	if *within < 0 {
+		return fmt.Errorf("--within must be non-negative, was %s", *within)
+	}
+
+	now := time.Now()
+	if *at != "" {
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("failed to parse --at: %w", err)
+		}
+		now = t
+	}
+
+	cfg, err := allowlist.LoadConfigFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	checker, err := allowlist.NewChecker(cfg, allowlist.WithNow(func() time.Time { return now }))
+	if err != nil {
+		return fmt.Errorf("invalid allowlist: %w", err)
+	}
+
+	entries := expiringEntries(checker, *within, now)
+	if len(entries) == 0 {
+		fmt.Printf("No entries expire within %s\n", *within)
+		return nil
+	}
+	for _, e := range entries {
+		fmt.Println(e)
+	}
+	return nil
+}
+
+// editFile applies an edit to the allowlist file, and only writes it back if
+// the result is still a valid allowlist.
+func editFile(fn string, edit func(*allowlistDoc, *allowlist.Config) ([]byte, error)) error {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return fmt.Errorf("failed to stat allowlist file: %w", err)
+	}
+	raw, err := os.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("failed to read allowlist file: %w", err)
+	}
+	doc, err := parseDoc(raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse allowlist file: %w", err)
+	}
+	cfg, err := decodeConfig(raw)
+	if err != nil {
+		return err
+	}
+
+	out, err := edit(doc, cfg)
+	if err != nil {
+		return err
+	}
+
+	newCfg, err := decodeConfig(out)
+	if err != nil {
+		return fmt.Errorf("edit produced an unparseable allowlist: %w", err)
+	}
+	if _, err := allowlist.NewChecker(newCfg); err != nil {
+		return fmt.Errorf("edit produced an invalid allowlist: %w", err)
+	}
+
+	if err := os.WriteFile(fn, out, fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write allowlist file: %w", err)
+	}
+	return nil
+}
+
+func loadAndValidate(fn string) (*allowlist.Config, error) {
+	cfg, err := allowlist.LoadConfigFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := allowlist.NewChecker(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type entryKeyFlags struct {
+	email, domain, claim, value, provider *string
+}
+
+func registerEntryKeyFlags(fs *flag.FlagSet) *entryKeyFlags {
+	return &entryKeyFlags{
+		email:    fs.String("email", "", "The email address the entry applies to."),
+		domain:   fs.String("domain", "", "The email domain the entry applies to."),
+		claim:    fs.String("claim", "", "The source token claim the entry applies to, requires --value."),
+		value:    fs.String("value", "", "The source token claim value the entry applies to, requires --claim."),
+		provider: fs.String("provider", "", "The identity provider whose tokens a --claim entry applies to, required if the allowlist is shared by several providers."),
+	}
+}
+
+func (ek *entryKeyFlags) entry() (*allowlist.AllowlistEntry, error) {
+	n := 0
+	for _, v := range []string{*ek.email, *ek.domain, *ek.claim} {
+		if v != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("exactly one of --email, --domain, or --claim must be set")
+	}
+	if (*ek.claim == "") != (*ek.value == "") {
+		return nil, errors.New("--claim and --value must be set together")
+	}
+	if *ek.provider != "" && *ek.claim == "" {
+		return nil, errors.New("--provider can only be set with --claim")
+	}
+	return &allowlist.AllowlistEntry{
+		Email:    *ek.email,
+		Domain:   *ek.domain,
+		Claim:    *ek.claim,
+		Value:    *ek.value,
+		Provider: *ek.provider,
+	}, nil
+}
+
+func parseOptionalTime(in string) (*time.Time, error) {
+	if in == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, in)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func findEntry(cfg *allowlist.Config, target *allowlist.AllowlistEntry) int {
+	want := entryKey(target)
+	for i, ae := range cfg.Allowlist {
+		if entryKey(ae) == want {
+			return i
+		}
+	}
+	return -1
+}
+
+func entryMatchesEmail(ae *allowlist.AllowlistEntry, email string) bool {
+	email = strings.ToLower(email)
+	if ae.Email != "" {
+		return strings.ToLower(ae.Email) == email
+	}
+	if ae.Domain != "" {
+		_, domain, _ := strings.Cut(email, "@")
+		return strings.ToLower(ae.Domain) == domain
+	}
+	return false
+}
+
+func describeEntry(ae *allowlist.AllowlistEntry) string {
+	desc := entryKey(ae) + " entry"
+	var window []string
+	if ae.NotBefore != nil {
+		window = append(window, "from "+ae.NotBefore.Format(time.RFC3339))
+	}
+	if ae.NotAfter != nil {
+		window = append(window, "until "+ae.NotAfter.Format(time.RFC3339))
+	}
+	if len(window) > 0 {
+		desc += " (valid " + strings.Join(window, " ") + ")"
+	}
+	return desc
+}
+
+func describeSites(e *allowlist.Entity) string {
+	if e.AllowAllSites {
+		return "all sites"
+	}
+	var sites []string
+	for _, s := range e.AllowedSites {
+		sites = append(sites, string(s))
+	}
+	return "sites " + strings.Join(sites, ", ")
+}
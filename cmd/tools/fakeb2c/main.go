@@ -0,0 +1,60 @@
+// Command fakeb2c runs a fake Azure AD B2C tenant, which lets the Azure login
+// flow of the credential service be tested end-to-end without network access.
+// The defaults match the Azure AD settings in cmd/server/configs/local.conf, so
+// a local server can use it by running with:
+//
+//	--use_local_jwts=false --azure_ad_base_url=http://localhost:8081
+//
+// Tokens can then be requested with e.g.
+//
+//	curl 'localhost:8081/token?email=user@rmi.org&claim=groups=opgee-users'
+//
+// and exchanged at the server's /login/cookie or /login/apikey endpoints.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RMI/credential-service/azure/fakeb2c"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	var (
+		port          = flag.Int("port", 8081, "Port to serve the fake tenant on")
+		tenant        = flag.String("tenant_name", "rmiauthlocal", "The name of the fake tenant")
+		tenantID      = flag.String("tenant_id", "1bdaca90-dd54-43ff-a444-ef08988a59fe", "The ID of the fake tenant, used in the 'iss' claim")
+		policies      = flag.String("user_flow", "B2C_1_susi_local", "A comma-separated list of user flows/policies to serve, used in the 'tfp' claim. Tokens are issued for the first one, unless the 'policy' query parameter is set")
+		clientID      = flag.String("client_id", "2d77a4a9-b7be-4451-ad47-c151d8b6c05f", "The client ID tokens are issued for, used in the 'aud' claim")
+		tokenLifetime = flag.Duration("token_lifetime", time.Hour, "How long issued tokens are valid for")
+	)
+	flag.Parse()
+
+	fb, err := fakeb2c.New(&fakeb2c.Config{
+		Tenant:        *tenant,
+		TenantID:      *tenantID,
+		Policies:      strings.Split(*policies, ","),
+		ClientID:      *clientID,
+		TokenLifetime: *tokenLifetime,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to init fake tenant: %w", err)
+	}
+	fb.BaseURL = fmt.Sprintf("http://localhost:%d", *port)
+
+	log.Printf("Serving fake B2C tenant %q at %s, issuer is %s", *tenant, fb.BaseURL, fb.Issuer())
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), fb); err != nil {
+		return fmt.Errorf("error running HTTP server: %w", err)
+	}
+	return nil
+}
@@ -11,8 +11,10 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/RMI/credential-service/cmd/server/usersrv"
 	"github.com/RMI/credential-service/keyutil"
 	"github.com/go-chi/jwtauth/v5"
 )
@@ -31,6 +33,8 @@ func run() error {
 		tokenType   = flag.String("token_type", "source", "The type of token to generate. 'source' means a token to be exchanged for an API key. 'apikey' means an API key ready to use")
 		userID      = flag.String("user_id", "test123", "The ID of the user to put in the 'sub' claim of the token.")
 		expiresIn   = flag.String("expires_in", "24h", "When the token should expire, relative to now. Should be formatted in a way that time.ParseDuration can handle.")
+		emails      = flag.String("emails", "test@rmi.org", "A comma-separated list of emails to put in the 'emails' claim of source tokens, which are checked against the server's allowlist.")
+		nonce       = flag.String("nonce", "", "If set, the 'nonce' claim of source tokens, which the server checks against the X-Auth-Nonce header.")
 	)
 	flag.Parse()
 
@@ -69,6 +73,16 @@ func run() error {
 
 	if *tokenType == "source" {
 		claims["local_auth"] = true
+		// As if the user just logged in, for --max_source_auth_age.
+		claims["auth_time"] = now.Unix()
+		if *nonce != "" {
+			claims["nonce"] = *nonce
+		}
+		if *emails != "" {
+			claims["emails"] = strings.Split(*emails, ",")
+		}
+	} else {
+		claims[usersrv.TokenUseClaim] = string(usersrv.TokenUseAPIKey)
 	}
 
 	_, tkn, err := jwtAuth.Encode(claims)
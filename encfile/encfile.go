@@ -0,0 +1,118 @@
+// Package encfile decrypts configuration files that are encrypted at rest,
+// so that secrets (like allowlists) can be loaded directly into memory
+// without an external decryption step. Two formats are supported:
+//
+//   - Files encrypted with age (https://age-encryption.org), either binary or
+//     ASCII-armored, e.g. `age -r <recipient> -o dev.conf.age dev.conf`
+//   - JSON files encrypted with sops (https://github.com/getsops/sops) using an
+//     age recipient, including files sops encrypts in 'binary' mode (e.g.
+//     .conf files), which are stored as JSON with a single 'data' key.
+//
+// Both are decrypted with age identities, like those generated by age-keygen
+// (which is also the format of sops' SOPS_AGE_KEY_FILE).
+package encfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	ageHeader = "age-encryption.org/v1\n"
+)
+
+// ErrNotEncrypted is returned when decrypting data that isn't in a recognized
+// encrypted format, unless the Decrypter was created with AllowPlaintext.
+var ErrNotEncrypted = errors.New("data wasn't age- or sops-encrypted")
+
+// Decrypter decrypts age- and sops-encrypted files.
+type Decrypter struct {
+	identities     []age.Identity
+	allowPlaintext bool
+}
+
+type Option func(*Decrypter)
+
+// AllowPlaintext makes the Decrypter return data that isn't in a recognized
+// encrypted format as-is, instead of returning ErrNotEncrypted. It's meant for
+// local development, where the same configuration is used with plaintext
+// files.
+func AllowPlaintext() Option {
+	return func(d *Decrypter) {
+		d.allowPlaintext = true
+	}
+}
+
+// NewDecrypterFromKeyFile loads age identities (one per line, comments
+// allowed) from the given key file.
+func NewDecrypterFromKeyFile(fn string, opts ...Option) (*Decrypter, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key file: %w", err)
+	}
+	defer f.Close()
+
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identities from key file: %w", err)
+	}
+	d := &Decrypter{identities: ids}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d, nil
+}
+
+// ReadFile reads the given file and decrypts it, see Decrypt.
+func (d *Decrypter) ReadFile(fn string) ([]byte, error) {
+	dat, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	out, err := d.Decrypt(dat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %q: %w", fn, err)
+	}
+	return out, nil
+}
+
+// Decrypt detects the format of the given data and decrypts it. Data that
+// isn't in a recognized encrypted format is rejected with ErrNotEncrypted, so
+// a plaintext file can't be swapped in for an encrypted one, unless the
+// Decrypter was created with AllowPlaintext.
+func (d *Decrypter) Decrypt(dat []byte) ([]byte, error) {
+	trimmed := bytes.TrimLeft(dat, " \t\r\n")
+	switch {
+	case bytes.HasPrefix(trimmed, []byte(armor.Header)):
+		return d.decryptAge(armor.NewReader(bytes.NewReader(trimmed)))
+	case bytes.HasPrefix(dat, []byte(ageHeader)):
+		return d.decryptAge(bytes.NewReader(dat))
+	case isSOPSFile(trimmed):
+		return d.decryptSOPS(trimmed)
+	case d.allowPlaintext:
+		return dat, nil
+	default:
+		return nil, ErrNotEncrypted
+	}
+}
+
+func (d *Decrypter) decryptAge(r io.Reader) ([]byte, error) {
+	if len(d.identities) == 0 {
+		return nil, errors.New("no age identities were loaded")
+	}
+	dr, err := age.Decrypt(r, d.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt age file: %w", err)
+	}
+	out, err := io.ReadAll(dr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decrypted age file: %w", err)
+	}
+	return out, nil
+}
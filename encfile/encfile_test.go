@@ -0,0 +1,126 @@
+package encfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// The files in testdata were generated with the real age + sops CLIs, e.g.:
+//
+//	age-keygen -o test.key
+//	sops --encrypt --age <recipient> allowlist.json > allowlist.enc.json
+//	sops --encrypt --age <recipient> server.conf > server.enc.conf
+//	age -r <recipient> -a -o server.conf.age server.conf
+//	age -r <recipient> -o server.conf.age.bin server.conf
+
+func TestDecrypt_Conf(t *testing.T) {
+	d := loadDecrypter(t)
+	want := readTestdata(t, "server.conf")
+
+	for _, fn := range []string{"server.conf.age", "server.conf.age.bin", "server.enc.conf"} {
+		t.Run(fn, func(t *testing.T) {
+			got, err := d.ReadFile(filepath.Join("testdata", fn))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Errorf("unexpected decrypted contents (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecrypt_SOPSJSON(t *testing.T) {
+	d := loadDecrypter(t)
+
+	got, err := d.ReadFile(filepath.Join("testdata", "allowlist.enc.json"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	if diff := cmp.Diff(unmarshal(t, readTestdata(t, "allowlist.json")), unmarshal(t, got)); diff != "" {
+		t.Errorf("unexpected decrypted contents (-want +got)\n%s", diff)
+	}
+}
+
+func TestDecrypt_SOPSTampered(t *testing.T) {
+	d := loadDecrypter(t)
+
+	dat := readTestdata(t, "allowlist.enc.json")
+	// This value is unencrypted (because of the '_unencrypted' suffix), but it's
+	// still covered by the MAC.
+	dat = bytes.Replace(dat, []byte("left in plaintext"), []byte("modified plaintext"), 1)
+
+	if _, err := d.Decrypt(dat); err == nil {
+		t.Fatal("Decrypt returned no error for a tampered file")
+	}
+}
+
+func TestDecrypt_Plaintext(t *testing.T) {
+	fn := filepath.Join("testdata", "server.conf")
+
+	if _, err := loadDecrypter(t).ReadFile(fn); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("ReadFile(%q) = %v, want ErrNotEncrypted", fn, err)
+	}
+
+	d, err := NewDecrypterFromKeyFile(filepath.Join("testdata", "test.key"), AllowPlaintext())
+	if err != nil {
+		t.Fatalf("NewDecrypterFromKeyFile: %v", err)
+	}
+	got, err := d.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if diff := cmp.Diff(string(readTestdata(t, "server.conf")), string(got)); diff != "" {
+		t.Errorf("unexpected contents (-want +got)\n%s", diff)
+	}
+}
+
+func TestDecrypt_WrongKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "other.key")
+	// Generated with age-keygen, not a recipient of any of the test files.
+	otherKey := "AGE-SECRET-KEY-1FX7EFGWQPPLLRUTR48Y2E9JJAJ0HT6QU6H9AXR2U830W6ARCXC3Q2DHYTA\n"
+	if err := os.WriteFile(keyFile, []byte(otherKey), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	d, err := NewDecrypterFromKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("NewDecrypterFromKeyFile: %v", err)
+	}
+
+	for _, fn := range []string{"server.conf.age", "allowlist.enc.json"} {
+		if _, err := d.ReadFile(filepath.Join("testdata", fn)); err == nil {
+			t.Errorf("ReadFile(%q) returned no error with the wrong key", fn)
+		}
+	}
+}
+
+func loadDecrypter(t *testing.T) *Decrypter {
+	d, err := NewDecrypterFromKeyFile(filepath.Join("testdata", "test.key"))
+	if err != nil {
+		t.Fatalf("NewDecrypterFromKeyFile: %v", err)
+	}
+	return d
+}
+
+func readTestdata(t *testing.T, fn string) []byte {
+	dat, err := os.ReadFile(filepath.Join("testdata", fn))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	return dat
+}
+
+func unmarshal(t *testing.T, dat []byte) map[string]any {
+	var out map[string]any
+	if err := json.Unmarshal(dat, &out); err != nil {
+		t.Fatalf("failed to unmarshal JSON: %v", err)
+	}
+	return out
+}
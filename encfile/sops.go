@@ -0,0 +1,108 @@
+package encfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/keyservice"
+	"google.golang.org/grpc"
+)
+
+func isSOPSFile(dat []byte) bool {
+	if len(dat) == 0 || dat[0] != '{' {
+		return false
+	}
+	var f map[string]json.RawMessage
+	if err := json.Unmarshal(dat, &f); err != nil {
+		return false
+	}
+	_, ok := f["sops"]
+	return ok
+}
+
+// sopsFormat returns the format sops used to store the file. Files that sops
+// encrypts in 'binary' mode (e.g. .conf files) are stored as JSON with a single
+// 'data' key, which holds the original file contents.
+func sopsFormat(dat []byte) formats.Format {
+	var f map[string]json.RawMessage
+	if err := json.Unmarshal(dat, &f); err != nil {
+		return formats.Json
+	}
+	if _, ok := f["data"]; ok && len(f) == 2 {
+		return formats.Binary
+	}
+	return formats.Json
+}
+
+// decryptSOPS mirrors sops' decrypt.DataWithFormat, but gets the data key from
+// our own age identities instead of the environment (e.g. SOPS_AGE_KEY_FILE),
+// and never from other key types like Azure Key Vault.
+func (d *Decrypter) decryptSOPS(dat []byte) ([]byte, error) {
+	store := common.StoreForFormat(sopsFormat(dat))
+
+	tree, err := store.LoadEncryptedFile(dat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sops file: %w", err)
+	}
+	key, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{&ageKeyService{identities: d.identities}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sops data key: %w", err)
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(key, cipher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt sops file: %w", err)
+	}
+	// The MAC covers every value, including unencrypted ones, so this catches
+	// files that were modified after they were encrypted.
+	originalMAC, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, key, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt sops MAC: %w", err)
+	}
+	if originalMAC != mac {
+		return nil, errors.New("sops file failed integrity check, MAC didn't match")
+	}
+
+	out, err := store.EmitPlainFile(tree.Branches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit decrypted sops file: %w", err)
+	}
+	return out, nil
+}
+
+// ageKeyService is a sops key service that decrypts data keys with the given
+// age identities. It doesn't support any other key types.
+type ageKeyService struct {
+	identities []age.Identity
+}
+
+func (s *ageKeyService) Encrypt(context.Context, *keyservice.EncryptRequest, ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	return nil, errors.New("encrypting isn't supported")
+}
+
+func (s *ageKeyService) Decrypt(_ context.Context, req *keyservice.DecryptRequest, _ ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	k, ok := req.Key.KeyType.(*keyservice.Key_AgeKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T, only age keys are supported", req.Key.KeyType)
+	}
+	if len(s.identities) == 0 {
+		return nil, errors.New("no age identities were loaded")
+	}
+	mk := &sopsage.MasterKey{Recipient: k.AgeKey.Recipient}
+	mk.SetEncryptedDataKey(req.Ciphertext)
+	sopsage.ParsedIdentities(s.identities).ApplyToMasterKey(mk)
+	plaintext, err := mk.Decrypt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
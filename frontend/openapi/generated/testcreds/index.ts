@@ -10,7 +10,10 @@ export { CancelablePromise, CancelError } from './core/CancelablePromise';
 export { OpenAPI } from './core/OpenAPI';
 export type { OpenAPIConfig } from './core/OpenAPI';
 
+export type { BatchCredentialCheck } from './models/BatchCredentialCheck';
+export type { BatchCredentialCheckRequest } from './models/BatchCredentialCheckRequest';
 export type { CredentialCheck } from './models/CredentialCheck';
 export type { Error } from './models/Error';
+export { FailureCode } from './models/FailureCode';
 
 export { DefaultService } from './services/DefaultService';
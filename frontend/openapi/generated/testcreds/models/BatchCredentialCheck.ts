@@ -0,0 +1,14 @@
+/* generated using openapi-typescript-codegen -- do no edit */
+/* istanbul ignore file */
+/* tslint:disable */
+/* eslint-disable */
+
+import type { CredentialCheck } from './CredentialCheck';
+
+export type BatchCredentialCheck = {
+    /**
+     * The result for each token, in the order they were given.
+     */
+    results: Array<CredentialCheck>;
+};
+
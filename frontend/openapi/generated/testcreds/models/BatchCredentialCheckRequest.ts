@@ -0,0 +1,20 @@
+/* generated using openapi-typescript-codegen -- do no edit */
+/* istanbul ignore file */
+/* tslint:disable */
+/* eslint-disable */
+
+export type BatchCredentialCheckRequest = {
+    /**
+     * The tokens to check.
+     */
+    tokens: Array<string>;
+    /**
+     * A site every token must grant access to, e.g. PACTA
+     */
+    site?: string;
+    /**
+     * An audience every token must have been issued for, e.g. pacta.rmi.org
+     */
+    audience?: string;
+};
+
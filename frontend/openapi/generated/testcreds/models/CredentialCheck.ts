@@ -3,6 +3,8 @@
 /* tslint:disable */
 /* eslint-disable */
 
+import type { FailureCode } from './FailureCode';
+
 export type CredentialCheck = {
     /**
      * Whether or not the token was valid
@@ -12,6 +14,7 @@ export type CredentialCheck = {
      * Description of why the token was invalid, only populated if valid is false.
      */
     failureReason?: string;
+    failureCode?: FailureCode;
     /**
      * Unique identifier for the token, only populated if valid is true.
      */
@@ -20,5 +23,29 @@ export type CredentialCheck = {
      * Identifier for the user, only populated if valid is true.
      */
     userID?: string;
+    /**
+     * ID of the key the token was signed with, populated if the token could be parsed.
+     */
+    keyID?: string;
+    /**
+     * All of the token's claims, populated if the token's signature was valid, even if it failed other checks.
+     */
+    claims?: Record<string, any>;
+    /**
+     * When the token expires, populated if the token's signature was valid.
+     */
+    expiresAt?: string;
+    /**
+     * Whether the token grants access to every site, populated if the token's signature was valid.
+     */
+    allSites?: boolean;
+    /**
+     * The sites the token grants access to, populated if the token's signature was valid and allSites is false.
+     */
+    allowedSites?: Array<string>;
+    /**
+     * Whether the token was revoked, only populated if the server checks revocation (see --check_token_revocation).
+     */
+    revoked?: boolean;
 };
 
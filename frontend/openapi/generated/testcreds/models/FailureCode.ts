@@ -0,0 +1,22 @@
+/* generated using openapi-typescript-codegen -- do no edit */
+/* istanbul ignore file */
+/* tslint:disable */
+/* eslint-disable */
+
+/**
+ * Machine-readable reason the token was invalid, only populated if valid is false.
+ *
+ */
+export enum FailureCode {
+    NO_TOKEN = 'no_token',
+    MALFORMED_TOKEN = 'malformed_token',
+    INVALID_SIGNATURE = 'invalid_signature',
+    SOURCE_TOKEN = 'source_token',
+    INVALID_ISSUED_AT = 'invalid_issued_at',
+    EXPIRED = 'expired',
+    NOT_YET_VALID = 'not_yet_valid',
+    INVALID_CLAIMS = 'invalid_claims',
+    WRONG_AUDIENCE = 'wrong_audience',
+    SITE_NOT_ALLOWED = 'site_not_allowed',
+    REVOKED = 'revoked',
+}
@@ -2,6 +2,8 @@
 /* istanbul ignore file */
 /* tslint:disable */
 /* eslint-disable */
+import type { BatchCredentialCheck } from '../models/BatchCredentialCheck';
+import type { BatchCredentialCheckRequest } from '../models/BatchCredentialCheckRequest';
 import type { CredentialCheck } from '../models/CredentialCheck';
 import type { Error } from '../models/Error';
 
@@ -20,14 +22,67 @@ export class DefaultService {
      * Note that even when this endpoint fails, it returns a 200 response. The
      * response body will contain the reason for the failure.
      *
+     * If a site or audience is given, the token must also grant access to
+     * that site, or have been issued for that audience.
+     *
+     * If the server has registered clients, callers must authenticate as
+     * one with 'client_id' and 'client_secret' form parameters, since the
+     * Authorization header holds the token being checked. Otherwise, the
+     * request fails with a 401.
+     *
      * @returns CredentialCheck API key response
      * @returns Error unexpected error
      * @throws ApiError
      */
-    public checkCredentials(): CancelablePromise<CredentialCheck | Error> {
+    public checkCredentials({
+        site,
+        audience,
+    }: {
+        /**
+         * A site the token must grant access to, e.g. PACTA
+         */
+        site?: string,
+        /**
+         * An audience the token must have been issued for, e.g. pacta.rmi.org
+         */
+        audience?: string,
+    }): CancelablePromise<CredentialCheck | Error> {
         return this.httpRequest.request({
             method: 'POST',
             url: '/credentials:check',
+            query: {
+                'site': site,
+                'audience': audience,
+            },
+        });
+    }
+
+    /**
+     * Confirm that many JWTs can be used with RMI services.
+     * Checks each of the given tokens like /credentials:check, e.g. for
+     * services that periodically revalidate cached sessions. Results are in
+     * the same order as the tokens.
+     *
+     * Like /credentials:check, invalid tokens don't cause the request to fail,
+     * but requests with more tokens than the server's maximum batch size do.
+     *
+     * If the server has registered clients, callers must authenticate as
+     * one with HTTP Basic auth, or the request fails with a 401.
+     *
+     * @returns BatchCredentialCheck Per-token results
+     * @returns Error unexpected error
+     * @throws ApiError
+     */
+    public batchCheckCredentials({
+        requestBody,
+    }: {
+        requestBody: BatchCredentialCheckRequest,
+    }): CancelablePromise<BatchCredentialCheck | Error> {
+        return this.httpRequest.request({
+            method: 'POST',
+            url: '/credentials:batchCheck',
+            body: requestBody,
+            mediaType: 'application/json',
         });
     }
 
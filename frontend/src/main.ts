@@ -66,7 +66,7 @@ export async function testAPIKey(): Promise<void> {
     CREDENTIALS: 'omit',
     BASE: "http://localhost:8080",
   }).default;
-  const resp = await client.checkCredentials();
+  const resp = await client.checkCredentials({});
   UIManager.showTestAPIKey(JSON.stringify(resp))
 }
 
@@ -76,6 +76,6 @@ export async function testAuthCookie(): Promise<void> {
     WITH_CREDENTIALS: true,
     BASE: "http://localhost:8080",
   }).default;
-  const resp = await client.checkCredentials();
+  const resp = await client.checkCredentials({});
   UIManager.showTestAuthCookie(JSON.stringify(resp))
 }
@@ -4,7 +4,9 @@ package keyutil
 
 import (
 	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -130,6 +132,16 @@ func DecodeED25519PrivateKey(privDER []byte) (ed25519.PrivateKey, error) {
 	return privED, nil
 }
 
+// DeriveKey derives a 32-byte symmetric key for the given purpose from another
+// secret, like the seed of the Ed25519 key we sign tokens with, so that it
+// doesn't need to be configured (and rotated) separately. Keys for different
+// purposes are independent of each other.
+func DeriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("credential-service " + purpose))
+	return mac.Sum(nil)
+}
+
 func decodeFromFile(name, typ string) ([]byte, error) {
 	dat, err := os.ReadFile(name)
 	if err != nil {
@@ -23,9 +23,11 @@ type AuthSigningKey struct {
 
 type AzureAD struct {
 	TenantName string
-	UserFlow   string
-	ClientID   string
-	TenantID   string
+	// UserFlows are the user flows and custom policies users can sign in with,
+	// parsed from the comma-separated raw UserFlow.
+	UserFlows []string
+	ClientID  string
+	TenantID  string
 }
 
 type RawConfig struct {
@@ -74,7 +76,13 @@ func parseAzureAD(az *RawAzureAD) (*AzureAD, error) {
 	if az.TenantName == "" {
 		return nil, errors.New("no tenant_name was provided")
 	}
-	if az.UserFlow == "" {
+	var userFlows []string
+	for _, uf := range strings.Split(az.UserFlow, ",") {
+		if uf = strings.TrimSpace(uf); uf != "" {
+			userFlows = append(userFlows, uf)
+		}
+	}
+	if len(userFlows) == 0 {
 		return nil, errors.New("no user_flow was provided")
 	}
 	if az.ClientID == "" {
@@ -85,7 +93,7 @@ func parseAzureAD(az *RawAzureAD) (*AzureAD, error) {
 	}
 	return &AzureAD{
 		TenantName: az.TenantName,
-		UserFlow:   az.UserFlow,
+		UserFlows:  userFlows,
 		ClientID:   az.ClientID,
 		TenantID:   az.TenantID,
 	}, nil
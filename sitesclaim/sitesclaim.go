@@ -0,0 +1,139 @@
+// Package sitesclaim encodes and parses the 'sites' claim of issued tokens,
+// which lists the sites the user can access. It has two forms:
+//
+//   - The legacy form, a string that's either "all" or a comma-separated list
+//     of sites, e.g. "PACTA,OPGEE"
+//   - The structured form, a versioned JSON object keyed by site, which can
+//     carry per-site attributes, e.g. {"v": 1, "sites": {"PACTA": {}}} or
+//     {"v": 1, "all": true}
+//
+// Parse accepts both, so verifiers can be updated before the issuer starts
+// issuing the structured form, see the server's --structured_sites_claim flag.
+package sitesclaim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/RMI/credential-service/allowlist"
+)
+
+// Name is the name of the claim in tokens.
+const Name = "sites"
+
+// Version is the current version of the structured form.
+const Version = 1
+
+// legacyAll is the legacy form of a claim for every site.
+const legacyAll = "all"
+
+// Claim is the parsed 'sites' claim, and the structured form of it.
+type Claim struct {
+	Version int `json:"v"`
+	// All is true if the user can access every site, in which case Sites is
+	// empty.
+	All   bool                          `json:"all,omitempty"`
+	Sites map[allowlist.Site]Attributes `json:"sites,omitempty"`
+}
+
+// Attributes are per-site details of the user's access. There aren't any yet,
+// but the legacy form can't carry them at all.
+type Attributes struct{}
+
+// FromEntity returns the claim for the sites an allowlist entity can access.
+func FromEntity(ae *allowlist.Entity) *Claim {
+	if ae.AllowAllSites {
+		return &Claim{Version: Version, All: true}
+	}
+	return ForSites(ae.AllowedSites...)
+}
+
+// ForSites returns the claim for the given sites.
+func ForSites(sites ...allowlist.Site) *Claim {
+	c := &Claim{Version: Version, Sites: make(map[allowlist.Site]Attributes)}
+	for _, s := range sites {
+		c.Sites[s] = Attributes{}
+	}
+	return c
+}
+
+// Allows returns true if the claim includes the site.
+func (c *Claim) Allows(site allowlist.Site) bool {
+	if c.All {
+		return true
+	}
+	_, ok := c.Sites[site]
+	return ok
+}
+
+// List returns the sites in the claim, sorted. It's empty if All is set.
+func (c *Claim) List() []allowlist.Site {
+	var out []allowlist.Site
+	for s := range c.Sites {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Legacy returns the legacy string form of the claim.
+func (c *Claim) Legacy() string {
+	if c.All {
+		return legacyAll
+	}
+	var sites []string
+	for _, s := range c.List() {
+		sites = append(sites, string(s))
+	}
+	return strings.Join(sites, ",")
+}
+
+// Parse parses either form of the claim, as returned by jwt.Token.Get, i.e. a
+// string, or a map[string]any for the structured form.
+func Parse(v any) (*Claim, error) {
+	switch vt := v.(type) {
+	case string:
+		return parseLegacy(vt), nil
+	case map[string]any:
+		dat, err := json.Marshal(vt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal claim: %w", err)
+		}
+		return parseStructured(dat)
+	case *Claim:
+		return vt, nil
+	default:
+		return nil, fmt.Errorf("'sites' claim was of type %T, expected a string or object", v)
+	}
+}
+
+// parseStructured parses the JSON encoding of the structured form.
+func parseStructured(dat []byte) (*Claim, error) {
+	var c Claim
+	if err := json.Unmarshal(dat, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode 'sites' claim: %w", err)
+	}
+	if c.Version != Version {
+		return nil, fmt.Errorf("'sites' claim had unsupported version %d", c.Version)
+	}
+	if c.All && len(c.Sites) > 0 {
+		return nil, errors.New("'sites' claim had both 'all' and 'sites'")
+	}
+	return &c, nil
+}
+
+func parseLegacy(s string) *Claim {
+	if s == legacyAll {
+		return &Claim{Version: Version, All: true}
+	}
+	c := &Claim{Version: Version, Sites: make(map[allowlist.Site]Attributes)}
+	for _, site := range strings.Split(s, ",") {
+		if site != "" {
+			c.Sites[allowlist.Site(site)] = Attributes{}
+		}
+	}
+	return c
+}
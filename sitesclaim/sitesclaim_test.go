@@ -0,0 +1,140 @@
+package sitesclaim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	pactaOPGEE := &Claim{
+		Version: Version,
+		Sites:   map[allowlist.Site]Attributes{allowlist.SitePACTA: {}, allowlist.SiteOPGEE: {}},
+	}
+	tests := []struct {
+		desc    string
+		in      string
+		want    *Claim
+		wantErr bool
+	}{
+		{
+			desc: "legacy all",
+			in:   `"all"`,
+			want: &Claim{Version: Version, All: true},
+		},
+		{
+			desc: "legacy list",
+			in:   `"PACTA,OPGEE"`,
+			want: pactaOPGEE,
+		},
+		{
+			desc: "legacy empty",
+			in:   `""`,
+			want: &Claim{Version: Version, Sites: map[allowlist.Site]Attributes{}},
+		},
+		{
+			desc: "structured all",
+			in:   `{"v": 1, "all": true}`,
+			want: &Claim{Version: Version, All: true},
+		},
+		{
+			desc: "structured list",
+			in:   `{"v": 1, "sites": {"PACTA": {}, "OPGEE": {}}}`,
+			want: pactaOPGEE,
+		},
+		{
+			desc:    "unsupported version",
+			in:      `{"v": 2, "sites": {"PACTA": {}}}`,
+			wantErr: true,
+		},
+		{
+			desc:    "missing version",
+			in:      `{"sites": {"PACTA": {}}}`,
+			wantErr: true,
+		},
+		{
+			desc:    "all and sites",
+			in:      `{"v": 1, "all": true, "sites": {"PACTA": {}}}`,
+			wantErr: true,
+		},
+		{
+			desc:    "wrong type",
+			in:      `["PACTA"]`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			// Decode into an 'any' to get the types that jwt.Token.Get returns.
+			var v any
+			if err := json.Unmarshal([]byte(test.in), &v); err != nil {
+				t.Fatalf("failed to unmarshal test input: %v", err)
+			}
+			got, err := Parse(v)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%s) = %+v, want an error", test.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%s): %v", test.in, err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected claim (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	claims := []*Claim{
+		FromEntity(&allowlist.Entity{AllowAllSites: true}),
+		FromEntity(&allowlist.Entity{AllowedSites: []allowlist.Site{allowlist.SiteOPGEE, allowlist.SitePACTA}}),
+		ForSites(allowlist.SitePACTA),
+	}
+	for _, c := range claims {
+		dat, err := json.Marshal(c)
+		if err != nil {
+			t.Fatalf("failed to marshal claim: %v", err)
+		}
+		var structured any
+		if err := json.Unmarshal(dat, &structured); err != nil {
+			t.Fatalf("failed to unmarshal claim: %v", err)
+		}
+		fromStructured, err := Parse(structured)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", dat, err)
+		}
+		if diff := cmp.Diff(c, fromStructured); diff != "" {
+			t.Errorf("unexpected claim after structured round-trip (-want +got)\n%s", diff)
+		}
+
+		fromLegacy, err := Parse(c.Legacy())
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.Legacy(), err)
+		}
+		if diff := cmp.Diff(c, fromLegacy); diff != "" {
+			t.Errorf("unexpected claim after legacy round-trip (-want +got)\n%s", diff)
+		}
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	tests := []struct {
+		in   *Claim
+		want string
+	}{
+		{in: &Claim{Version: Version, All: true}, want: "all"},
+		{in: ForSites(allowlist.SitePACTA, allowlist.SiteOPGEE), want: "OPGEE,PACTA"},
+		{in: ForSites(), want: ""},
+	}
+	for _, test := range tests {
+		if got := test.in.Legacy(); got != test.want {
+			t.Errorf("Legacy() = %q, want %q", got, test.want)
+		}
+	}
+}
@@ -3,15 +3,18 @@
 package siteverify
 
 import (
-	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/sitesclaim"
 	"github.com/go-chi/jwtauth/v5"
 	"go.uber.org/zap"
 )
 
+// CheckSite returns middleware that rejects requests whose token (as added to
+// the context by jwtauth.Verifier) doesn't grant access to the site. New
+// services should use the verify package instead, which also checks the
+// token's audience and issuer.
 func CheckSite(site allowlist.Site, logger zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -26,22 +29,22 @@ func CheckSite(site allowlist.Site, logger zap.Logger) func(http.Handler) http.H
 				return
 			}
 
-			siteClaimI, ok := claims["sites"]
+			siteClaimI, ok := claims[sitesclaim.Name]
 			if !ok {
 				logger.Info("JWT claims had no 'sites' claim")
 				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 				return
 			}
 
-			siteClaim, ok := siteClaimI.(string)
-			if !ok {
-				logger.Info("JWT 'sites' claim had unexpected type", zap.String("type", fmt.Sprintf("%T", siteClaimI)))
+			siteClaim, err := sitesclaim.Parse(siteClaimI)
+			if err != nil {
+				logger.Info("JWT 'sites' claim was malformed", zap.Error(err))
 				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 				return
 			}
 
-			if !isClaimValidForSite(siteClaim, site) {
-				logger.Info("JWT 'sites' claim was invalid", zap.String("claim", siteClaim))
+			if !siteClaim.Allows(site) {
+				logger.Info("JWT 'sites' claim was invalid", zap.String("claim", siteClaim.Legacy()))
 				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 				return
 			}
@@ -52,15 +55,13 @@ func CheckSite(site allowlist.Site, logger zap.Logger) func(http.Handler) http.H
 	}
 }
 
-func isClaimValidForSite(siteClaim string, target allowlist.Site) bool {
-	if siteClaim == "all" {
-		return true
-	}
-
-	for _, s := range strings.Split(siteClaim, ",") {
-		if s == string(target) {
-			return true
-		}
+// IsClaimValidForSite returns true if the legacy form of the 'sites' claim,
+// which is either "all" or a comma-separated list of sites, includes the
+// target site. Use sitesclaim.Parse to handle both forms of the claim.
+func IsClaimValidForSite(siteClaim string, target allowlist.Site) bool {
+	c, err := sitesclaim.Parse(siteClaim)
+	if err != nil {
+		return false
 	}
-	return false
+	return c.Allows(target)
 }
@@ -42,3 +42,33 @@ func AllowlistEntityFromContext(ctx context.Context) (*allowlist.Entity, error)
 	}
 	return entity, nil
 }
+
+type providerContextKey struct{}
+
+// AddProviderToContext records the name of the identity provider that
+// authenticated the request.
+func AddProviderToContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, providerContextKey{}, name)
+}
+
+// ProviderFromContext returns the name of the identity provider that
+// authenticated the request, if any.
+func ProviderFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(providerContextKey{}).(string)
+	return name, ok
+}
+
+type policyContextKey struct{}
+
+// AddPolicyToContext records the user flow or custom policy that the user
+// authenticated with, for identity providers that have them.
+func AddPolicyToContext(ctx context.Context, policy string) context.Context {
+	return context.WithValue(ctx, policyContextKey{}, policy)
+}
+
+// PolicyFromContext returns the user flow or custom policy that the user
+// authenticated with, if any.
+func PolicyFromContext(ctx context.Context) (string, bool) {
+	policy, ok := ctx.Value(policyContextKey{}).(string)
+	return policy, ok
+}
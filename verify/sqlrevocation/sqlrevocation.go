@@ -0,0 +1,83 @@
+// Package sqlrevocation implements a verify.RevocationChecker backed by a SQL
+// database (SQLite or Postgres), usually the credential service's allowlist
+// database, so that the server and any services sharing the database agree on
+// which tokens were revoked.
+//
+// Tokens are revoked by their 'jti' claim, which is logged as the 'id' when the
+// credential service issues a token, and returned as the 'id' of API keys.
+package sqlrevocation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RMI/credential-service/verify"
+)
+
+// Schema creates the table that revoked token IDs are recorded in, along with
+// the token's expiry as a Unix timestamp, after which the row is no longer
+// needed. The schema is compatible with both SQLite and Postgres.
+const Schema = `CREATE TABLE IF NOT EXISTS revoked_tokens (
+	id         TEXT PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+)`
+
+// Checker checks and records revoked tokens in a database.
+type Checker struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+var _ verify.RevocationChecker = (*Checker)(nil)
+
+// New returns a Checker for the database, which should already have the
+// Schema table. If now is nil, time.Now is used.
+func New(ctx context.Context, db *sql.DB, now func() time.Time) (*Checker, error) {
+	if db == nil {
+		return nil, errors.New("no *sql.DB was provided")
+	}
+	if now == nil {
+		now = time.Now
+	}
+	// Fail at startup instead of on the first check if the table is missing.
+	rows, err := db.QueryContext(ctx, `SELECT id FROM revoked_tokens LIMIT 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revoked tokens table, was it created with sqlrevocation.Schema?: %w", err)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+	return &Checker{db: db, now: now}, nil
+}
+
+// IsRevoked reports if the token with the given ID was revoked. Tokens without
+// an ID can't be revoked.
+func (c *Checker) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	var n int
+	if err := c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE id = $1`, tokenID).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to query revoked tokens: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Revoke records that the token with the given ID, which expires at exp, was
+// revoked. Revoking a token twice isn't an error. Rows for tokens that have
+// since expired are deleted.
+func (c *Checker) Revoke(ctx context.Context, tokenID string, exp time.Time) error {
+	if tokenID == "" {
+		return errors.New("no token ID was provided")
+	}
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= $1`, c.now().Unix()); err != nil {
+		return fmt.Errorf("failed to delete expired tokens: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, `INSERT INTO revoked_tokens (id, expires_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, tokenID, exp.Unix()); err != nil {
+		return fmt.Errorf("failed to record revoked token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package sqlrevocation
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	c, err := New(ctx, db, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	checkRevoked(t, c, "tkn1", false)
+	if err := c.Revoke(ctx, "tkn1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke(tkn1): %v", err)
+	}
+	if err := c.Revoke(ctx, "tkn1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke(tkn1) again: %v", err)
+	}
+	if err := c.Revoke(ctx, "", now.Add(time.Hour)); err == nil {
+		t.Error("Revoke with no token ID succeeded, want an error")
+	}
+	checkRevoked(t, c, "tkn1", true)
+	checkRevoked(t, c, "tkn2", false)
+	checkRevoked(t, c, "", false)
+
+	// Once the token expires, its row is cleaned up on the next revocation.
+	now = now.Add(time.Hour)
+	if err := c.Revoke(ctx, "tkn2", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke(tkn2): %v", err)
+	}
+	checkRevoked(t, c, "tkn1", false)
+	checkRevoked(t, c, "tkn2", true)
+}
+
+func TestNew_NoTable(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "revocation.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := New(context.Background(), db, nil); err == nil {
+		t.Error("New returned no error for a database without the revoked tokens table")
+	}
+}
+
+func checkRevoked(t *testing.T, c *Checker, id string, want bool) {
+	t.Helper()
+	got, err := c.IsRevoked(context.Background(), id)
+	if err != nil {
+		t.Fatalf("IsRevoked(%q): %v", id, err)
+	}
+	if got != want {
+		t.Errorf("IsRevoked(%q) = %t, want %t", id, got, want)
+	}
+}
+
+func setupDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "revocation.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(Schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	return db
+}
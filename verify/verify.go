@@ -0,0 +1,433 @@
+// Package verify is used by downstream RMI services to verify tokens issued by
+// the credential service, i.e. the 'jwt' cookie, API keys, and site tokens.
+// The Middleware puts a typed Principal in the context of each request, e.g.
+//
+//	v, err := verify.New(ctx, &verify.Config{
+//		Logger:   logger,
+//		JWKSURL:  "https://credentials.rmi.org/.well-known/jwks.json",
+//		Issuer:   "https://credentials.rmi.org",
+//		Audience: "pacta.rmi.org",
+//	})
+//	...
+//	r.Use(v.Middleware)
+//	r.Get("/projects", func(w http.ResponseWriter, r *http.Request) {
+//		p, _ := verify.PrincipalFromContext(r.Context())
+//		...
+//	})
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/sitesclaim"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/httprc"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+)
+
+// JWKSPath is where the credential service serves its public keys.
+const JWKSPath = "/.well-known/jwks.json"
+
+// DefaultMinRefreshInterval is the default for Config.MinRefreshInterval.
+const DefaultMinRefreshInterval = time.Minute
+
+var (
+	// ErrNoToken is returned when a request has no token in the
+	// 'Authorization' header or the 'jwt' cookie.
+	ErrNoToken = errors.New("no token found in the 'Authorization' header or 'jwt' cookie")
+	// ErrRevoked is returned for tokens that the RevocationChecker says were
+	// revoked.
+	ErrRevoked = errors.New("token was revoked")
+)
+
+// RevocationChecker reports if a token was revoked, by its 'jti' claim.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+type Config struct {
+	Logger *zap.Logger
+
+	// JWKSURL is the URL of the credential service's key set, e.g.
+	// https://credentials.rmi.org/.well-known/jwks.json, which is refreshed in
+	// the background, and when a token is signed with an unknown key. Exactly
+	// one of JWKSURL and KeySet must be set.
+	JWKSURL string
+	// KeySet is a static set of public keys, see KeySetFromPEM.
+	KeySet jwk.Set
+
+	// Issuer, if set, is the required 'iss' claim of tokens, see the server's
+	// --token_issuer flag.
+	Issuer string
+	// Audience is the required 'aud' claim of tokens, e.g. a site's audience
+	// (see the server's --site_audiences flag), or 'rmi.org' to accept tokens
+	// that aren't restricted to a site. Tokens must have exactly this audience,
+	// so services configured with a site's audience reject the 'jwt' cookie and
+	// API keys, which only have 'rmi.org', and site tokens are only accepted by
+	// that site's services.
+	Audience string
+	// Revocation, if set, is checked for every token.
+	Revocation RevocationChecker
+
+	// MinRefreshInterval limits how often the key set is refreshed because of
+	// unknown key IDs. Defaults to DefaultMinRefreshInterval.
+	MinRefreshInterval time.Duration
+	// HTTPClient is used to fetch the key set, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+func (c *Config) validate() error {
+	if c.Logger == nil {
+		return errors.New("no *zap.Logger was provided")
+	}
+	if (c.JWKSURL == "") == (c.KeySet == nil) {
+		return errors.New("exactly one of JWKSURL and KeySet must be provided")
+	}
+	if c.Audience == "" {
+		return errors.New("no audience was provided")
+	}
+	if c.MinRefreshInterval < 0 {
+		return errors.New("minRefreshInterval can't be negative")
+	}
+	return nil
+}
+
+type Verifier struct {
+	logger     *zap.Logger
+	cache      *jwk.Cache
+	jwksURL    string
+	keySet     jwk.Set
+	iss        string
+	aud        string
+	revocation RevocationChecker
+	now        func() time.Time
+
+	minRefreshInterval time.Duration
+	mu                 sync.Mutex
+	lastRefresh        time.Time
+}
+
+// New returns a *Verifier, which loads the key set up front if it's fetched
+// from JWKSURL.
+func New(ctx context.Context, cfg *Config) (*Verifier, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	v := &Verifier{
+		logger:             cfg.Logger,
+		jwksURL:            cfg.JWKSURL,
+		keySet:             cfg.KeySet,
+		iss:                cfg.Issuer,
+		aud:                cfg.Audience,
+		revocation:         cfg.Revocation,
+		now:                cfg.Now,
+		minRefreshInterval: cfg.MinRefreshInterval,
+	}
+	if v.now == nil {
+		v.now = time.Now
+	}
+	if v.minRefreshInterval == 0 {
+		v.minRefreshInterval = DefaultMinRefreshInterval
+	}
+
+	if cfg.JWKSURL != "" {
+		v.cache = jwk.NewCache(ctx, jwk.WithErrSink(httprc.ErrSinkFunc(func(err error) {
+			cfg.Logger.Warn("failed to refresh credential service key set", zap.Error(err))
+		})))
+		var opts []jwk.RegisterOption
+		if cfg.HTTPClient != nil {
+			opts = append(opts, jwk.WithHTTPClient(cfg.HTTPClient))
+		}
+		if err := v.cache.Register(cfg.JWKSURL, opts...); err != nil {
+			return nil, fmt.Errorf("failed to register key set URL: %w", err)
+		}
+		if _, err := v.cache.Refresh(ctx, cfg.JWKSURL); err != nil {
+			return nil, fmt.Errorf("failed to load key set: %w", err)
+		}
+	}
+	return v, nil
+}
+
+// KeySetFromPEM returns a key set containing the PEM-encoded Ed25519 public
+// key that the credential service signs tokens with, for Config.KeySet. The
+// keyID is required, and has to match the ID of the service's signing key,
+// since every token it issues has a 'kid' header, and only keys with that ID
+// are used to verify it.
+func KeySetFromPEM(dat []byte, keyID string) (jwk.Set, error) {
+	if keyID == "" {
+		return nil, errors.New("no key ID was provided")
+	}
+	key, err := jwk.ParseKey(dat, jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	if err := key.Set(jwk.AlgorithmKey, jwa.EdDSA); err != nil {
+		return nil, fmt.Errorf("failed to set 'alg' on key: %w", err)
+	}
+	if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
+		return nil, fmt.Errorf("failed to set 'kid' on key: %w", err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return nil, fmt.Errorf("failed to add key to set: %w", err)
+	}
+	return set, nil
+}
+
+// Verify validates the token's signature, issuer, audience, expiry, and
+// revocation status, and returns who it was issued to.
+func (v *Verifier) Verify(ctx context.Context, tknStr string) (*Principal, error) {
+	msg, err := jws.Parse([]byte(tknStr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	sigs := msg.Signatures()
+	if len(sigs) != 1 {
+		return nil, fmt.Errorf("token had %d signatures, expected 1", len(sigs))
+	}
+	kid := sigs[0].ProtectedHeaders().KeyID()
+
+	set, err := v.loadKeySet(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []jwt.ParseOption{
+		jwt.WithKeySet(set),
+		jwt.WithAudience(v.aud),
+		jwt.WithClock(jwt.ClockFunc(v.now)),
+		jwt.WithAcceptableSkew(time.Minute),
+		jwt.WithRequiredClaim(jwt.SubjectKey),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithValidate(true),
+	}
+	if v.iss != "" {
+		opts = append(opts, jwt.WithIssuer(v.iss))
+	}
+	tkn, err := jwt.Parse([]byte(tknStr), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token: %w", err)
+	}
+	if _, ok := tkn.Get("local_auth"); ok {
+		// Local source tokens are signed with the same key, but aren't
+		// credentials for downstream services.
+		return nil, errors.New("token was a source token, not an issued credential")
+	}
+	// The credential service issues every token for a single audience, so a
+	// token with several could be accepted both by a site's services and as an
+	// 'rmi.org' token.
+	if aud := tkn.Audience(); len(aud) != 1 {
+		return nil, fmt.Errorf("token had audiences %q, expected only %q", aud, v.aud)
+	}
+
+	if v.revocation != nil {
+		revoked, err := v.revocation.IsRevoked(ctx, tkn.JwtID())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+
+	p, err := principalFromToken(tkn)
+	if err != nil {
+		return nil, err
+	}
+	p.KeyID = kid
+	return p, nil
+}
+
+func (v *Verifier) loadKeySet(ctx context.Context, kid string) (jwk.Set, error) {
+	if v.cache == nil {
+		return v.keySet, nil
+	}
+	set, err := v.cache.Get(ctx, v.jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key set from cache: %w", err)
+	}
+	if _, ok := set.LookupKeyID(kid); ok || !v.allowRefresh() {
+		return set, nil
+	}
+	// The credential service may have rotated its key.
+	v.logger.Info("refreshing key set for unknown key ID", zap.String("kid", kid))
+	refreshed, err := v.cache.Refresh(ctx, v.jwksURL)
+	if err != nil {
+		v.logger.Warn("failed to refresh key set", zap.Error(err))
+		return set, nil
+	}
+	return refreshed, nil
+}
+
+func (v *Verifier) allowRefresh() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	if now.Sub(v.lastRefresh) < v.minRefreshInterval {
+		return false
+	}
+	v.lastRefresh = now
+	return true
+}
+
+// TokenFromRequest returns the token in the request's 'Authorization' header,
+// or failing that, its 'jwt' cookie.
+func TokenFromRequest(r *http.Request) (string, error) {
+	if tknStr := jwtauth.TokenFromHeader(r); tknStr != "" {
+		return tknStr, nil
+	}
+	if tknStr := jwtauth.TokenFromCookie(r); tknStr != "" {
+		return tknStr, nil
+	}
+	return "", ErrNoToken
+}
+
+// Middleware verifies the token in each request (see TokenFromRequest), and
+// adds its Principal to the request context. Requests without a valid token
+// get a 401 response.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tknStr, err := TokenFromRequest(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		p, err := v.Verify(r.Context(), tknStr)
+		if err != nil {
+			v.logger.Info("failed to verify token", zap.Error(err))
+			writeError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+// errorResponse matches the 'Error' schema of the credential service's APIs.
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Message: msg})
+}
+
+// Principal is the user a token was issued to.
+type Principal struct {
+	Subject string
+	// Emails are only included in the 'jwt' cookie and site tokens, not API
+	// keys.
+	Emails []string
+	// AllSites is true if the user can access every site, in which case Sites
+	// is empty.
+	AllSites bool
+	Sites    []allowlist.Site
+	Roles    []string
+	// Scopes are the OAuth scopes the token was issued with, from its
+	// space-delimited 'scope' claim, see
+	// https://www.rfc-editor.org/rfc/rfc8693#section-4.2
+	Scopes []string
+	// KeyID is the ID of the key the token was signed with.
+	KeyID   string
+	TokenID string
+	Expires time.Time
+
+	// Token is the verified token, for any other claims.
+	Token jwt.Token
+}
+
+// CanAccess returns true if the principal is allowed to access the site.
+func (p *Principal) CanAccess(site allowlist.Site) bool {
+	if p.AllSites {
+		return true
+	}
+	for _, s := range p.Sites {
+		if s == site {
+			return true
+		}
+	}
+	return false
+}
+
+func principalFromToken(tkn jwt.Token) (*Principal, error) {
+	p := &Principal{
+		Subject: tkn.Subject(),
+		TokenID: tkn.JwtID(),
+		Expires: tkn.Expiration(),
+		Token:   tkn,
+	}
+	var err error
+	if p.Emails, err = stringsClaim(tkn, "emails"); err != nil {
+		return nil, err
+	}
+	if p.Roles, err = stringsClaim(tkn, "roles"); err != nil {
+		return nil, err
+	}
+	if v, ok := tkn.Get("scope"); ok {
+		scope, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("'scope' claim was of type %T, expected a string", v)
+		}
+		p.Scopes = strings.Fields(scope)
+	}
+	if v, ok := tkn.Get(sitesclaim.Name); ok {
+		sites, err := sitesclaim.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		p.AllSites = sites.All
+		p.Sites = sites.List()
+	}
+	return p, nil
+}
+
+// stringsClaim returns a claim that's a list of strings, or nil if it's
+// missing.
+func stringsClaim(tkn jwt.Token, name string) ([]string, error) {
+	v, ok := tkn.Get(name)
+	if !ok {
+		return nil, nil
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%q claim was of type %T, expected a list", name, v)
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%q claim contained a %T, expected strings", name, item)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+type principalKey struct{}
+
+// NewContext returns a context carrying the principal, e.g. for testing
+// handlers that call PrincipalFromContext.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal added by Middleware.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
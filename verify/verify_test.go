@@ -0,0 +1,429 @@
+package verify
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RMI/credential-service/allowlist"
+	"github.com/RMI/credential-service/cmd/server/usersrv"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap/zaptest"
+)
+
+const testIssuer = "https://credentials.example.com"
+
+func TestVerify(t *testing.T) {
+	issuer := newIssuer(t, "key1")
+	siteTkn, _, err := issuer.IssueSiteToken("user123", "azure", "", []string{"user@example.com"}, nil, allowlist.SitePACTA, "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue site token: %v", err)
+	}
+	sessionTkn, _, err := issuer.IssueToken(usersrv.TokenUseSession, "user123", "azure", "", []string{"user@example.com"}, &allowlist.Entity{AllowAllSites: true}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	expiredTkn, _, err := issuer.IssueSiteToken("user123", "azure", "", nil, nil, allowlist.SitePACTA, "", "", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue expired token: %v", err)
+	}
+	otherIssuer := newIssuer(t, "key1")
+	otherTkn, _, err := otherIssuer.IssueSiteToken("user123", "azure", "", nil, nil, allowlist.SitePACTA, "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue token with other key: %v", err)
+	}
+	sourceTkn := localSourceToken(t, issuer.Key)
+	multiAudTkn := multiAudienceToken(t, issuer.Key)
+
+	tests := []struct {
+		desc     string
+		tkn      string
+		audience string
+		issuer   string
+		want     *Principal
+		wantErr  bool
+	}{
+		{
+			desc:     "site token",
+			tkn:      siteTkn,
+			audience: "pacta.example.com",
+			issuer:   testIssuer,
+			want: &Principal{
+				Subject: "user123",
+				Emails:  []string{"user@example.com"},
+				Sites:   []allowlist.Site{allowlist.SitePACTA},
+				KeyID:   "key1",
+			},
+		},
+		{
+			desc:     "session",
+			tkn:      sessionTkn,
+			audience: "rmi.org",
+			want: &Principal{
+				Subject:  "user123",
+				Emails:   []string{"user@example.com"},
+				AllSites: true,
+				KeyID:    "key1",
+			},
+		},
+		{desc: "session at site", tkn: sessionTkn, audience: "pacta.example.com", wantErr: true},
+		{desc: "site token at other site", tkn: siteTkn, audience: "opgee.example.com", wantErr: true},
+		{desc: "wrong issuer", tkn: siteTkn, audience: "pacta.example.com", issuer: "https://evil.example.com", wantErr: true},
+		{desc: "expired", tkn: expiredTkn, audience: "pacta.example.com", wantErr: true},
+		{desc: "signed with other key", tkn: otherTkn, audience: "pacta.example.com", wantErr: true},
+		{desc: "source token", tkn: sourceTkn, audience: "rmi.org", wantErr: true},
+		{desc: "token for site and rmi.org at site", tkn: multiAudTkn, audience: "pacta.example.com", wantErr: true},
+		{desc: "token for site and rmi.org as session", tkn: multiAudTkn, audience: "rmi.org", wantErr: true},
+		{desc: "garbage", tkn: "not-a-token", audience: "rmi.org", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			set, err := issuer.PublicKeySet()
+			if err != nil {
+				t.Fatalf("failed to get key set: %v", err)
+			}
+			v, err := New(context.Background(), &Config{
+				Logger:   zaptest.NewLogger(t),
+				KeySet:   set,
+				Issuer:   test.issuer,
+				Audience: test.audience,
+			})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			got, err := v.Verify(context.Background(), test.tkn)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Verify succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(Principal{}, "TokenID", "Expires", "Token")); diff != "" {
+				t.Errorf("unexpected principal (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVerify_Revoked(t *testing.T) {
+	issuer := newIssuer(t, "key1")
+	tkn, id, err := issuer.IssueSiteToken("user123", "azure", "", nil, nil, allowlist.SitePACTA, "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	v := newStaticVerifier(t, issuer, fakeRevocation{id: true})
+
+	if _, err := v.Verify(context.Background(), tkn); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Verify returned %v, want ErrRevoked", err)
+	}
+}
+
+func TestVerify_KeyRotation(t *testing.T) {
+	oldIssuer, newIss := newIssuer(t, "old"), newIssuer(t, "new")
+	srv := &jwksServer{}
+	srv.setKeys(t, oldIssuer)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	now := time.Now()
+	v, err := New(context.Background(), &Config{
+		Logger:   zaptest.NewLogger(t),
+		JWKSURL:  ts.URL + JWKSPath,
+		Audience: "pacta.example.com",
+		Now:      func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// The service rotates its key, and starts issuing tokens with the new one.
+	srv.setKeys(t, oldIssuer, newIss)
+	tkn, _, err := newIss.IssueSiteToken("user123", "azure", "", nil, nil, allowlist.SitePACTA, "", "", now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	p, err := v.Verify(context.Background(), tkn)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if p.KeyID != "new" {
+		t.Errorf("principal had key ID %q, want %q", p.KeyID, "new")
+	}
+}
+
+func TestKeySetFromPEM(t *testing.T) {
+	issuer := newIssuer(t, "key1")
+	tkn, _, err := issuer.IssueSiteToken("user123", "azure", "", nil, nil, allowlist.SitePACTA, "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	var priv ed25519.PrivateKey
+	if err := issuer.Key.Raw(&priv); err != nil {
+		t.Fatalf("failed to get raw key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	if _, err := KeySetFromPEM(pubPEM, ""); err == nil {
+		t.Error("KeySetFromPEM with no key ID succeeded, want an error")
+	}
+
+	tests := []struct {
+		desc    string
+		keyID   string
+		wantErr bool
+	}{
+		{desc: "matching key ID", keyID: "key1"},
+		{desc: "other key ID", keyID: "key2", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			set, err := KeySetFromPEM(pubPEM, test.keyID)
+			if err != nil {
+				t.Fatalf("KeySetFromPEM: %v", err)
+			}
+			v, err := New(context.Background(), &Config{
+				Logger:   zaptest.NewLogger(t),
+				KeySet:   set,
+				Audience: "pacta.example.com",
+			})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			p, err := v.Verify(context.Background(), tkn)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Verify succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if p.Subject != "user123" {
+				t.Errorf("principal had subject %q, want %q", p.Subject, "user123")
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	issuer := newIssuer(t, "key1")
+	tkn, _, err := issuer.IssueSiteToken("user123", "azure", "", nil, nil, allowlist.SitePACTA, "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	v := newStaticVerifier(t, issuer, nil)
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			t.Error("no principal in context")
+			return
+		}
+		w.Write([]byte(p.Subject))
+	}))
+
+	tests := []struct {
+		desc       string
+		setup      func(r *http.Request)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			desc:       "header",
+			setup:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+tkn) },
+			wantStatus: http.StatusOK,
+			wantBody:   "user123",
+		},
+		{
+			desc:       "cookie",
+			setup:      func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "jwt", Value: tkn}) },
+			wantStatus: http.StatusOK,
+			wantBody:   "user123",
+		},
+		{
+			desc:       "no token",
+			setup:      func(r *http.Request) {},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"message":"no token found in the 'Authorization' header or 'jwt' cookie"}` + "\n",
+		},
+		{
+			desc:       "invalid token",
+			setup:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+tkn+"x") },
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"message":"Unauthorized"}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			test.setup(r)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if got := w.Body.String(); got != test.wantBody {
+				t.Errorf("body = %q, want %q", got, test.wantBody)
+			}
+		})
+	}
+}
+
+func newIssuer(t *testing.T, kid string) *usersrv.TokenIssuer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		t.Fatalf("failed to make JWK: %v", err)
+	}
+	key.Set(jwk.KeyIDKey, kid)
+	return &usersrv.TokenIssuer{
+		Key:           key,
+		Now:           time.Now,
+		SiteAudiences: map[allowlist.Site]string{allowlist.SitePACTA: "pacta.example.com"},
+		IssuerURL:     testIssuer,
+	}
+}
+
+func newStaticVerifier(t *testing.T, issuer *usersrv.TokenIssuer, rc RevocationChecker) *Verifier {
+	set, err := issuer.PublicKeySet()
+	if err != nil {
+		t.Fatalf("failed to get key set: %v", err)
+	}
+	v, err := New(context.Background(), &Config{
+		Logger:     zaptest.NewLogger(t),
+		KeySet:     set,
+		Audience:   "pacta.example.com",
+		Revocation: rc,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return v
+}
+
+// localSourceToken returns a token like the ones from //cmd/tools/genjwt,
+// which are signed with the same key as issued tokens.
+func localSourceToken(t *testing.T, key jwk.Key) string {
+	tkn := jwt.New()
+	tkn.Set(jwt.SubjectKey, "user123")
+	tkn.Set(jwt.AudienceKey, "rmi.org")
+	tkn.Set(jwt.ExpirationKey, time.Now().Add(time.Hour))
+	tkn.Set("local_auth", true)
+	dat, err := jwt.Sign(tkn, jwt.WithKey(jwa.EdDSA, key))
+	if err != nil {
+		t.Fatalf("failed to sign source token: %v", err)
+	}
+	return string(dat)
+}
+
+// multiAudienceToken returns a token signed with the issuer's key, which is
+// for both a site and 'rmi.org'.
+func multiAudienceToken(t *testing.T, key jwk.Key) string {
+	tkn := jwt.New()
+	tkn.Set(jwt.SubjectKey, "user123")
+	tkn.Set(jwt.AudienceKey, []string{"pacta.example.com", "rmi.org"})
+	tkn.Set(jwt.ExpirationKey, time.Now().Add(time.Hour))
+	dat, err := jwt.Sign(tkn, jwt.WithKey(jwa.EdDSA, key))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return string(dat)
+}
+
+type fakeRevocation map[string]bool
+
+func (f fakeRevocation) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return f[tokenID], nil
+}
+
+// jwksServer serves the public keys of the given issuers, like the
+// credential service's /.well-known/jwks.json endpoint.
+type jwksServer struct {
+	mu  sync.Mutex
+	dat []byte
+}
+
+func (s *jwksServer) setKeys(t *testing.T, issuers ...*usersrv.TokenIssuer) {
+	set := jwk.NewSet()
+	for _, iss := range issuers {
+		pub, err := iss.PublicKeySet()
+		if err != nil {
+			t.Fatalf("failed to get key set: %v", err)
+		}
+		key, _ := pub.Key(0)
+		set.AddKey(key)
+	}
+	dat, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to marshal key set: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dat = dat
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.dat)
+}
+
+func TestPrincipalFromToken(t *testing.T) {
+	tests := []struct {
+		desc  string
+		sites any
+	}{
+		{desc: "legacy sites", sites: "PACTA,OPGEE"},
+		{desc: "structured sites", sites: map[string]any{"v": 1, "sites": map[string]any{"PACTA": map[string]any{}, "OPGEE": map[string]any{}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			tkn := jwt.New()
+			tkn.Set(jwt.SubjectKey, "user123")
+			tkn.Set("sites", test.sites)
+			tkn.Set("roles", []any{"admin"})
+			tkn.Set("scope", "projects:read  projects:write")
+
+			got, err := principalFromToken(tkn)
+			if err != nil {
+				t.Fatalf("principalFromToken: %v", err)
+			}
+			want := &Principal{
+				Subject: "user123",
+				Sites:   []allowlist.Site{allowlist.SiteOPGEE, allowlist.SitePACTA},
+				Roles:   []string{"admin"},
+				Scopes:  []string{"projects:read", "projects:write"},
+			}
+			if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Principal{}, "Token")); diff != "" {
+				t.Errorf("unexpected principal (-want +got)\n%s", diff)
+			}
+		})
+	}
+}